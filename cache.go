@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brandonvfx/sg-restful/shotgun"
+	log "github.com/sirupsen/logrus"
+)
+
+// newCache makes the response cache for a --cache value, "memory" or a
+// redis url. Empty is no cache.
+func newCache(spec string, size int) (shotgun.Cache, error) {
+	switch {
+	case spec == "":
+		return nil, nil
+	case spec == "memory":
+		return shotgun.NewMemoryCache(size), nil
+	case strings.HasPrefix(spec, "redis://"):
+		return newRedisCache(spec)
+	}
+	return nil, fmt.Errorf("Unknown cache '%s', should be memory or a redis:// url", spec)
+}
+
+// invalidateFromEvents drops the cached responses of the entity types when
+// the event log has changes to them, ie: made outside of sg-restful. It
+// runs until stop is closed.
+func invalidateFromEvents(cache shotgun.Cache, sgConnKey string, sg Shotgun, interval time.Duration, entityTypes []string, stop <-chan struct{}) {
+	for {
+		sub, err := subscribeEvents(sgConnKey, sg, interval, entityTypes)
+		if err != nil {
+			log.Error("Cache invalidation: ", err)
+			select {
+			case <-stop:
+				return
+			case <-time.After(interval):
+				continue
+			}
+		}
+
+		dropped := false
+		for !dropped {
+			select {
+			case <-stop:
+				sub.Close()
+				return
+			case events, ok := <-sub.Events:
+				if !ok {
+					dropped = true
+					continue
+				}
+				invalidated := make(map[string]bool)
+				for _, event := range events {
+					if !invalidated[event.EntityType] {
+						invalidated[event.EntityType] = true
+						cache.Invalidate(event.EntityType)
+					}
+				}
+			}
+		}
+		// Dropped for falling behind, anything missed is invalidated
+		// before subscribing again.
+		for _, entityType := range entityTypes {
+			cache.Invalidate(entityType)
+		}
+	}
+}
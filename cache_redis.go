@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-redis/redis"
+	log "github.com/sirupsen/logrus"
+)
+
+// redisCachePrefix namespaces the keys sg-restful keeps in redis.
+const redisCachePrefix = "sg-restful:cache:"
+
+// redisCache is a shotgun.Cache shared by every instance using the redis.
+// The keys of each entity type are kept in a set so they can be dropped
+// together. Redis errors are logged and act as misses.
+type redisCache struct {
+	client *redis.Client
+}
+
+func newRedisCache(url string) (*redisCache, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	return &redisCache{client: redis.NewClient(opts)}, nil
+}
+
+func (rc *redisCache) key(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return redisCachePrefix + hex.EncodeToString(sum[:])
+}
+
+func (rc *redisCache) typeKey(entityType string) string {
+	return redisCachePrefix + "type:" + entityType
+}
+
+func (rc *redisCache) Get(key string) ([]byte, bool) {
+	value, err := rc.client.Get(rc.key(key)).Bytes()
+	if err != nil {
+		if err != redis.Nil {
+			log.Error("Redis cache: ", err)
+		}
+		return nil, false
+	}
+	return value, true
+}
+
+func (rc *redisCache) Set(entityType, key string, value []byte, ttl time.Duration) {
+	key = rc.key(key)
+	typeKey := rc.typeKey(entityType)
+	_, err := rc.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(key, value, ttl)
+		pipe.SAdd(typeKey, key)
+		// Every response of a type has the same ttl, so the set can go
+		// when its newest does.
+		pipe.Expire(typeKey, ttl)
+		return nil
+	})
+	if err != nil {
+		log.Error("Redis cache: ", err)
+	}
+}
+
+// redisInvalidate drops the keys in a type's set and the set itself in one
+// go, a key added between reading the set and deleting it would be kept
+// forever otherwise. DEL is called in chunks, unpack can't take every key
+// of a big set.
+var redisInvalidate = redis.NewScript(`
+local keys = redis.call("SMEMBERS", KEYS[1])
+for i = 1, #keys, 1000 do
+	redis.call("DEL", unpack(keys, i, math.min(i + 999, #keys)))
+end
+redis.call("DEL", KEYS[1])
+return #keys
+`)
+
+func (rc *redisCache) Invalidate(entityType string) {
+	err := redisInvalidate.Run(rc.client, []string{rc.typeKey(entityType)}).Err()
+	if err != nil {
+		log.Error("Redis cache: ", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/brandonvfx/sg-restful/shotgun"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCache(t *testing.T) {
+	cache, err := newCache("", 10)
+	assert.Nil(t, err)
+	assert.Nil(t, cache)
+
+	cache, err = newCache("memory", 10)
+	assert.Nil(t, err)
+	assert.IsType(t, &shotgun.MemoryCache{}, cache)
+
+	cache, err = newCache("redis://localhost:6379/1", 10)
+	assert.Nil(t, err)
+	assert.IsType(t, &redisCache{}, cache)
+
+	_, err = newCache("memcached://localhost", 10)
+	assert.NotNil(t, err)
+}
+
+func TestRedisCache(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	cache, err := newRedisCache("redis://" + mr.Addr())
+	assert.Nil(t, err)
+	cache.Set("Shot", "a", []byte("a"), time.Minute)
+	cache.Set("Shot", "b", []byte("b"), time.Minute)
+	cache.Set("Asset", "c", []byte("c"), time.Second)
+
+	value, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", string(value))
+	_, ok = cache.Get("missing")
+	assert.False(t, ok)
+
+	cache.Invalidate("Shot")
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	_, ok = cache.Get("c")
+	assert.True(t, ok)
+	assert.False(t, mr.Exists(cache.typeKey("Shot")))
+
+	// A type with nothing cached is fine too.
+	cache.Invalidate("Version")
+	cache.Set("Version", "d", []byte("d"), time.Minute)
+	_, ok = cache.Get("d")
+	assert.True(t, ok)
+
+	mr.FastForward(2 * time.Second)
+	_, ok = cache.Get("c")
+	assert.False(t, ok)
+
+	// Errors are misses.
+	mr.Close()
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+}
+
+func TestCachedReads(t *testing.T) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	server, _, config, calls := mockShotgunMethods(map[string]string{
+		"read":   `{"results":{"entities":[{"type":"Shot","id":1,"code":"sh010"}],"paging_info":{"entity_count":1}}}`,
+		"create": `{"results":{"type":"Shot","id":2,"code":"sh020"}}`,
+	})
+	defer server.Close()
+	config.shotgunCache, _ = newRedisCache("redis://" + mr.Addr())
+	config.shotgunCacheTTLs = map[string]time.Duration{"Asset": 0}
+	// Streamed reads aren't cached.
+	config.streamPageSize = 0
+
+	serve := func(req *http.Request) int {
+		w := httptest.NewRecorder()
+		router(config).ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, serve(getRequest("/Shot?fields=code")))
+	assert.Equal(t, http.StatusOK, serve(getRequest("/Shot?fields=code")))
+	assert.Len(t, calls.Method("read"), 1)
+
+	// Another query is another response.
+	serve(getRequest("/Shot?fields=code,sg_status_list"))
+	assert.Len(t, calls.Method("read"), 2)
+
+	// Creating a shot drops the cached shots.
+	assert.Equal(t, http.StatusCreated, serve(postRequest("/Shot", `{"code":"sh020"}`)))
+	serve(getRequest("/Shot?fields=code"))
+	assert.Len(t, calls.Method("read"), 3)
+
+	// Assets aren't cached.
+	serve(getRequest("/Asset"))
+	serve(getRequest("/Asset"))
+	assert.Len(t, calls.Method("read"), 5)
+}
+
+func TestCacheInvalidateFromEvents(t *testing.T) {
+	fel := newFakeEventLog()
+	fel.addEvent(1, "Shot", "Change", 1)
+	server := httptest.NewServer(fel)
+	defer server.Close()
+
+	cache := shotgun.NewMemoryCache(10)
+	cache.Set("Shot", "shots", []byte("{}"), time.Minute)
+	cache.Set("Asset", "assets", []byte("{}"), time.Minute)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	sg := NewShotgun(server.URL, "fake-script", "fake-key")
+	go invalidateFromEvents(cache, "cache-invalidation-test", sg, 10*time.Millisecond, []string{"Shot", "Asset"}, stop)
+
+	time.Sleep(50 * time.Millisecond)
+	_, ok := cache.Get("shots")
+	assert.True(t, ok)
+
+	fel.addEvent(2, "Shot", "Change", 1)
+	deadline := time.Now().Add(time.Second)
+	for ok && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		_, ok = cache.Get("shots")
+	}
+	assert.False(t, ok)
+	_, ok = cache.Get("assets")
+	assert.True(t, ok)
+}
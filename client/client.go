@@ -0,0 +1,176 @@
+// Package client is a Go client for the sg-restful HTTP API.
+//
+//	c := client.New("http://sg-restful:8000", client.ScriptAuth("script", "key"))
+//	shot, err := c.Get(ctx, "Shot", 1, "code", "sg_status_list")
+//
+//	it := c.Iter(ctx, "Shot", client.FindOptions{Q: client.And(client.NewFilter("code", "starts_with", "sh")).Format3()})
+//	for it.Next() {
+//		shot := it.Entity()
+//	}
+//	err = it.Err()
+//
+// Responses other than 2xx are *Error. The change feed and live queries are
+// streams and aren't wrapped.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls an sg-restful server.
+type Client struct {
+	// BaseURL is the server, ie: http://sg-restful:8000
+	BaseURL string
+	// Authorization is sent as the Authorization header, see ScriptAuth and
+	// UserAuth.
+	Authorization string
+	// HTTPClient is http.DefaultClient when nil.
+	HTTPClient *http.Client
+}
+
+// New makes a client.
+func New(baseURL, authorization string) *Client {
+	return &Client{
+		BaseURL:       strings.TrimRight(baseURL, "/"),
+		Authorization: authorization,
+	}
+}
+
+// ScriptAuth is the Authorization header for a script.
+func ScriptAuth(scriptName, scriptKey string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(scriptName+":"+scriptKey))
+}
+
+// UserAuth is the Authorization header for a user.
+func UserAuth(login, password string) string {
+	return "Basic-User " + base64.StdEncoding.EncodeToString([]byte(login+":"+password))
+}
+
+// Error is a response other than 2xx.
+type Error struct {
+	StatusCode int
+	// Message is the body, or its 'message' for json bodies that have one.
+	Message string
+	// Body is the body as is, ie: the current entity of a 412.
+	Body []byte
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("sg-restful: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("sg-restful: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func newError(statusCode int, body []byte) *Error {
+	err := &Error{StatusCode: statusCode, Body: body, Message: strings.TrimSpace(string(body))}
+	var jsonBody struct {
+		Message *string `json:"message"`
+	}
+	if json.Unmarshal(body, &jsonBody) == nil && jsonBody.Message != nil {
+		err.Message = *jsonBody.Message
+	}
+	return err
+}
+
+// StatusCode is the status of an *Error, 0 for other errors.
+func StatusCode(err error) int {
+	if apiErr, ok := err.(*Error); ok {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound is whether err is a 404.
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsConflict is whether err is a 409, ie: an upsert key matched more than
+// one entity.
+func IsConflict(err error) bool {
+	return StatusCode(err) == http.StatusConflict
+}
+
+// IsPreconditionFailed is whether err is a 412 from an If-Match that didn't.
+func IsPreconditionFailed(err error) bool {
+	return StatusCode(err) == http.StatusPreconditionFailed
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// request is a call to the api.
+type request struct {
+	Method      string
+	Path        string
+	Params      url.Values
+	Header      http.Header
+	Body        io.Reader
+	ContentType string
+}
+
+// jsonBody makes a json request body.
+func jsonBody(v interface{}) (io.Reader, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(body), nil
+}
+
+// do sends a request and decodes a json response into out, which can be
+// nil. The status is returned, a 204 leaves out as it is.
+func (c *Client) do(ctx context.Context, r request, out interface{}) (int, error) {
+	u := c.BaseURL + r.Path
+	if len(r.Params) > 0 {
+		u += "?" + r.Params.Encode()
+	}
+	req, err := http.NewRequest(r.Method, u, r.Body)
+	if err != nil {
+		return 0, err
+	}
+	for key, values := range r.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Authorization", c.Authorization)
+	req.Header.Set("Accept", "application/json")
+	if r.Body != nil {
+		contentType := r.ContentType
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.httpClient().Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, newError(resp.StatusCode, body)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent || len(body) == 0 {
+		return resp.StatusCode, nil
+	}
+	return resp.StatusCode, json.Unmarshal(body, out)
+}
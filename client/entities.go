@@ -0,0 +1,362 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entity is an entity as the api returns it, with 'type' and 'id'.
+type Entity map[string]interface{}
+
+// FindOptions are the params of a read.
+type FindOptions struct {
+	// Q is a query in any format, ie: And(...).Format3()
+	Q      string
+	Fields []string
+	// Page starts at 1.
+	Page  int
+	Limit int
+}
+
+func (o FindOptions) params() url.Values {
+	params := url.Values{}
+	if o.Q != "" {
+		params.Set("q", o.Q)
+	}
+	if len(o.Fields) > 0 {
+		params.Set("fields", strings.Join(o.Fields, ","))
+	}
+	if o.Page > 0 {
+		params.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.Limit > 0 {
+		params.Set("limit", strconv.Itoa(o.Limit))
+	}
+	return params
+}
+
+func fieldParams(fields []string) url.Values {
+	params := url.Values{}
+	if len(fields) > 0 {
+		params.Set("fields", strings.Join(fields, ","))
+	}
+	return params
+}
+
+func entityPath(entityType string, id int) string {
+	return fmt.Sprintf("/%s/%d", url.PathEscape(entityType), id)
+}
+
+// Info is the Shotgun and sg-restful versions.
+func (c *Client) Info(ctx context.Context) (map[string]interface{}, error) {
+	var info map[string]interface{}
+	_, err := c.do(ctx, request{Method: "GET", Path: "/"}, &info)
+	return info, err
+}
+
+// Get reads an entity by id.
+func (c *Client) Get(ctx context.Context, entityType string, id int, fields ...string) (Entity, error) {
+	var entity Entity
+	_, err := c.do(ctx, request{Method: "GET", Path: entityPath(entityType, id), Params: fieldParams(fields)}, &entity)
+	return entity, err
+}
+
+// Find reads a page of entities, none is an empty page.
+func (c *Client) Find(ctx context.Context, entityType string, opts FindOptions) ([]Entity, error) {
+	entities := []Entity{}
+	_, err := c.do(ctx, request{Method: "GET", Path: "/" + url.PathEscape(entityType), Params: opts.params()}, &entities)
+	return entities, err
+}
+
+// Summary is a field and how to summarize it, ie: 'count' or 'sum'.
+type Summary struct {
+	Field string `json:"field"`
+	Type  string `json:"type"`
+}
+
+// Grouping groups summaries by a field, Type is ie: 'exact' or 'day'.
+type Grouping struct {
+	Field     string `json:"field"`
+	Type      string `json:"type"`
+	Direction string `json:"direction"`
+}
+
+// SummarizeOptions are the params of a summarize.
+type SummarizeOptions struct {
+	Q         string
+	Summaries []Summary
+	Grouping  []Grouping
+}
+
+// SummarizeResult is the summaries of every entity matched and of each group.
+type SummarizeResult struct {
+	Summaries map[string]interface{} `json:"summaries"`
+	Groups    []SummaryGroup         `json:"groups"`
+}
+
+// SummaryGroup is a group of a summarize.
+type SummaryGroup struct {
+	GroupValue interface{}            `json:"group_value"`
+	GroupName  string                 `json:"group_name"`
+	Summaries  map[string]interface{} `json:"summaries"`
+	Groups     []SummaryGroup         `json:"groups,omitempty"`
+}
+
+// Summarize runs summaries over matching entities.
+func (c *Client) Summarize(ctx context.Context, entityType string, opts SummarizeOptions) (*SummarizeResult, error) {
+	params := url.Values{}
+	if opts.Q != "" {
+		params.Set("q", opts.Q)
+	}
+	if len(opts.Summaries) > 0 {
+		summaries, _ := json.Marshal(opts.Summaries)
+		params.Set("summaries", string(summaries))
+	}
+	if len(opts.Grouping) > 0 {
+		grouping, _ := json.Marshal(opts.Grouping)
+		params.Set("grouping", string(grouping))
+	}
+
+	var result SummarizeResult
+	path := "/" + url.PathEscape(entityType) + "/summarize"
+	if _, err := c.do(ctx, request{Method: "GET", Path: path, Params: params}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// write sends data and decodes the entity that comes back.
+func (c *Client) write(ctx context.Context, method, path string, params url.Values, data interface{}) (Entity, int, error) {
+	body, err := jsonBody(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	var entity Entity
+	status, err := c.do(ctx, request{Method: method, Path: path, Params: params, Body: body}, &entity)
+	return entity, status, err
+}
+
+// Create makes an entity, returned with fields if they are given.
+func (c *Client) Create(ctx context.Context, entityType string, data map[string]interface{}, fields ...string) (Entity, error) {
+	entity, _, err := c.write(ctx, "POST", "/"+url.PathEscape(entityType), fieldParams(fields), data)
+	return entity, err
+}
+
+// Upsert updates the entity matching data's key fields or creates one,
+// created is which.
+func (c *Client) Upsert(ctx context.Context, entityType string, key []string, data map[string]interface{}) (entity Entity, created bool, err error) {
+	params := url.Values{}
+	params.Set("key", strings.Join(key, ","))
+	entity, status, err := c.write(ctx, "PUT", "/"+url.PathEscape(entityType), params, data)
+	return entity, status == http.StatusCreated, err
+}
+
+// Update writes data to an entity, returned with fields if they are given.
+// Update modes go in data, ie: {"tasks": {"$add": [...]}}.
+func (c *Client) Update(ctx context.Context, entityType string, id int, data map[string]interface{}, fields ...string) (Entity, error) {
+	entity, _, err := c.write(ctx, "PATCH", entityPath(entityType, id), fieldParams(fields), data)
+	return entity, err
+}
+
+// Delete retires an entity.
+func (c *Client) Delete(ctx context.Context, entityType string, id int) error {
+	_, err := c.do(ctx, request{Method: "DELETE", Path: entityPath(entityType, id)}, nil)
+	return err
+}
+
+// Revive brings back a retired entity.
+func (c *Client) Revive(ctx context.Context, entityType string, id int) error {
+	_, err := c.do(ctx, request{Method: "POST", Path: entityPath(entityType, id) + "/revive"}, nil)
+	return err
+}
+
+// BulkResult is the ids a bulk update or delete changed, or would have.
+type BulkResult struct {
+	IDs      []int    `json:"ids"`
+	DryRun   bool     `json:"dry_run,omitempty"`
+	Entities []Entity `json:"entities,omitempty"`
+	Message  string   `json:"message,omitempty"`
+}
+
+func bulkParams(q string, dryRun bool) url.Values {
+	params := url.Values{}
+	params.Set("q", q)
+	if dryRun {
+		params.Set("dry_run", "true")
+	}
+	return params
+}
+
+// BulkUpdate writes data to every entity matching q.
+func (c *Client) BulkUpdate(ctx context.Context, entityType, q string, data map[string]interface{}, dryRun bool) (*BulkResult, error) {
+	body, err := jsonBody(data)
+	if err != nil {
+		return nil, err
+	}
+	var result BulkResult
+	r := request{Method: "PATCH", Path: "/" + url.PathEscape(entityType), Params: bulkParams(q, dryRun), Body: body}
+	if _, err := c.do(ctx, r, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// BulkDelete retires every entity matching q.
+func (c *Client) BulkDelete(ctx context.Context, entityType, q string, dryRun bool) (*BulkResult, error) {
+	var result BulkResult
+	r := request{Method: "DELETE", Path: "/" + url.PathEscape(entityType), Params: bulkParams(q, dryRun)}
+	if _, err := c.do(ctx, r, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ImportOptions are the params of an import.
+type ImportOptions struct {
+	// Mode is 'create' or 'upsert'.
+	Mode string
+	Key  []string
+	// Map is the field each column goes to.
+	Map map[string]string
+	// Lookup is the field links to each entity type are found by.
+	Lookup map[string]string
+	DryRun bool
+}
+
+// ImportResult reports each row of an import.
+type ImportResult struct {
+	Mode    string `json:"mode"`
+	DryRun  bool   `json:"dry_run,omitempty"`
+	Created int    `json:"created"`
+	Updated int    `json:"updated"`
+	Failed  int    `json:"failed"`
+	Rows    []struct {
+		Row    int      `json:"row"`
+		Status string   `json:"status"`
+		ID     int      `json:"id,omitempty"`
+		Errors []string `json:"errors,omitempty"`
+	} `json:"rows"`
+}
+
+// Import writes rows of csv or ndjson, contentType is 'text/csv' or
+// 'application/x-ndjson'.
+func (c *Client) Import(ctx context.Context, entityType, contentType string, rows io.Reader, opts ImportOptions) (*ImportResult, error) {
+	params := url.Values{}
+	if opts.Mode != "" {
+		params.Set("mode", opts.Mode)
+	}
+	if len(opts.Key) > 0 {
+		params.Set("key", strings.Join(opts.Key, ","))
+	}
+	for column, field := range opts.Map {
+		params.Set("map["+column+"]", field)
+	}
+	for entityType, field := range opts.Lookup {
+		params.Set("lookup["+entityType+"]", field)
+	}
+	if opts.DryRun {
+		params.Set("dry_run", "true")
+	}
+
+	var result ImportResult
+	r := request{Method: "POST", Path: "/" + url.PathEscape(entityType) + "/_import", Params: params, Body: rows, ContentType: contentType}
+	if _, err := c.do(ctx, r, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Activity is the activity stream of an entity. params are min_id, max_id,
+// limit and fields[type].
+func (c *Client) Activity(ctx context.Context, entityType string, id int, params url.Values) (map[string]interface{}, error) {
+	var activity map[string]interface{}
+	_, err := c.do(ctx, request{Method: "GET", Path: entityPath(entityType, id) + "/activity", Params: params}, &activity)
+	return activity, err
+}
+
+// NoteThread is a note and its replies and attachments. params are
+// fields[type].
+func (c *Client) NoteThread(ctx context.Context, id int, params url.Values) ([]Entity, error) {
+	thread := []Entity{}
+	_, err := c.do(ctx, request{Method: "GET", Path: entityPath("Note", id) + "/thread", Params: params}, &thread)
+	return thread, err
+}
+
+// Search is a text search, the matches grouped by entity type. params are
+// types, q, q[type], project_ids, page and limit.
+func (c *Client) Search(ctx context.Context, text string, params url.Values) (map[string][]Entity, error) {
+	searchParams := url.Values{}
+	for key, values := range params {
+		searchParams[key] = values
+	}
+	searchParams.Set("text", text)
+
+	matches := map[string][]Entity{}
+	_, err := c.do(ctx, request{Method: "GET", Path: "/_search", Params: searchParams}, &matches)
+	return matches, err
+}
+
+// GraphQLResult is the response of a GraphQL query.
+type GraphQLResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors,omitempty"`
+}
+
+// GraphQL runs a query or mutation.
+func (c *Client) GraphQL(ctx context.Context, query string, variables map[string]interface{}) (*GraphQLResult, error) {
+	body, err := jsonBody(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return nil, err
+	}
+	var result GraphQLResult
+	if _, err := c.do(ctx, request{Method: "POST", Path: "/graphql", Body: body}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Webhook is a webhook registration, Secret is only sent.
+type Webhook struct {
+	ID          string    `json:"id,omitempty"`
+	EntityTypes []string  `json:"entity_types"`
+	EventTypes  []string  `json:"event_types,omitempty"`
+	Query       string    `json:"q,omitempty"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+}
+
+// Webhooks lists the webhooks of the credentials.
+func (c *Client) Webhooks(ctx context.Context) ([]Webhook, error) {
+	hooks := []Webhook{}
+	_, err := c.do(ctx, request{Method: "GET", Path: "/_webhooks"}, &hooks)
+	return hooks, err
+}
+
+// CreateWebhook registers a webhook.
+func (c *Client) CreateWebhook(ctx context.Context, hook Webhook) (*Webhook, error) {
+	body, err := jsonBody(hook)
+	if err != nil {
+		return nil, err
+	}
+	var created Webhook
+	if _, err := c.do(ctx, request{Method: "POST", Path: "/_webhooks", Body: body}, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// DeleteWebhook removes a webhook.
+func (c *Client) DeleteWebhook(ctx context.Context, id string) error {
+	_, err := c.do(ctx, request{Method: "DELETE", Path: "/_webhooks/" + url.PathEscape(id)}, nil)
+	return err
+}
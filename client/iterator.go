@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+)
+
+// maxPageSize is the page size of an Iterator without a limit, the server's
+// own default and the most Shotgun returns a page.
+const maxPageSize = 500
+
+// Iterator reads every matching entity a page at a time.
+type Iterator struct {
+	client     *Client
+	ctx        context.Context
+	entityType string
+	opts       FindOptions
+	page       []Entity
+	index      int
+	done       bool
+	err        error
+}
+
+// Iter iterates over the entities matching opts from opts.Page on, a page
+// of opts.Limit at a time. Limits over 500 are lowered to it, Shotgun
+// doesn't return bigger pages.
+func (c *Client) Iter(ctx context.Context, entityType string, opts FindOptions) *Iterator {
+	if opts.Page < 1 {
+		opts.Page = 1
+	}
+	if opts.Limit < 1 || opts.Limit > maxPageSize {
+		opts.Limit = maxPageSize
+	}
+	return &Iterator{client: c, ctx: ctx, entityType: entityType, opts: opts, index: -1}
+}
+
+// Next moves to the next entity, false when there are no more or there was
+// an error.
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	it.index++
+	if it.index < len(it.page) {
+		return true
+	}
+	if it.done {
+		return false
+	}
+
+	it.page, it.err = it.client.Find(it.ctx, it.entityType, it.opts)
+	it.index = 0
+	if it.err != nil {
+		return false
+	}
+	if len(it.page) < it.opts.Limit {
+		it.done = true
+	}
+	it.opts.Page++
+	return len(it.page) > 0
+}
+
+// Entity is the current entity.
+func (it *Iterator) Entity() Entity {
+	if it.index < 0 || it.index >= len(it.page) {
+		return nil
+	}
+	return it.page[it.index]
+}
+
+// Page is the page the current entity is on.
+func (it *Iterator) Page() int {
+	return it.opts.Page - 1
+}
+
+// Err is the error that stopped the iteration.
+func (it *Iterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,60 @@
+package client
+
+import (
+	"encoding/json"
+)
+
+// Filter is a condition of a query, it marshals to [name, relation, values].
+type Filter struct {
+	Name     string
+	Relation string
+	// Values is a value or a slice of them.
+	Values interface{}
+}
+
+// NewFilter makes a filter, ie: NewFilter("sg_status_list", "in", []string{"ip", "rev"}).
+func NewFilter(name, relation string, values interface{}) Filter {
+	return Filter{Name: name, Relation: relation, Values: values}
+}
+
+// MarshalJSON writes the filter as an array.
+func (f Filter) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{f.Name, f.Relation, f.Values})
+}
+
+// Query is filters joined by a logical operator.
+type Query struct {
+	LogicalOperator string   `json:"logical_operator"`
+	Conditions      []Filter `json:"conditions"`
+}
+
+// And matches entities matching every filter.
+func And(filters ...Filter) Query {
+	return Query{LogicalOperator: "and", Conditions: append([]Filter{}, filters...)}
+}
+
+// Or matches entities matching any filter.
+func Or(filters ...Filter) Query {
+	return Query{LogicalOperator: "or", Conditions: append([]Filter{}, filters...)}
+}
+
+// Format2 is the query as {"logical_operator": ..., "conditions": [...]}.
+func (q Query) Format2() string {
+	body, _ := json.Marshal(q)
+	return string(body)
+}
+
+// Format3 is the query as [[name, relation, values], ...]. Format 3 is
+// always 'and' so 'or' queries are Format2.
+func (q Query) Format3() string {
+	if q.LogicalOperator != "and" {
+		return q.Format2()
+	}
+	body, _ := json.Marshal(q.Conditions)
+	return string(body)
+}
+
+// String is Format3.
+func (q Query) String() string {
+	return q.Format3()
+}
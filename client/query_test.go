@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryFormats(t *testing.T) {
+	q := And(
+		NewFilter("code", "is", "sh010"),
+		NewFilter("sg_status_list", "in", []string{"ip", "rev"}),
+	)
+	assert.Equal(t, `[["code","is","sh010"],["sg_status_list","in",["ip","rev"]]]`, q.Format3())
+	assert.Equal(t, q.Format3(), q.String())
+	assert.Equal(t,
+		`{"logical_operator":"and","conditions":[["code","is","sh010"],["sg_status_list","in",["ip","rev"]]]}`,
+		q.Format2())
+
+	q = Or(NewFilter("id", "is", 1))
+	assert.Equal(t, `{"logical_operator":"or","conditions":[["id","is",1]]}`, q.Format3())
+	assert.Equal(t, `[]`, And().Format3())
+}
+
+func TestAuth(t *testing.T) {
+	assert.Equal(t, "Basic c2NyaXB0OmtleQ==", ScriptAuth("script", "key"))
+	assert.Equal(t, "Basic-User bG9naW46cGFzcw==", UserAuth("login", "pass"))
+}
+
+func TestErrors(t *testing.T) {
+	err := newError(404, []byte("Shot 5 not found\n"))
+	assert.Equal(t, "sg-restful: 404 Not Found: Shot 5 not found", err.Error())
+	assert.True(t, IsNotFound(err))
+	assert.False(t, IsConflict(err))
+
+	err = newError(422, []byte(`{"ids":[],"message":"Query matches 600 entities"}`))
+	assert.Equal(t, "Query matches 600 entities", err.Message)
+	assert.Equal(t, 422, StatusCode(err))
+
+	err = newError(412, []byte(`{"type":"Shot","id":1}`))
+	assert.True(t, IsPreconditionFailed(err))
+	assert.Equal(t, `sg-restful: 412 Precondition Failed: {"type":"Shot","id":1}`, err.Error())
+	assert.Equal(t, `{"type":"Shot","id":1}`, string(err.Body))
+
+	err = newError(500, []byte(`{"message":""}`))
+	assert.Equal(t, "sg-restful: 500 Internal Server Error", err.Error())
+
+	assert.Equal(t, 0, StatusCode(assert.AnError))
+}
+
+func TestIterLimit(t *testing.T) {
+	// 1200 shots, pages are never more than 500.
+	limits := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		limits = append(limits, req.URL.Query().Get("limit"))
+		page, _ := strconv.Atoi(req.URL.Query().Get("page"))
+		entities := make([]Entity, 0)
+		for id := (page-1)*500 + 1; id <= page*500 && id <= 1200; id++ {
+			entities = append(entities, Entity{"type": "Shot", "id": id})
+		}
+		json.NewEncoder(rw).Encode(entities)
+	}))
+	defer server.Close()
+
+	it := New(server.URL, ScriptAuth("script", "key")).Iter(context.Background(), "Shot", FindOptions{Limit: 1000})
+	count := 0
+	for it.Next() {
+		count++
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, 1200, count)
+	assert.Equal(t, []string{"500", "500", "500"}, limits)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brandonvfx/sg-restful/client"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveSDK runs the router against a mock Shotgun and returns a client for
+// it. Reads of page 1 have 2 shots, page 2 has 1 and page 3 none.
+func serveSDK(auth string) (*client.Client, *shotgunCalls, func()) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	sgServer, _, config, calls := mockShotgunFunc(func(call shotgunCall) string {
+		switch call.Method {
+		case "read":
+			filters := call.Query["filters"].(map[string]interface{})
+			conditions, _ := filters["conditions"].([]interface{})
+			for _, condition := range conditions {
+				if condition.(map[string]interface{})["path"] == "code" {
+					return `{"results":{"entities":[{"type":"Shot","id":5,"code":"sh010"}],"paging_info":{"entity_count":1}}}`
+				}
+				if condition.(map[string]interface{})["values"].([]interface{})[0] == float64(404) {
+					return `{"results":{"entities":[],"paging_info":{"entity_count":0}}}`
+				}
+			}
+			switch call.Query["paging"].(map[string]interface{})["current_page"] {
+			case float64(1):
+				return `{"results":{"entities":[{"type":"Shot","id":1,"code":"sh010"},{"type":"Shot","id":2,"code":"sh020"}],"paging_info":{"entity_count":3}}}`
+			case float64(2):
+				return `{"results":{"entities":[{"type":"Shot","id":3,"code":"sh030"}],"paging_info":{"entity_count":3}}}`
+			}
+			return `{"results":{"entities":[],"paging_info":{"entity_count":3}}}`
+		case "create":
+			return `{"results":{"type":"Shot","id":7,"code":"sh070"}}`
+		case "update":
+			return `{"results":{"type":"Shot","id":5,"code":"sh010","cut_in":1001}}`
+		case "delete", "revive":
+			return `{"results":true}`
+		case "summarize":
+			return `{"results":{"summaries":{"id":3},"groups":[{"group_name":"ip","group_value":"ip","summaries":{"id":3}}]}}`
+		}
+		return `{"exception":true,"message":"unexpected call","error_code":100}`
+	})
+
+	server := httptest.NewServer(router(config))
+	c := client.New(server.URL+"/", auth)
+	return c, calls, func() {
+		server.Close()
+		sgServer.Close()
+	}
+}
+
+func TestSDKReads(t *testing.T) {
+	c, calls, stop := serveSDK(client.ScriptAuth("fake-script", "fake-key"))
+	defer stop()
+	ctx := context.Background()
+
+	shot, err := c.Get(ctx, "Shot", 1, "code")
+	assert.Nil(t, err)
+	assert.Equal(t, "sh010", shot["code"])
+	// updated_at is read for the ETag.
+	assert.Equal(t, []interface{}{"code", "updated_at"}, calls.Method("read")[0].Query["return_fields"])
+
+	_, err = c.Get(ctx, "Shot", 404)
+	assert.True(t, client.IsNotFound(err))
+
+	shots, err := c.Find(ctx, "Shot", client.FindOptions{
+		Q:      client.And(client.NewFilter("code", "is", "sh010")).Format2(),
+		Fields: []string{"code"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []client.Entity{{"type": "Shot", "id": float64(5), "code": "sh010"}}, shots)
+
+	shots, err = c.Find(ctx, "Shot", client.FindOptions{Page: 3})
+	assert.Nil(t, err)
+	assert.Len(t, shots, 0)
+
+	summary, err := c.Summarize(ctx, "Shot", client.SummarizeOptions{
+		Summaries: []client.Summary{{Field: "id", Type: "count"}},
+		Grouping:  []client.Grouping{{Field: "sg_status_list", Type: "exact", Direction: "asc"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"id": float64(3)}, summary.Summaries)
+	if assert.Len(t, summary.Groups, 1) {
+		assert.Equal(t, "ip", summary.Groups[0].GroupName)
+	}
+	summarizes := calls.Method("summarize")
+	if assert.Len(t, summarizes, 1) {
+		assert.Equal(t, []interface{}{map[string]interface{}{"field": "id", "type": "count"}}, summarizes[0].Query["summaries"])
+	}
+}
+
+func TestSDKIterator(t *testing.T) {
+	c, calls, stop := serveSDK(client.UserAuth("fake-login", "fake-pass"))
+	defer stop()
+
+	it := c.Iter(context.Background(), "Shot", client.FindOptions{Limit: 2, Fields: []string{"code"}})
+	var codes []string
+	for it.Next() {
+		codes = append(codes, it.Entity()["code"].(string))
+	}
+	assert.Nil(t, it.Err())
+	assert.Equal(t, []string{"sh010", "sh020", "sh030"}, codes)
+
+	reads := calls.Method("read")
+	assert.Len(t, reads, 2)
+	assert.Equal(t, map[string]interface{}{"user_login": "fake-login", "user_password": "fake-pass"}, reads[0].Params[0])
+}
+
+func TestSDKWrites(t *testing.T) {
+	c, calls, stop := serveSDK(client.ScriptAuth("fake-script", "fake-key"))
+	defer stop()
+	ctx := context.Background()
+
+	shot, err := c.Create(ctx, "Shot", map[string]interface{}{"code": "sh070"})
+	assert.Nil(t, err)
+	assert.Equal(t, float64(7), shot["id"])
+
+	shot, created, err := c.Upsert(ctx, "Shot", []string{"code"}, map[string]interface{}{"code": "sh010", "cut_in": 1001})
+	assert.Nil(t, err)
+	assert.False(t, created)
+	assert.Equal(t, float64(1001), shot["cut_in"])
+
+	_, err = c.Update(ctx, "Shot", 5, map[string]interface{}{"tasks": map[string]interface{}{"$add": []interface{}{map[string]interface{}{"type": "Task", "id": 9}}}})
+	assert.Nil(t, err)
+	updates := calls.Method("update")
+	if assert.Len(t, updates, 2) {
+		assert.Equal(t, []interface{}{map[string]interface{}{
+			"field_name":               "tasks",
+			"value":                    []interface{}{map[string]interface{}{"type": "Task", "id": float64(9)}},
+			"multi_entity_update_mode": "add",
+		}}, updates[1].Query["fields"])
+	}
+
+	assert.Nil(t, c.Delete(ctx, "Shot", 5))
+	assert.Nil(t, c.Revive(ctx, "Shot", 5))
+	assert.Len(t, calls.Method("revive"), 1)
+
+	result, err := c.BulkDelete(ctx, "Shot", client.And(client.NewFilter("id", "greater_than", 0)).String(), true)
+	assert.Nil(t, err)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, []int{1, 2}, result.IDs)
+	assert.Len(t, calls.Method("batch"), 0)
+}
+
+func TestSDKErrors(t *testing.T) {
+	c, _, stop := serveSDK("")
+	defer stop()
+
+	_, err := c.Get(context.Background(), "Shot", 1)
+	assert.Equal(t, http.StatusUnauthorized, client.StatusCode(err))
+	assert.Equal(t, "sg-restful: 401 Unauthorized: 401 Unauthorized", err.Error())
+
+	c.Authorization = client.ScriptAuth("fake-script", "fake-key")
+	_, err = c.Find(context.Background(), "Shot", client.FindOptions{Q: "not a query"})
+	assert.Equal(t, http.StatusBadRequest, client.StatusCode(err))
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// responseETag is a strong ETag for a response body. Bodies are marshaled
+// from maps so the keys are always in the same order.
+func responseETag(body []byte) string {
+	sum := sha1.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+// entityETag is a strong ETag for a single entity. It hashes the entity's
+// json whatever format it's served in, so If-Match can check it, and
+// changes with its updated_at even when updated_at isn't in the body, ie:
+// the default {type, id}. Formats other than json add their name so each
+// representation has its own.
+func entityETag(entity map[string]interface{}, wantUpdatedAt bool, format string) (string, error) {
+	body, err := json.Marshal(entityBody(entity, wantUpdatedAt))
+	if err != nil {
+		return "", err
+	}
+	updatedAt, _ := entity["updated_at"].(string)
+	hasher := sha1.New()
+	hasher.Write(body)
+	hasher.Write([]byte{0})
+	hasher.Write([]byte(updatedAt))
+	etag := hex.EncodeToString(hasher.Sum(nil))
+	if format != "" && format != "json" {
+		etag += "-" + format
+	}
+	return `"` + etag + `"`, nil
+}
+
+// stripETagFormat takes the format entityETag added off an ETag.
+func stripETagFormat(etag string) string {
+	for _, name := range GetSerializerManager().GetSerializerNames() {
+		if suffix := "-" + name + `"`; strings.HasSuffix(etag, suffix) {
+			return strings.TrimSuffix(etag, suffix) + `"`
+		}
+	}
+	return etag
+}
+
+// entityFields are the fields read for a single entity, the requested ones
+// and updated_at for its validators. wantUpdatedAt is whether updated_at
+// was requested and belongs in the body.
+func entityFields(fields []string) (readFields []string, wantUpdatedAt bool) {
+	for _, field := range fields {
+		if field == "updated_at" {
+			wantUpdatedAt = true
+		}
+	}
+	readFields = append([]string{}, fields...)
+	if !wantUpdatedAt {
+		readFields = append(readFields, "updated_at")
+	}
+	return readFields, wantUpdatedAt
+}
+
+// entityLastModified returns the entity's updated_at, if it was read.
+func entityLastModified(entity map[string]interface{}) (time.Time, bool) {
+	updatedAt, ok := entity["updated_at"].(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	modified, err := time.Parse(time.RFC3339, updatedAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return modified.UTC(), true
+}
+
+// etagMatches checks an If-None-Match header value against etag using the
+// weak comparison.
+func etagMatches(header string, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeConditional sets the validators and writes either a 304 or the body.
+// If-None-Match wins over If-Modified-Since when both are sent. A zero
+// lastModified skips Last-Modified.
+func writeConditional(rw http.ResponseWriter, req *http.Request, body []byte, etag string, contentType string, lastModified time.Time) {
+	rw.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		rw.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+
+	notModified := false
+	if inm := req.Header.Get("If-None-Match"); inm != "" {
+		notModified = etagMatches(inm, etag)
+	} else if ims := req.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		// Last-Modified only has second precision.
+		notModified = err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+
+	if notModified {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	rw.Header().Set("Content-Type", contentType)
+	rw.WriteHeader(http.StatusOK)
+	rw.Write(body)
+}
+
+// entityBody is the entity without updated_at unless it was requested.
+func entityBody(entity map[string]interface{}, wantUpdatedAt bool) map[string]interface{} {
+	if wantUpdatedAt {
+		return entity
+	}
+	body := make(map[string]interface{}, len(entity))
+	for field, value := range entity {
+		if field != "updated_at" {
+			body[field] = value
+		}
+	}
+	return body
+}
+
+// ifMatchPasses checks an If-Match value against the entity's current
+// representation. Each value can be an ETag of any format, compared
+// strongly, or an updated_at timestamp.
+func ifMatchPasses(header string, etag string, lastModified time.Time) bool {
+	// An http date has a comma in it so try the whole header as a
+	// timestamp before splitting it.
+	header = strings.TrimSpace(header)
+	if !lastModified.IsZero() {
+		modified, err := time.Parse(time.RFC3339, header)
+		if err != nil {
+			modified, err = http.ParseTime(header)
+		}
+		if err == nil {
+			return modified.Equal(lastModified.Truncate(time.Second))
+		}
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || stripETagFormat(candidate) == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch reads the current entity when the request has an If-Match
+// header. ETags are for a read with the same fields so the representation
+// is read with the request's 'fields' param. When the precondition fails a
+// 412 with the current representation is written and false is returned, or
+// a 404 when there's no entity.
+func checkIfMatch(rw http.ResponseWriter, req *http.Request, sg Shotgun, entityType string, entityID int) bool {
+	header := req.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	// Not FormValue, that would read a form encoded body.
+	fields := []string{"id"}
+	if fieldsStr := req.URL.Query().Get("fields"); fieldsStr != "" {
+		fields = strings.Split(fieldsStr, ",")
+	}
+
+	readFields, wantUpdatedAt := entityFields(fields)
+	query := newReadQuery(entityType)
+	query.ReturnFields = readFields
+	query.Paging["entities_per_page"] = 1
+	query.Filters.AddCondition(newQueryCondition("id", "is", entityID))
+
+	entities, err := readEntities(sg, query)
+	if err != nil {
+		log.Error("Request Error: ", err)
+		if strings.Contains(err.Error(), "Permission") {
+			rw.WriteHeader(http.StatusForbidden)
+		} else {
+			writeShotgunError(rw, err, http.StatusBadGateway)
+		}
+		return false
+	}
+	if len(entities) == 0 {
+		rw.WriteHeader(http.StatusNotFound)
+		return false
+	}
+
+	entity := entities[0]
+	lastModified, _ := entityLastModified(entity)
+	body, err := json.Marshal(entityBody(entity, wantUpdatedAt))
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	etag, err := entityETag(entity, wantUpdatedAt, "json")
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return false
+	}
+	if ifMatchPasses(header, etag, lastModified) {
+		return true
+	}
+
+	log.Debugf("If-Match failed: %s %d", entityType, entityID)
+	rw.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		rw.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(http.StatusPreconditionFailed)
+	rw.Write(body)
+	return false
+}
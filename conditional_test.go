@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type ConditionalTestSuite struct {
+	suite.Suite
+}
+
+func (suite *ConditionalTestSuite) SetupSuite() {
+	manager := GetQPManager()
+	log.Info(" -- Conditional Test Suite --\n")
+	manager.SetActiveParsers("format1", "format2", "format3")
+}
+
+func TestConditionalTestSuite(t *testing.T) {
+	suite.Run(t, new(ConditionalTestSuite))
+}
+
+func (suite *ConditionalTestSuite) serve(client *Shotgun, config clientConfig, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	return w
+}
+
+func (suite *ConditionalTestSuite) TestFindOneIfNoneMatch() {
+	server, client, config := mockShotgun(200,
+		`{"results":{"entities":[{"type":"Project","id":65,"updated_at":"2017-05-04T10:20:30Z"}],"paging_info":{"current_page":1,"page_count":1,"entity_count":1,"entities_per_page":1}}}`)
+	defer server.Close()
+
+	w := suite.serve(client, config, getRequest("/Project/65?fields=updated_at"))
+	suite.Equal(http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	suite.NotEmpty(etag)
+	suite.Equal("Thu, 04 May 2017 10:20:30 GMT", w.Header().Get("Last-Modified"))
+
+	req := getRequest("/Project/65?fields=updated_at")
+	req.Header.Set("If-None-Match", `"other", `+etag)
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusNotModified, w.Code)
+	suite.Equal(etag, w.Header().Get("ETag"))
+	suite.Empty(w.Body.String())
+
+	req = getRequest("/Project/65?fields=updated_at")
+	req.Header.Set("If-None-Match", `W/`+etag)
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusNotModified, w.Code)
+
+	req = getRequest("/Project/65?fields=updated_at")
+	req.Header.Set("If-None-Match", `"other"`)
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusOK, w.Code)
+}
+
+func (suite *ConditionalTestSuite) TestFindOneIfModifiedSince() {
+	server, client, config := mockShotgun(200,
+		`{"results":{"entities":[{"type":"Project","id":65,"updated_at":"2017-05-04T10:20:30Z"}],"paging_info":{"current_page":1,"page_count":1,"entity_count":1,"entities_per_page":1}}}`)
+	defer server.Close()
+
+	req := getRequest("/Project/65?fields=updated_at")
+	req.Header.Set("If-Modified-Since", "Thu, 04 May 2017 10:20:30 GMT")
+	w := suite.serve(client, config, req)
+	suite.Equal(http.StatusNotModified, w.Code)
+
+	req = getRequest("/Project/65?fields=updated_at")
+	req.Header.Set("If-Modified-Since", "Thu, 04 May 2017 10:20:29 GMT")
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusOK, w.Code)
+
+	// If-None-Match wins.
+	req = getRequest("/Project/65?fields=updated_at")
+	req.Header.Set("If-Modified-Since", "Thu, 04 May 2017 10:20:30 GMT")
+	req.Header.Set("If-None-Match", `"other"`)
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusOK, w.Code)
+}
+
+func (suite *ConditionalTestSuite) TestFindOneWithoutUpdatedAt() {
+	server, client, config := mockShotgun(200,
+		`{"results":{"entities":[{"type":"Project","id":65}],"paging_info":{"current_page":1,"page_count":1,"entity_count":1,"entities_per_page":1}}}`)
+	defer server.Close()
+
+	req := getRequest("/Project/65")
+	req.Header.Set("If-Modified-Since", "Thu, 04 May 2017 10:20:30 GMT")
+	w := suite.serve(client, config, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.NotEmpty(w.Header().Get("ETag"))
+	suite.Empty(w.Header().Get("Last-Modified"))
+}
+
+func (suite *ConditionalTestSuite) TestFindAllIfNoneMatch() {
+	server, client, config := mockShotgun(200,
+		`{"results":{"entities":[{"type":"Project","id":63},{"type":"Project","id":65}],"paging_info":{"current_page":1,"page_count":1,"entity_count":2,"entities_per_page":500}}}`)
+	defer server.Close()
+	// Streamed reads don't send an ETag.
+	config.streamPageSize = 0
+
+	w := suite.serve(client, config, getRequest("/Project"))
+	suite.Equal(http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	suite.Equal(responseETag(w.Body.Bytes()), etag)
+
+	req := getRequest("/Project")
+	req.Header.Set("If-None-Match", etag)
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusNotModified, w.Code)
+	suite.Empty(w.Body.String())
+}
+
+const conditionalCurrent = `{"results":{"entities":[{"type":"Task","id":5,"content":"Animate","updated_at":"2017-05-04T10:20:30Z"}],"paging_info":{"current_page":1,"page_count":1,"entity_count":1,"entities_per_page":1}}}`
+
+func (suite *ConditionalTestSuite) TestUpdateIfMatch() {
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read":   conditionalCurrent,
+		"update": `{"results":{"type":"Task","id":5,"content":"Layout"}}`,
+	})
+	defer server.Close()
+
+	current := suite.serve(client, config, getRequest("/Task/5?fields=content,updated_at"))
+	suite.Equal(http.StatusOK, current.Code)
+
+	req := patchRequest("/Task/5?fields=content,updated_at", `{"content":"Layout"}`)
+	req.Header.Set("If-Match", current.Header().Get("ETag"))
+	w := suite.serve(client, config, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Len(calls.Method("update"), 1)
+
+	req = patchRequest("/Task/5", `{"content":"Layout"}`)
+	req.Header.Set("If-Match", "2017-05-04T10:20:30Z")
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Len(calls.Method("update"), 2)
+
+	req = patchRequest("/Task/5", `{"content":"Layout"}`)
+	req.Header.Set("If-Match", "*")
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Len(calls.Method("update"), 3)
+}
+
+func (suite *ConditionalTestSuite) TestIfMatchOtherFormats() {
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read":   conditionalCurrent,
+		"delete": `{"results":true}`,
+	})
+	defer server.Close()
+
+	etags := make(map[string]bool)
+	for _, accept := range []string{"application/json", "text/csv", "application/x-ndjson", "application/x-yaml"} {
+		req := getRequest("/Task/5?fields=content")
+		req.Header.Set("Accept", accept)
+		current := suite.serve(client, config, req)
+		suite.Equal(http.StatusOK, current.Code, accept)
+		etag := current.Header().Get("ETag")
+		etags[etag] = true
+
+		req = deleteRequest("/Task/5?fields=content")
+		req.Header.Set("If-Match", etag)
+		w := suite.serve(client, config, req)
+		suite.Equal(http.StatusOK, w.Code, accept)
+	}
+	// Each representation has its own ETag.
+	suite.Len(etags, 4)
+	suite.Len(calls.Method("delete"), 4)
+}
+
+func (suite *ConditionalTestSuite) TestUpdateIfMatchFailed() {
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read":   conditionalCurrent,
+		"update": `{"results":{"type":"Task","id":5,"content":"Layout"}}`,
+	})
+	defer server.Close()
+
+	req := patchRequest("/Task/5?fields=content", `{"content":"Layout"}`)
+	req.Header.Set("If-Match", `"stale"`)
+	w := suite.serve(client, config, req)
+	suite.Equal(http.StatusPreconditionFailed, w.Code)
+	suite.JSONEq(`{"type":"Task","id":5,"content":"Animate"}`, w.Body.String())
+	etag, _ := entityETag(map[string]interface{}{"type": "Task", "id": 5, "content": "Animate", "updated_at": "2017-05-04T10:20:30Z"}, false, "json")
+	suite.Equal(etag, w.Header().Get("ETag"))
+	suite.Equal("Thu, 04 May 2017 10:20:30 GMT", w.Header().Get("Last-Modified"))
+
+	req = patchRequest("/Task/5", `{"content":"Layout"}`)
+	req.Header.Set("If-Match", "2017-05-04T10:20:29Z")
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusPreconditionFailed, w.Code)
+
+	suite.Empty(calls.Method("update"))
+}
+
+func (suite *ConditionalTestSuite) TestDeleteIfMatch() {
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read":   conditionalCurrent,
+		"delete": `{"results":true}`,
+	})
+	defer server.Close()
+
+	req := deleteRequest("/Task/5")
+	req.Header.Set("If-Match", "Thu, 04 May 2017 10:20:29 GMT")
+	w := suite.serve(client, config, req)
+	suite.Equal(http.StatusPreconditionFailed, w.Code)
+	suite.Empty(calls.Method("delete"))
+
+	req = deleteRequest("/Task/5")
+	req.Header.Set("If-Match", "Thu, 04 May 2017 10:20:30 GMT")
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Len(calls.Method("delete"), 1)
+}
+
+func (suite *ConditionalTestSuite) TestIfMatchMissing() {
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read":   `{"results":{"entities":[],"paging_info":{"current_page":1,"page_count":0,"entity_count":0,"entities_per_page":1}}}`,
+		"delete": `{"results":true}`,
+	})
+	defer server.Close()
+
+	req := deleteRequest("/Task/5")
+	req.Header.Set("If-Match", "*")
+	w := suite.serve(client, config, req)
+	suite.Equal(http.StatusNotFound, w.Code)
+	suite.Empty(calls.Method("delete"))
+}
+
+func (suite *ConditionalTestSuite) TestIfMatchDefaultFields() {
+	updatedAt := "2017-05-04T10:20:30Z"
+	server, client, config, calls := mockShotgunFunc(func(call shotgunCall) string {
+		if call.Method == "update" {
+			return `{"results":{"type":"Task","id":5}}`
+		}
+		return `{"results":{"entities":[{"type":"Task","id":5,"updated_at":"` + updatedAt +
+			`"}],"paging_info":{"current_page":1,"page_count":1,"entity_count":1,"entities_per_page":1}}}`
+	})
+	defer server.Close()
+
+	current := suite.serve(client, config, getRequest("/Task/5"))
+	suite.Equal(http.StatusOK, current.Code)
+	suite.JSONEq(`{"type":"Task","id":5}`, current.Body.String())
+	suite.Equal("Thu, 04 May 2017 10:20:30 GMT", current.Header().Get("Last-Modified"))
+	etag := current.Header().Get("ETag")
+
+	// Someone else changes it, the body is the same but the ETag isn't.
+	updatedAt = "2017-05-04T10:25:00Z"
+	changed := suite.serve(client, config, getRequest("/Task/5"))
+	suite.Equal(current.Body.String(), changed.Body.String())
+	suite.NotEqual(etag, changed.Header().Get("ETag"))
+
+	req := patchRequest("/Task/5", `{"content":"Layout"}`)
+	req.Header.Set("If-Match", etag)
+	w := suite.serve(client, config, req)
+	suite.Equal(http.StatusPreconditionFailed, w.Code)
+	suite.JSONEq(`{"type":"Task","id":5}`, w.Body.String())
+	suite.Empty(calls.Method("update"))
+
+	req = patchRequest("/Task/5", `{"content":"Layout"}`)
+	req.Header.Set("If-Match", changed.Header().Get("ETag"))
+	w = suite.serve(client, config, req)
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Len(calls.Method("update"), 1)
+}
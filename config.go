@@ -1,13 +1,87 @@
 package main
 
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/brandonvfx/sg-restful/shotgun"
+)
+
 type clientConfig struct {
-	shotgunHost string
-	version     string
+	shotgunHost       string
+	version           string
+	eventPollInterval time.Duration
+	// shotgunTimeout limits every Shotgun call, shotgunMethodTimeouts
+	// overrides it for single methods. 0 is no limit.
+	shotgunTimeout        time.Duration
+	shotgunMethodTimeouts map[string]time.Duration
+	// shotgunRetry retries idempotent calls, shotgunBreaker is shared by
+	// every connection so they all fail fast while Shotgun is down.
+	shotgunRetry   shotgun.RetryPolicy
+	shotgunBreaker *shotgun.Breaker
+	// shotgunCoalescer is shared by every connection so identical reads
+	// made at the same time share a call, nil is off.
+	shotgunCoalescer *shotgun.Coalescer
+	// shotgunCache answers reads, summaries and schema calls for
+	// shotgunCacheTTL or their entity type's shotgunCacheTTLs, nil is off.
+	shotgunCache     shotgun.Cache
+	shotgunCacheTTL  time.Duration
+	shotgunCacheTTLs map[string]time.Duration
+	// bulkMaxAffected caps how many entities a bulk update or retire can
+	// change, 0 is no limit.
+	bulkMaxAffected int
+	// streamPageSize is the page size reads with at least as many entities
+	// per page are streamed from, 0 is never.
+	streamPageSize int
+	// liveQueryOrigins are the origins browsers can open live queries from
+	// besides the api's own host.
+	liveQueryOrigins []string
+	// liveQueryMaxResults caps the entities a live query can start with, 0
+	// is no limit.
+	liveQueryMaxResults int
+	// webhooks is nil unless script credentials were given to run it with.
+	webhooks *webhookDispatcher
+	graphql  *graphqlSchemaHolder
+	// graphqlMaxDepth caps how deeply GraphQL queries nest and
+	// graphqlMaxLinks the linked entities they read, 0 is no limit.
+	graphqlMaxDepth int
+	graphqlMaxLinks int
 }
 
 func newClientConfig(version, shotgunHost string) clientConfig {
 	return clientConfig{
-		shotgunHost: shotgunHost,
-		version:     version,
+		shotgunHost:         shotgunHost,
+		version:             version,
+		eventPollInterval:   2 * time.Second,
+		shotgunTimeout:      time.Minute,
+		shotgunRetry:        shotgun.RetryPolicy{Retries: 2, Backoff: 100 * time.Millisecond, MaxBackoff: 2 * time.Second},
+		shotgunBreaker:      shotgun.NewBreaker(5, 30*time.Second),
+		shotgunCoalescer:    shotgun.NewCoalescer(),
+		shotgunCacheTTL:     time.Minute,
+		bulkMaxAffected:     500,
+		streamPageSize:      500,
+		liveQueryMaxResults: 5000,
+		graphql:             newGraphQLSchemaHolder(10 * time.Minute),
+		graphqlMaxDepth:     5,
+		graphqlMaxLinks:     5000,
+	}
+}
+
+// parseDurations parses named durations like method timeouts,
+// "read=30s,summarize=2m", or cache ttls, "Version=10s,schema=10m".
+func parseDurations(value string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, item := range splitList(value) {
+		pair := strings.SplitN(item, "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("Bad duration '%s', should be name=duration", item)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(pair[1]))
+		if err != nil {
+			return nil, fmt.Errorf("Bad duration '%s': %v", item, err)
+		}
+		timeouts[strings.TrimSpace(pair[0])] = timeout
 	}
+	return timeouts, nil
 }
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Response Structs
+type activityStreamResponse struct {
+	Results   map[string]interface{} `json:"results"`
+	Exception bool                   `json:"exception,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+	ErrorCode int                    `json:"error_code,omitempty"`
+}
+
+// Query Structs
+type activityStreamQuery struct {
+	EntityType   string              `json:"type"`
+	EntityID     int                 `json:"id"`
+	MinID        *int                `json:"min_id,omitempty"`
+	MaxID        *int                `json:"max_id,omitempty"`
+	Limit        int                 `json:"limit"`
+	EntityFields map[string][]string `json:"entity_fields"`
+}
+
+func newActivityStreamQuery(entityType string, entityID int) activityStreamQuery {
+	return activityStreamQuery{
+		EntityType:   entityType,
+		EntityID:     entityID,
+		Limit:        25,
+		EntityFields: make(map[string][]string),
+	}
+}
+
+// entityFieldsParams turns 'fields[<type>]=a,b' query string values into the
+// per entity type field lists Shotgun takes as 'entity_fields'.
+func entityFieldsParams(req *http.Request) map[string][]string {
+	entityFields := make(map[string][]string)
+	for entityType, value := range bracketParams(req.Form, "fields") {
+		entityFields[entityType] = splitList(value)
+	}
+	return entityFields
+}
+
+// Handlers
+
+func entityActivityHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling entityActivityHandler")
+		vars := mux.Vars(req)
+		entityType, ok := vars["entity_type"]
+		if !ok {
+			log.Errorf("Missing Entity Type")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var entityID int
+		var err error
+		entityIDStr, ok := vars["id"]
+		if ok {
+			entityID, err = strconv.Atoi(entityIDStr)
+			if err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		} else {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, "Id missing")
+			return
+		}
+		log.Debugf("Entity: %s - %d", entityType, entityID)
+
+		query := newActivityStreamQuery(entityType, entityID)
+
+		req.ParseForm()
+
+		for _, k := range []string{"min_id", "max_id", "limit"} {
+			value := req.FormValue(k)
+			if value == "" {
+				continue
+			}
+			intValue, err := strconv.Atoi(value)
+			if err != nil {
+				log.Errorf("Could not convert %s '%v' to int", k, value)
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(rw, "Could not convert %s '%v' to int", k, value)
+				return
+			}
+			switch k {
+			case "min_id":
+				query.MinID = &intValue
+			case "max_id":
+				query.MaxID = &intValue
+			case "limit":
+				query.Limit = intValue
+			}
+		}
+		query.EntityFields = entityFieldsParams(req)
+
+		log.Debugf("Query: %v", StructToString(query))
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+
+		sgReq, err := sg.Request("activity_stream_read", query)
+		if err != nil {
+			log.Error("Request Error: ", err)
+			writeShotgunError(rw, err, http.StatusInternalServerError)
+			return
+		}
+		defer sgReq.Body.Close()
+
+		var activityResp activityStreamResponse
+		respBody, err := ioutil.ReadAll(sgReq.Body)
+		if err != nil {
+			log.Error(err)
+			writeShotgunError(rw, err, http.StatusBadGateway)
+			return
+		}
+		err = json.Unmarshal(respBody, &activityResp)
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		log.Debugf("Response: %v", activityResp)
+
+		if activityResp.Exception {
+			if strings.Contains(activityResp.Message, "Permission") {
+				rw.WriteHeader(http.StatusForbidden)
+			} else if strings.Contains(activityResp.Message, "does not exist") {
+				rw.WriteHeader(http.StatusNotFound)
+			} else {
+				rw.WriteHeader(http.StatusBadRequest)
+			}
+			rw.Write(bytes.NewBufferString(activityResp.Message).Bytes())
+			return
+		}
+
+		jsonResp, err := json.Marshal(activityResp.Results)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(jsonResp)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestActivitySimple(t *testing.T) {
+	req := getRequest("/Shot/2/activity")
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"activity_stream_read": `{"results":{"entity_type":"Shot","entity_id":2,"latest_update_id":12,"earliest_update_id":10,"updates":[{"id":12,"update_type":"update"},{"id":10,"update_type":"create"}]}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var jsonResp map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &jsonResp)
+	assert.Nil(t, err)
+	assert.Len(t, jsonResp["updates"], 2)
+
+	sent := calls.Method("activity_stream_read")
+	assert.Len(t, sent, 1)
+	assert.Equal(t, "Shot", sent[0].Query["type"])
+	assert.Equal(t, float64(2), sent[0].Query["id"])
+	assert.Equal(t, float64(25), sent[0].Query["limit"])
+	assert.NotContains(t, sent[0].Query, "min_id")
+}
+
+func TestActivityParams(t *testing.T) {
+	req := getRequest("/Shot/2/activity?min_id=5&max_id=20&limit=10&fields[Version]=code,sg_status_list")
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"activity_stream_read": `{"results":{"entity_type":"Shot","entity_id":2,"updates":[]}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	sent := calls.Method("activity_stream_read")
+	assert.Len(t, sent, 1)
+	assert.Equal(t, float64(5), sent[0].Query["min_id"])
+	assert.Equal(t, float64(20), sent[0].Query["max_id"])
+	assert.Equal(t, float64(10), sent[0].Query["limit"])
+	assert.Equal(t, map[string]interface{}{
+		"Version": []interface{}{"code", "sg_status_list"},
+	}, sent[0].Query["entity_fields"])
+}
+
+func TestActivityBadLimit(t *testing.T) {
+	req := getRequest("/Shot/2/activity?limit=foo")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200, `foo`)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestActivityDoesNotExist(t *testing.T) {
+	req := getRequest("/Shot/2000/activity")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200,
+		`{"exception":true,"message":"API activity_stream_read() Shot with id 2000 does not exist.","error_code":100}`)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestActivityBadResponseJson(t *testing.T) {
+	req := getRequest("/Shot/2/activity")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200, `foo`)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+}
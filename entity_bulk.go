@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// bulkBatchSize is how many updates or retires go in one batch call.
+const bulkBatchSize = 100
+
+type batchResponse struct {
+	Results   []interface{} `json:"results"`
+	Exception bool          `json:"exception,omitempty"`
+	Message   string        `json:"message,omitempty"`
+	ErrorCode int           `json:"error_code,omitempty"`
+}
+
+// bulkResponse lists the ids a bulk request matched. When a batch fails
+// part way the ids are the ones changed before it did.
+type bulkResponse struct {
+	IDs      []int                    `json:"ids"`
+	DryRun   bool                     `json:"dry_run,omitempty"`
+	Entities []map[string]interface{} `json:"entities,omitempty"`
+	Message  string                   `json:"message,omitempty"`
+}
+
+// bulkTargets reads the ids of the entities matching the required q param.
+// The response is written when false is returned.
+func bulkTargets(config clientConfig, rw http.ResponseWriter, req *http.Request, sg Shotgun, entityType string) ([]int, bool) {
+	// Not FormValue, that would read a form encoded body.
+	queryStr := req.URL.Query().Get("q")
+	if queryStr == "" {
+		rw.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(rw, "q missing")
+		return nil, false
+	}
+	filters, err := parseQuery(queryStr)
+	if err != nil {
+		qpeError := err.(queryParseError)
+		log.Error("Request Error: ", qpeError)
+		rw.WriteHeader(qpeError.StatusCode)
+		return nil, false
+	}
+
+	// Only read enough to know the query is over the limit.
+	entities, err := readEntitiesUpTo(sg, entityType, &filters, []string{"id"}, config.bulkMaxAffected)
+	if err != nil {
+		log.Error("Request Error: ", err)
+		if strings.Contains(err.Error(), "Permission") {
+			rw.WriteHeader(http.StatusForbidden)
+		} else {
+			writeShotgunError(rw, err, http.StatusBadGateway)
+		}
+		fmt.Fprintln(rw, err)
+		return nil, false
+	}
+
+	if config.bulkMaxAffected > 0 && len(entities) > config.bulkMaxAffected {
+		rw.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprintf(rw, "Query matches more than the limit of %d entities\n", config.bulkMaxAffected)
+		return nil, false
+	}
+
+	ids := make([]int, len(entities))
+	for i, entity := range entities {
+		ids[i] = int(entity["id"].(float64))
+	}
+	return ids, true
+}
+
+// bulkDryRun checks the dry_run param, writing the ids when it is set.
+func bulkDryRun(rw http.ResponseWriter, req *http.Request, ids []int) bool {
+	dryRun, _ := strconv.ParseBool(req.URL.Query().Get("dry_run"))
+	if dryRun {
+		writeJSON(rw, http.StatusOK, bulkResponse{IDs: ids, DryRun: true})
+	}
+	return dryRun
+}
+
+// runBatch sends requests to Shotgun's batch in chunks. The status is for
+// the failed chunk and done is how many requests were applied before it.
+// Each batch call is all or nothing.
+func runBatch(sg Shotgun, requests []map[string]interface{}) (results []interface{}, done int, status int, err error) {
+	results = make([]interface{}, 0, len(requests))
+	for start := 0; start < len(requests); start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		sgReq, err := sg.Request("batch", requests[start:end])
+		if err != nil {
+			return results, start, shotgunErrorStatus(err, http.StatusInternalServerError), err
+		}
+
+		var batchResp batchResponse
+		respBody, err := ioutil.ReadAll(sgReq.Body)
+		sgReq.Body.Close()
+		if err != nil {
+			return results, start, shotgunErrorStatus(err, http.StatusBadGateway), err
+		}
+		err = json.Unmarshal(respBody, &batchResp)
+		if err != nil {
+			return results, start, http.StatusBadGateway, err
+		}
+		if batchResp.Exception {
+			return results, start, updateExceptionStatus(batchResp.Message), errors.New(batchResp.Message)
+		}
+		results = append(results, batchResp.Results...)
+	}
+	return results, len(requests), http.StatusOK, nil
+}
+
+// Handlers
+
+func entityBulkUpdateHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling entityBulkUpdateHandler")
+		vars := mux.Vars(req)
+		entityType, ok := vars["entity_type"]
+		if !ok {
+			log.Errorf("Missing Entity Type")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		var patchData map[string]interface{}
+		patchBody, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		err = json.Unmarshal(patchBody, &patchData)
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, err)
+			return
+		}
+
+		fields, err := entityUpdateFieldValues(patchData, bracketParams(req.URL.Query(), "mode"))
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, err)
+			return
+		}
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+
+		ids, ok := bulkTargets(config, rw, req, sg, entityType)
+		if !ok || bulkDryRun(rw, req, ids) {
+			return
+		}
+
+		requests := make([]map[string]interface{}, len(ids))
+		for i, id := range ids {
+			requests[i] = map[string]interface{}{
+				"request_type": "update",
+				"type":         entityType,
+				"id":           id,
+				"fields":       fields,
+			}
+		}
+
+		results, done, status, err := runBatch(sg, requests)
+		if err != nil {
+			log.Error("Batch Error: ", err)
+			shotgunRetryAfter(rw, err)
+			writeJSON(rw, status, bulkResponse{IDs: ids[:done], Message: err.Error()})
+			return
+		}
+
+		resp := bulkResponse{IDs: ids, Entities: make([]map[string]interface{}, 0, len(results))}
+		for _, result := range results {
+			if entity, ok := result.(map[string]interface{}); ok {
+				resp.Entities = append(resp.Entities, entity)
+			}
+		}
+		writeJSON(rw, http.StatusOK, resp)
+	}
+}
+
+func entityBulkDeleteHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling entityBulkDeleteHandler")
+		vars := mux.Vars(req)
+		entityType, ok := vars["entity_type"]
+		if !ok {
+			log.Errorf("Missing Entity Type")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+
+		ids, ok := bulkTargets(config, rw, req, sg, entityType)
+		if !ok || bulkDryRun(rw, req, ids) {
+			return
+		}
+
+		requests := make([]map[string]interface{}, len(ids))
+		for i, id := range ids {
+			requests[i] = map[string]interface{}{
+				"request_type": "delete",
+				"type":         entityType,
+				"id":           id,
+			}
+		}
+
+		_, done, status, err := runBatch(sg, requests)
+		if err != nil {
+			log.Error("Batch Error: ", err)
+			shotgunRetryAfter(rw, err)
+			writeJSON(rw, status, bulkResponse{IDs: ids[:done], Message: err.Error()})
+			return
+		}
+		writeJSON(rw, http.StatusOK, bulkResponse{IDs: ids})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bulkReadResponse is a read response with count Shots.
+func bulkReadResponse(count int) string {
+	var entities bytes.Buffer
+	for i := 1; i <= count; i++ {
+		if i > 1 {
+			entities.WriteString(",")
+		}
+		fmt.Fprintf(&entities, `{"type":"Shot","id":%d}`, i)
+	}
+	return fmt.Sprintf(`{"results":{"entities":[%s],"paging_info":{"current_page":1,"page_count":1,"entity_count":%d,"entities_per_page":500}}}`,
+		entities.String(), count)
+}
+
+func bulkPath(query string) string {
+	return "/Shot?q=" + url.QueryEscape(`[["sg_status_list","is","ip"]]`) + query
+}
+
+func TestBulkUpdate(t *testing.T) {
+	req := patchRequest(bulkPath(""), `{"sg_status_list":"fin"}`)
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read":  bulkReadResponse(150),
+		"batch": `{"results":[{"type":"Shot","id":1,"sg_status_list":"fin"}]}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp bulkResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Len(t, resp.IDs, 150)
+	assert.False(t, resp.DryRun)
+	assert.Len(t, resp.Entities, 2)
+
+	batches := calls.Method("batch")
+	if assert.Len(t, batches, 2) {
+		first := batches[0].Params[1].([]interface{})
+		assert.Len(t, first, 100)
+		assert.Equal(t, map[string]interface{}{
+			"request_type": "update",
+			"type":         "Shot",
+			"id":           float64(1),
+			"fields": []interface{}{
+				map[string]interface{}{"field_name": "sg_status_list", "value": "fin"},
+			},
+		}, first[0])
+		assert.Len(t, batches[1].Params[1].([]interface{}), 50)
+	}
+}
+
+func TestBulkDelete(t *testing.T) {
+	req := deleteRequest(bulkPath(""))
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read":  bulkReadResponse(2),
+		"batch": `{"results":[true,true]}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"ids":[1,2]}`, w.Body.String())
+
+	batches := calls.Method("batch")
+	if assert.Len(t, batches, 1) {
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"request_type": "delete", "type": "Shot", "id": float64(1)},
+			map[string]interface{}{"request_type": "delete", "type": "Shot", "id": float64(2)},
+		}, batches[0].Params[1])
+	}
+}
+
+func TestBulkDryRun(t *testing.T) {
+	req := deleteRequest(bulkPath("&dry_run=true"))
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read": bulkReadResponse(3),
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"ids":[1,2,3],"dry_run":true}`, w.Body.String())
+	assert.Empty(t, calls.Method("batch"))
+}
+
+func TestBulkMaxAffected(t *testing.T) {
+	req := patchRequest(bulkPath(""), `{"sg_status_list":"fin"}`)
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read": bulkReadResponse(3),
+	})
+	defer server.Close()
+	config.bulkMaxAffected = 2
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Empty(t, calls.Method("batch"))
+	// Only a page of one more than the limit is read.
+	reads := calls.Method("read")
+	assert.Len(t, reads, 1)
+	assert.Equal(t, float64(3), reads[0].Query["paging"].(map[string]interface{})["entities_per_page"])
+}
+
+func TestBulkMaxAffectedStopsPaging(t *testing.T) {
+	req := deleteRequest(bulkPath(""))
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read": bulkReadResponse(500),
+	})
+	defer server.Close()
+	config.bulkMaxAffected = 600
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Len(t, calls.Method("read"), 2)
+	assert.Empty(t, calls.Method("batch"))
+}
+
+func TestBulkMissingQuery(t *testing.T) {
+	req := deleteRequest("/Shot")
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, calls.All())
+}
+
+func TestBulkBatchError(t *testing.T) {
+	req := deleteRequest(bulkPath(""))
+	w := httptest.NewRecorder()
+
+	server, client, config, _ := mockShotgunMethods(map[string]string{
+		"read":  bulkReadResponse(2),
+		"batch": `{"exception":true,"message":"API batch() Permission denied","error_code":100}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"ids":[],"message":"API batch() Permission denied"}`, w.Body.String())
+}
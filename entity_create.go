@@ -49,22 +49,6 @@ func entityCreateHandler(config clientConfig) func(rw http.ResponseWriter, req *
 		}
 		log.Debugf("Post Data: %v", postData)
 
-		fields := make([]map[string]interface{}, len(postData))
-		i := 0
-		for key, value := range postData {
-			field := make(map[string]interface{})
-			field["field_name"] = key
-			field["value"] = value
-			fields[i] = field
-			i++
-		}
-
-		query := map[string]interface{}{
-			"return_fields": []string{"id"},
-			"type":          entityType,
-			"fields":        fields,
-		}
-
 		ctx := req.Context()
 		sgConn := ctx.Value("sgConn")
 		if sgConn == nil {
@@ -72,29 +56,12 @@ func entityCreateHandler(config clientConfig) func(rw http.ResponseWriter, req *
 			return
 		}
 		sg := sgConn.(Shotgun)
-		sgReq, err := sg.Request("create", query)
-		if err != nil {
-			log.Errorf("Request Error: %s", err)
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		var createResp createResponse
-		respBody, err := ioutil.ReadAll(sgReq.Body)
-		if err != nil {
-			log.Error(err)
-			rw.WriteHeader(http.StatusBadGateway)
-			return
-		}
-		log.Debugf("Json Response: %s", respBody)
-
-		err = json.Unmarshal(respBody, &createResp)
+		createResp, status, err := createEntity(sg, entityType, postData)
 		if err != nil {
 			log.Error(err)
-			rw.WriteHeader(http.StatusBadGateway)
+			writeShotgunError(rw, err, status)
 			return
 		}
-		log.Debugf("Response: %s", createResp)
 
 		if createResp.Exception {
 			if strings.Contains(createResp.Message, "unique") {
@@ -108,14 +75,55 @@ func entityCreateHandler(config clientConfig) func(rw http.ResponseWriter, req *
 			return
 		}
 
-		jsonResp, err := json.Marshal(createResp.Results)
-		if err != nil {
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
+		entityID := 0
+		if id, ok := createResp.Results["id"].(float64); ok {
+			entityID = int(id)
+			rw.Header().Set("Location", fmt.Sprintf("/%s/%d", entityType, entityID))
 		}
+		writeEntityResult(rw, req, sg, entityType, entityID, postData, createResp.Results, http.StatusCreated)
+	}
+}
+
+// entityFieldValues turns posted json into the field list create and update
+// take.
+func entityFieldValues(data map[string]interface{}) []map[string]interface{} {
+	fields := make([]map[string]interface{}, 0, len(data))
+	for key, value := range data {
+		fields = append(fields, map[string]interface{}{
+			"field_name": key,
+			"value":      value,
+		})
+	}
+	return fields
+}
+
+// createEntity creates an entity from posted json. The status to respond
+// with is returned when the request itself fails, exceptions are left in the
+// response.
+func createEntity(sg Shotgun, entityType string, data map[string]interface{}) (createResponse, int, error) {
+	var createResp createResponse
+	query := map[string]interface{}{
+		"return_fields": []string{"id"},
+		"type":          entityType,
+		"fields":        entityFieldValues(data),
+	}
+
+	sgReq, err := sg.Request("create", query)
+	if err != nil {
+		return createResp, shotgunErrorStatus(err, http.StatusInternalServerError), err
+	}
+	defer sgReq.Body.Close()
+
+	respBody, err := ioutil.ReadAll(sgReq.Body)
+	if err != nil {
+		return createResp, shotgunErrorStatus(err, http.StatusBadGateway), err
+	}
+	log.Debugf("Json Response: %s", respBody)
 
-		rw.Header().Set("Content-Type", "application/json")
-		rw.WriteHeader(http.StatusCreated)
-		rw.Write(jsonResp)
+	err = json.Unmarshal(respBody, &createResp)
+	if err != nil {
+		return createResp, http.StatusBadGateway, err
 	}
+	log.Debugf("Response: %v", createResp)
+	return createResp, http.StatusOK, nil
 }
@@ -111,3 +111,61 @@ func TestCreateShotgunError(t *testing.T) {
 	router(config).ServeHTTP(w, req.WithContext(ctx))
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func TestCreateLocation(t *testing.T) {
+	req := postRequest("/Project", `{"name": "My Project"}`)
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"create": `{"results":{"id":75,"name":"My Project","type":"Project"}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/Project/75", w.Header().Get("Location"))
+	assert.JSONEq(t, `{"id":75,"name":"My Project","type":"Project"}`, w.Body.String())
+	assert.Empty(t, calls.Method("read"))
+}
+
+func TestCreateFields(t *testing.T) {
+	req := postRequest("/Shot?fields=code,project.Project.name", `{"code": "sh010"}`)
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"create": `{"results":{"id":7,"code":"sh010","type":"Shot"}}`,
+		"read":   `{"results":{"entities":[{"type":"Shot","id":7,"code":"sh010","project.Project.name":"Big Buck Bunny"}],"paging_info":{"current_page":1,"page_count":1,"entity_count":1,"entities_per_page":1}}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/Shot/7", w.Header().Get("Location"))
+	assert.JSONEq(t, `{"type":"Shot","id":7,"code":"sh010","project.Project.name":"Big Buck Bunny"}`, w.Body.String())
+
+	reads := calls.Method("read")
+	if assert.Len(t, reads, 1) {
+		assert.Equal(t, []interface{}{"code", "project.Project.name"}, reads[0].Query["return_fields"])
+	}
+}
+
+func TestCreatePreferMinimal(t *testing.T) {
+	req := postRequest("/Project", `{"name": "My Project"}`)
+	req.Header.Set("Prefer", "return=minimal")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200, `{"results":{"id":75,"name":"My Project","type":"Project"}}`)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/Project/75", w.Header().Get("Location"))
+	assert.Equal(t, "return=minimal", w.Header().Get("Preference-Applied"))
+	assert.Empty(t, w.Body.String())
+}
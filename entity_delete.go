@@ -57,18 +57,22 @@ func entityDeleteHandler(config clientConfig) func(rw http.ResponseWriter, req *
 			return
 		}
 		sg := sgConn.(Shotgun)
+		if !checkIfMatch(rw, req, sg, entityType, entityID) {
+			return
+		}
 		sgReq, err := sg.Request("delete", query)
 		if err != nil {
 			log.Error("Request Error: ", err)
-			rw.WriteHeader(http.StatusInternalServerError)
+			writeShotgunError(rw, err, http.StatusInternalServerError)
 			return
 		}
+		defer sgReq.Body.Close()
 
 		var deleteResp deleteResponse
 		respBody, err := ioutil.ReadAll(sgReq.Body)
 		if err != nil {
 			log.Error(err)
-			rw.WriteHeader(http.StatusBadGateway)
+			writeShotgunError(rw, err, http.StatusBadGateway)
 			return
 		}
 
@@ -104,3 +108,12 @@ func entityDeleteHandler(config clientConfig) func(rw http.ResponseWriter, req *
 		rw.WriteHeader(http.StatusOK)
 	}
 }
+
+// entityIDRequest runs a request that takes a type and id and returns
+// whether it worked, ie: 'delete' and 'revive'. Exceptions are errors.
+func entityIDRequest(sg Shotgun, method string, entityType string, entityID int) (bool, error) {
+	if method == "revive" {
+		return sg.Client().Revive(sg.Context(), entityType, entityID)
+	}
+	return sg.Client().Delete(sg.Context(), entityType, entityID)
+}
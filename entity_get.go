@@ -23,6 +23,11 @@ func entityGetHandler(config clientConfig) func(rw http.ResponseWriter, req *htt
 			return
 		}
 
+		format, serializer, ok := negotiateFormat(rw, req)
+		if !ok {
+			return
+		}
+
 		query := map[string]interface{}{
 			"return_fields":         nil,
 			"type":                  entityType,
@@ -67,7 +72,8 @@ func entityGetHandler(config clientConfig) func(rw http.ResponseWriter, req *htt
 		if fieldsStr != "" {
 			fields = strings.Split(fieldsStr, ",")
 		}
-		query["return_fields"] = fields
+		readFields, wantUpdatedAt := entityFields(fields)
+		query["return_fields"] = readFields
 
 		log.Debug(query)
 
@@ -81,15 +87,16 @@ func entityGetHandler(config clientConfig) func(rw http.ResponseWriter, req *htt
 		sgReq, err := sg.Request("read", query)
 		if err != nil {
 			log.Error("Request Error: ", err)
-			rw.WriteHeader(http.StatusInternalServerError)
+			writeShotgunError(rw, err, http.StatusInternalServerError)
 			return
 		}
+		defer sgReq.Body.Close()
 
 		var readResp readResponse
 		respBody, err := ioutil.ReadAll(sgReq.Body)
 		if err != nil {
 			log.Error(err)
-			rw.WriteHeader(http.StatusBadGateway)
+			writeShotgunError(rw, err, http.StatusBadGateway)
 			return
 		}
 		err = json.Unmarshal(respBody, &readResp)
@@ -106,15 +113,20 @@ func entityGetHandler(config clientConfig) func(rw http.ResponseWriter, req *htt
 			return
 		}
 
-		jsonResp, err := json.Marshal(readResp.Results.Entities[0])
+		entity := readResp.Results.Entities[0]
+		body, err := serializer.SerializeOne(entityBody(entity, wantUpdatedAt), append([]string{"type", "id"}, fields...))
 
 		if err != nil {
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		rw.Header().Set("Content-Type", "application/json")
-		rw.WriteHeader(http.StatusOK)
-		rw.Write(jsonResp)
+		etag, err := entityETag(entity, wantUpdatedAt, format)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		lastModified, _ := entityLastModified(entity)
+		writeConditional(rw, req, body, etag, serializer.MediaTypes()[0], lastModified)
 	}
 }
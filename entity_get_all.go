@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	log "github.com/sirupsen/logrus"
@@ -35,6 +36,12 @@ type readQuery struct {
 	ReturnOnly         string         `json:"return_only"`
 	Paging             map[string]int `json:"paging"`
 	Filters            readFilters    `json:"filters"`
+	Sorts              []readSort     `json:"sorts,omitempty"`
+}
+
+type readSort struct {
+	FieldName string `json:"field_name"`
+	Direction string `json:"direction"`
 }
 
 func newReadQuery(entityType string) readQuery {
@@ -107,6 +114,11 @@ func entityGetAllHandler(config clientConfig) func(rw http.ResponseWriter, req *
 		}
 		log.Debugf("Entity: %s", entityType)
 
+		_, serializer, ok := negotiateFormat(rw, req)
+		if !ok {
+			return
+		}
+
 		query := newReadQuery(entityType)
 
 		req.ParseForm()
@@ -187,10 +199,24 @@ func entityGetAllHandler(config clientConfig) func(rw http.ResponseWriter, req *
 		}
 		sg := sgConn.(Shotgun)
 
+		streamer, stream := serializer.(StreamSerializerI)
+		stream = stream && config.streamPageSize > 0 && query.Paging["entities_per_page"] >= config.streamPageSize
+		if stream {
+			// The cache and coalescing would hold the whole response.
+			sg.Cache = nil
+			sg.Coalescer = nil
+		}
+
 		sgReq, err := sg.Request("read", query)
 		if err != nil {
 			log.Error("Request Error: ", err)
-			rw.WriteHeader(http.StatusInternalServerError)
+			writeShotgunError(rw, err, http.StatusInternalServerError)
+			return
+		}
+		defer sgReq.Body.Close()
+
+		if stream {
+			streamEntities(rw, sgReq.Body, streamer)
 			return
 		}
 
@@ -198,7 +224,7 @@ func entityGetAllHandler(config clientConfig) func(rw http.ResponseWriter, req *
 		respBody, err := ioutil.ReadAll(sgReq.Body)
 		if err != nil {
 			log.Error(err)
-			rw.WriteHeader(http.StatusBadGateway)
+			writeShotgunError(rw, err, http.StatusBadGateway)
 			return
 		}
 		err = json.Unmarshal(respBody, &readResp)
@@ -221,16 +247,13 @@ func entityGetAllHandler(config clientConfig) func(rw http.ResponseWriter, req *
 			return
 		}
 
-		var jsonResp []byte
-		jsonResp, err = json.Marshal(readResp.Results.Entities)
+		body, err := serializer.Serialize(readResp.Results.Entities, append([]string{"type", "id"}, query.ReturnFields...))
 
 		if err != nil {
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		rw.Header().Set("Content-Type", "application/json")
-		rw.WriteHeader(http.StatusOK)
-		rw.Write(jsonResp)
+		writeConditional(rw, req, body, responseETag(body), serializer.MediaTypes()[0], time.Time{})
 	}
 }
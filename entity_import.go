@@ -0,0 +1,715 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// importRowReport is the outcome of one row of an import. Rows are numbered
+// like a spreadsheet, so the first row of a csv after its header is 2.
+type importRowReport struct {
+	Row    int      `json:"row"`
+	Status string   `json:"status"`
+	ID     int      `json:"id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+type importResponse struct {
+	Mode    string            `json:"mode"`
+	DryRun  bool              `json:"dry_run,omitempty"`
+	Created int               `json:"created"`
+	Updated int               `json:"updated"`
+	Failed  int               `json:"failed"`
+	Rows    []importRowReport `json:"rows"`
+}
+
+// importRow is a row being imported, values are keyed by field once the
+// mapping is applied.
+type importRow struct {
+	report importRowReport
+	values map[string]interface{}
+	fields map[string]interface{}
+	id     int
+}
+
+func (row *importRow) fail(format string, args ...interface{}) {
+	row.report.Status = "failed"
+	row.report.Errors = append(row.report.Errors, fmt.Sprintf(format, args...))
+}
+
+// written marks the row's create or update as done.
+func (row *importRow) written() {
+	if row.report.Status == "create" {
+		row.report.Status = "created"
+	} else {
+		row.report.Status = "updated"
+	}
+}
+
+func (row *importRow) failed() bool {
+	return row.report.Status == "failed"
+}
+
+// importRows reads csv or ndjson into rows. Empty csv cells are left out.
+func importRows(mediaType string, body []byte) ([]*importRow, error) {
+	rows := make([]*importRow, 0)
+	switch mediaType {
+	case "text/csv":
+		reader := csv.NewReader(bytes.NewReader(body))
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("Bad csv header: %v", err)
+		}
+		for i := range header {
+			header[i] = strings.TrimSpace(header[i])
+		}
+		for line := 2; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			row := &importRow{report: importRowReport{Row: line}, values: make(map[string]interface{})}
+			rows = append(rows, row)
+			if err != nil {
+				row.fail("%v", err)
+				continue
+			}
+			if len(record) > len(header) {
+				row.fail("Row has %d columns, the header has %d", len(record), len(header))
+				continue
+			}
+			for i, value := range record {
+				if value != "" {
+					row.values[header[i]] = value
+				}
+			}
+		}
+	case "application/x-ndjson", "application/ndjson":
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			row := &importRow{report: importRowReport{Row: line}}
+			rows = append(rows, row)
+			if err := json.Unmarshal(scanner.Bytes(), &row.values); err != nil || row.values == nil {
+				row.fail("Line is not a json object")
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported Content-Type: '%s'", mediaType)
+	}
+	return rows, nil
+}
+
+// importFields maps the columns of a row to fields. Columns without a
+// mapping keep their name and columns mapped to nothing are dropped.
+func importFields(values map[string]interface{}, mapping map[string]string) map[string]interface{} {
+	fields := make(map[string]interface{})
+	for column, value := range values {
+		field := column
+		if mapped, ok := mapping[column]; ok {
+			field = mapped
+		}
+		if field != "" {
+			fields[field] = value
+		}
+	}
+	return fields
+}
+
+// importLink is a link to look up by name.
+type importLink struct {
+	Type string
+	Name string
+}
+
+// linkNameFields are the fields links are looked up by when it isn't 'code'.
+var linkNameFields = map[string]string{
+	"ApiUser":   "firstname",
+	"HumanUser": "name",
+	"Project":   "name",
+	"Task":      "content",
+}
+
+// linkNameField is the field entities of a type are looked up by, lookup
+// maps types to an override from the query string.
+func linkNameField(entityType string, lookup map[string]string) string {
+	if field, ok := lookup[entityType]; ok {
+		return field
+	}
+	if field, ok := linkNameFields[entityType]; ok {
+		return field
+	}
+	return "code"
+}
+
+// parseImportLink reads a link written as 'name' or 'Type:name'. The type
+// can be left out when the field only links to one.
+func parseImportLink(fieldName string, field schemaField, value string) (importLink, error) {
+	value = strings.TrimSpace(value)
+	if i := strings.Index(value, ":"); i > 0 {
+		for _, validType := range field.ValidTypes {
+			if validType == value[:i] {
+				return importLink{Type: validType, Name: strings.TrimSpace(value[i+1:])}, nil
+			}
+		}
+	}
+	if len(field.ValidTypes) != 1 {
+		return importLink{}, fmt.Errorf("%s links to more than one type, use 'Type:name': '%s'", fieldName, value)
+	}
+	return importLink{Type: field.ValidTypes[0], Name: value}, nil
+}
+
+// importValue converts a value to the field's type. csv values are all
+// strings, ndjson values only get converted when they are strings. Links
+// come back as importLinks to be looked up.
+func importValue(fieldName string, field schemaField, value interface{}) (interface{}, error) {
+	str, isString := value.(string)
+	if !isString {
+		if field.DataType == "multi_entity" {
+			// A list of names.
+			if list, ok := value.([]interface{}); ok {
+				links := make([]interface{}, len(list))
+				for i, item := range list {
+					name, ok := item.(string)
+					if !ok {
+						links[i] = item
+						continue
+					}
+					link, err := parseImportLink(fieldName, field, name)
+					if err != nil {
+						return nil, err
+					}
+					links[i] = link
+				}
+				return links, nil
+			}
+		}
+		return value, nil
+	}
+
+	switch field.DataType {
+	case "number", "duration", "percent", "timecode":
+		number, err := strconv.Atoi(strings.TrimSpace(str))
+		if err != nil {
+			return nil, fmt.Errorf("%s is not a number: '%s'", fieldName, str)
+		}
+		return number, nil
+	case "float", "currency":
+		number, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+		if err != nil || math.IsNaN(number) || math.IsInf(number, 0) {
+			return nil, fmt.Errorf("%s is not a number: '%s'", fieldName, str)
+		}
+		return number, nil
+	case "checkbox":
+		checked, err := strconv.ParseBool(strings.TrimSpace(str))
+		if err != nil {
+			return nil, fmt.Errorf("%s is not true or false: '%s'", fieldName, str)
+		}
+		return checked, nil
+	case "date":
+		if _, err := time.Parse("2006-01-02", str); err != nil {
+			return nil, fmt.Errorf("%s is not a date (YYYY-MM-DD): '%s'", fieldName, str)
+		}
+	case "date_time":
+		if _, err := time.Parse(time.RFC3339, str); err != nil {
+			return nil, fmt.Errorf("%s is not an RFC3339 date time: '%s'", fieldName, str)
+		}
+	case "list", "status_list":
+		if len(field.ValidValues) == 0 {
+			break
+		}
+		for _, validValue := range field.ValidValues {
+			if validValue == str {
+				return str, nil
+			}
+		}
+		return nil, fmt.Errorf("%s is not one of %s: '%s'", fieldName, strings.Join(field.ValidValues, ", "), str)
+	case "entity":
+		return parseImportLink(fieldName, field, str)
+	case "multi_entity":
+		links := make([]interface{}, 0)
+		for _, name := range splitList(str) {
+			link, err := parseImportLink(fieldName, field, name)
+			if err != nil {
+				return nil, err
+			}
+			links = append(links, link)
+		}
+		return links, nil
+	}
+	return str, nil
+}
+
+// importScope is a linked type looked up in a project, 0 is every project.
+type importScope struct {
+	Type    string
+	Project int
+}
+
+// importRowProject is the id of the project a row goes to, from its project
+// field once it's looked up, or project.
+func importRowProject(row *importRow, project int) int {
+	if entity, ok := row.fields["project"].(map[string]interface{}); ok && entity["type"] == "Project" {
+		switch id := entity["id"].(type) {
+		case int:
+			return id
+		case float64:
+			return int(id)
+		}
+	}
+	return project
+}
+
+// resolveImportLinks looks up every link in rows by name, a read per linked
+// type, and replaces them with the entities. Projects are looked up first so
+// links to entities with a project are looked up in the row's project, or in
+// project when rows don't have one. Names that match no entity, or more than
+// one, fail the row.
+func resolveImportLinks(sg Shotgun, rows []*importRow, lookup map[string]string, project int) error {
+	err := lookupImportLinks(sg, rows, lookup, func(row *importRow, link importLink) (int, bool) {
+		return 0, link.Type == "Project"
+	})
+	if err != nil {
+		return err
+	}
+
+	projectTypes := make(map[string]bool)
+	for _, row := range rows {
+		if row.failed() || importRowProject(row, project) == 0 {
+			continue
+		}
+		for _, value := range row.fields {
+			links, ok := value.([]interface{})
+			if !ok {
+				links = []interface{}{value}
+			}
+			for _, link := range links {
+				link, ok := link.(importLink)
+				if !ok {
+					continue
+				}
+				if _, ok := projectTypes[link.Type]; ok {
+					continue
+				}
+				schema, err := readFieldSchema(sg, link.Type)
+				if err != nil {
+					return err
+				}
+				field, ok := schema["project"]
+				projectTypes[link.Type] = ok && field.DataType == "entity"
+			}
+		}
+	}
+
+	return lookupImportLinks(sg, rows, lookup, func(row *importRow, link importLink) (int, bool) {
+		if projectTypes[link.Type] {
+			return importRowProject(row, project), true
+		}
+		return 0, true
+	})
+}
+
+// lookupImportLinks looks up the links scope takes, a read per type and
+// project.
+func lookupImportLinks(sg Shotgun, rows []*importRow, lookup map[string]string, scope func(*importRow, importLink) (int, bool)) error {
+	names := make(map[importScope]map[string]bool)
+	forEachLink := func(fn func(row *importRow, link importLink, scope importScope) interface{}) {
+		for _, row := range rows {
+			if row.failed() {
+				continue
+			}
+			for fieldName, value := range row.fields {
+				switch value := value.(type) {
+				case importLink:
+					if project, ok := scope(row, value); ok {
+						row.fields[fieldName] = fn(row, value, importScope{value.Type, project})
+					}
+				case []interface{}:
+					for i, item := range value {
+						if link, ok := item.(importLink); ok {
+							if project, ok := scope(row, link); ok {
+								value[i] = fn(row, link, importScope{link.Type, project})
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+
+	forEachLink(func(row *importRow, link importLink, scope importScope) interface{} {
+		if names[scope] == nil {
+			names[scope] = make(map[string]bool)
+		}
+		names[scope][link.Name] = true
+		return link
+	})
+
+	found := make(map[importScope]map[string][]int)
+	for scope, scopeNames := range names {
+		nameField := linkNameField(scope.Type, lookup)
+		values := make([]interface{}, 0, len(scopeNames))
+		for name := range scopeNames {
+			values = append(values, name)
+		}
+		filters := newReadFilters()
+		filters.AddCondition(newQueryCondition(nameField, "in", values))
+		if scope.Project > 0 {
+			filters.AddCondition(newQueryCondition("project", "is", map[string]interface{}{"type": "Project", "id": scope.Project}))
+		}
+		entities, err := readAllEntities(sg, scope.Type, &filters, []string{"id", nameField})
+		if err != nil {
+			return err
+		}
+
+		found[scope] = make(map[string][]int)
+		for _, entity := range entities {
+			name := cellString(entity[nameField])
+			found[scope][name] = append(found[scope][name], int(entity["id"].(float64)))
+		}
+	}
+
+	forEachLink(func(row *importRow, link importLink, scope importScope) interface{} {
+		ids := found[scope][link.Name]
+		if len(ids) == 0 {
+			row.fail("No %s named '%s'", link.Type, link.Name)
+		} else if len(ids) > 1 {
+			row.fail("More than one %s named '%s'", link.Type, link.Name)
+		} else {
+			return map[string]interface{}{"type": link.Type, "id": ids[0]}
+		}
+		return nil
+	})
+	return nil
+}
+
+// importKey is the key of an entity or row for matching upserts.
+func importKey(values map[string]interface{}, keyFields []string) string {
+	parts := make([]string, len(keyFields))
+	for i, keyField := range keyFields {
+		value := values[keyField]
+		if key, ok := importEntityKey(value); ok {
+			parts[i] = key
+		} else {
+			parts[i] = fmt.Sprintf("%v", value)
+		}
+	}
+	key, _ := json.Marshal(parts)
+	return string(key)
+}
+
+// importEntityKey is entityKey for links that were just looked up too.
+func importEntityKey(value interface{}) (string, bool) {
+	if entity, ok := value.(map[string]interface{}); ok {
+		if id, isInt := entity["id"].(int); isInt {
+			return fmt.Sprintf("%s:%d", entity["type"], id), true
+		}
+	}
+	return entityKey(value)
+}
+
+// matchImportRows finds the existing entity of each row by its key fields,
+// bulkBatchSize rows a read.
+func matchImportRows(sg Shotgun, entityType string, rows []*importRow, keyFields []string) error {
+	pending := make([]*importRow, 0, len(rows))
+	seen := make(map[string]int)
+	for _, row := range rows {
+		if row.failed() {
+			continue
+		}
+		missing := false
+		for _, keyField := range keyFields {
+			if _, ok := row.fields[keyField]; !ok {
+				row.fail("Key field missing: '%s'", keyField)
+				missing = true
+			}
+		}
+		if missing {
+			continue
+		}
+		key := importKey(row.fields, keyFields)
+		if line, ok := seen[key]; ok {
+			row.fail("Same key as row %d", line)
+			continue
+		}
+		seen[key] = row.report.Row
+		pending = append(pending, row)
+	}
+
+	for start := 0; start < len(pending); start += bulkBatchSize {
+		end := start + bulkBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		chunk := pending[start:end]
+
+		query := entityMatchQuery{readQuery: newReadQuery(entityType)}
+		query.ReturnFields = append([]string{"id"}, keyFields...)
+		query.Filters = filterGroup{LogicalOperator: "or", Conditions: make([]interface{}, 0, len(chunk))}
+		for _, row := range chunk {
+			filters := newReadFilters()
+			for _, keyField := range keyFields {
+				filters.AddCondition(newQueryCondition(keyField, "is", row.fields[keyField]))
+			}
+			query.Filters.Conditions = append(query.Filters.Conditions, filters)
+		}
+
+		matches := make(map[string][]int)
+		for {
+			page, err := readEntities(sg, query)
+			if err != nil {
+				return err
+			}
+			for _, entity := range page {
+				key := importKey(entity, keyFields)
+				matches[key] = append(matches[key], int(entity["id"].(float64)))
+			}
+			if len(page) < query.Paging["entities_per_page"] {
+				break
+			}
+			query.Paging["current_page"]++
+		}
+
+		for _, row := range chunk {
+			ids := matches[importKey(row.fields, keyFields)]
+			if len(ids) > 1 {
+				row.fail("More than one %s matches key: %s", entityType, strings.Join(keyFields, ","))
+			} else if len(ids) == 1 {
+				row.id = ids[0]
+			}
+		}
+	}
+	return nil
+}
+
+// Handlers
+
+// entityImportHandler creates, or upserts, an entity per row of a csv or
+// ndjson body. Rows are checked against the schema and written through
+// Shotgun's batch, a batch that fails only fails its own rows.
+func entityImportHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling entityImportHandler")
+		vars := mux.Vars(req)
+		entityType, ok := vars["entity_type"]
+		if !ok {
+			log.Errorf("Missing Entity Type")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// Not FormValue, that would read a form encoded body.
+		params := req.URL.Query()
+		mode := params.Get("mode")
+		if mode == "" {
+			mode = "create"
+		}
+		keyFields := splitList(params.Get("key"))
+		switch {
+		case mode != "create" && mode != "upsert":
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "Invalid mode: '%s'\n", mode)
+			return
+		case mode == "upsert" && len(keyFields) == 0:
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, "key missing")
+			return
+		}
+		dryRun, _ := strconv.ParseBool(params.Get("dry_run"))
+		project := 0
+		if value := params.Get("project"); value != "" {
+			id, err := strconv.Atoi(value)
+			if err != nil || id <= 0 {
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(rw, "Invalid project: '%s'\n", value)
+				return
+			}
+			project = id
+		}
+		mapping := bracketParams(params, "map")
+		lookup := bracketParams(params, "lookup")
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		rows, err := importRows(mediaType, body)
+		if err != nil {
+			log.Error(err)
+			if strings.HasPrefix(err.Error(), "Unsupported") {
+				rw.WriteHeader(http.StatusUnsupportedMediaType)
+			} else {
+				rw.WriteHeader(http.StatusBadRequest)
+			}
+			fmt.Fprintln(rw, err)
+			return
+		}
+		if config.bulkMaxAffected > 0 && len(rows) > config.bulkMaxAffected {
+			rw.WriteHeader(http.StatusUnprocessableEntity)
+			fmt.Fprintf(rw, "Import has %d rows, more than the limit of %d\n", len(rows), config.bulkMaxAffected)
+			return
+		}
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+
+		schema, err := readFieldSchema(sg, entityType)
+		if err != nil {
+			log.Error("Schema Error: ", err)
+			if strings.Contains(err.Error(), "Permission") {
+				rw.WriteHeader(http.StatusForbidden)
+			} else {
+				writeShotgunError(rw, err, http.StatusBadGateway)
+			}
+			fmt.Fprintln(rw, err)
+			return
+		}
+
+		// A field that can't be written is a bad mapping, not a bad row.
+		badFields := make(map[string]bool)
+		for _, row := range rows {
+			row.fields = importFields(row.values, mapping)
+			for fieldName := range row.fields {
+				if field, ok := schema[fieldName]; !ok || !field.Editable {
+					badFields[fieldName] = true
+				}
+			}
+		}
+		if len(badFields) > 0 {
+			names := make([]string, 0, len(badFields))
+			for name := range badFields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "Unknown or read only fields: %s\n", strings.Join(names, ", "))
+			return
+		}
+
+		for _, row := range rows {
+			if row.failed() {
+				continue
+			}
+			for fieldName, value := range row.fields {
+				converted, err := importValue(fieldName, schema[fieldName], value)
+				if err != nil {
+					row.fail("%v", err)
+					continue
+				}
+				row.fields[fieldName] = converted
+			}
+		}
+
+		err = resolveImportLinks(sg, rows, lookup, project)
+		if err == nil && mode == "upsert" {
+			err = matchImportRows(sg, entityType, rows, keyFields)
+		}
+		if err != nil {
+			log.Error("Request Error: ", err)
+			if strings.Contains(err.Error(), "Permission") {
+				rw.WriteHeader(http.StatusForbidden)
+			} else {
+				writeShotgunError(rw, err, http.StatusBadGateway)
+			}
+			fmt.Fprintln(rw, err)
+			return
+		}
+
+		resp := importResponse{Mode: mode, DryRun: dryRun, Rows: make([]importRowReport, 0, len(rows))}
+		writes := make([]*importRow, 0, len(rows))
+		requests := make([]map[string]interface{}, 0, len(rows))
+		for _, row := range rows {
+			if row.failed() {
+				continue
+			}
+			request := map[string]interface{}{
+				"type":   entityType,
+				"fields": entityFieldValues(row.fields),
+			}
+			if row.id > 0 {
+				request["request_type"] = "update"
+				request["id"] = row.id
+				row.report.Status = "update"
+				row.report.ID = row.id
+			} else {
+				request["request_type"] = "create"
+				request["return_fields"] = []string{"id"}
+				row.report.Status = "create"
+			}
+			writes = append(writes, row)
+			requests = append(requests, request)
+		}
+
+		if dryRun {
+			// Reported like a real import, dry_run in the response says
+			// nothing was written.
+			for _, row := range writes {
+				row.written()
+			}
+		}
+		for start := 0; !dryRun && start < len(requests); start += bulkBatchSize {
+			end := start + bulkBatchSize
+			if end > len(requests) {
+				end = len(requests)
+			}
+			results, _, _, err := runBatch(sg, requests[start:end])
+			for i, row := range writes[start:end] {
+				if err != nil {
+					row.fail("%v", err)
+					continue
+				}
+				row.written()
+				if i < len(results) {
+					if entity, ok := results[i].(map[string]interface{}); ok {
+						if id, ok := entity["id"].(float64); ok {
+							row.report.ID = int(id)
+						}
+					}
+				}
+			}
+		}
+
+		for _, row := range rows {
+			switch row.report.Status {
+			case "created":
+				resp.Created++
+			case "updated":
+				resp.Updated++
+			case "failed":
+				resp.Failed++
+			}
+			resp.Rows = append(resp.Rows, row.report)
+		}
+		writeJSON(rw, http.StatusOK, resp)
+	}
+}
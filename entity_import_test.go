@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const importSchema = `{"results":{
+	"code":{"data_type":{"value":"text"},"editable":{"value":true},"properties":{}},
+	"cut_in":{"data_type":{"value":"number"},"editable":{"value":true},"properties":{}},
+	"sg_aspect":{"data_type":{"value":"float"},"editable":{"value":true},"properties":{}},
+	"project":{"data_type":{"value":"entity"},"editable":{"value":true},"properties":{"valid_types":{"value":["Project"]}}},
+	"sg_status_list":{"data_type":{"value":"status_list"},"editable":{"value":true},"properties":{"valid_values":{"value":["wtg","ip","fin"]}}},
+	"sg_sequence":{"data_type":{"value":"entity"},"editable":{"value":true},"properties":{"valid_types":{"value":["Sequence"]}}},
+	"assets":{"data_type":{"value":"multi_entity"},"editable":{"value":true},"properties":{"valid_types":{"value":["Asset"]}}},
+	"id":{"data_type":{"value":"number"},"editable":{"value":false},"properties":{}}
+}}`
+
+const importSequenceSchema = `{"results":{
+	"code":{"data_type":{"value":"text"},"editable":{"value":true},"properties":{}},
+	"project":{"data_type":{"value":"entity"},"editable":{"value":true},"properties":{"valid_types":{"value":["Project"]}}}
+}}`
+
+// serveImport posts body to the import endpoint. Reads get the sequences,
+// the assets or the existing shots depending on their type.
+func serveImport(path, contentType, body string) (*httptest.ResponseRecorder, *shotgunCalls) {
+	req := postRequest(path, body)
+	req.Header.Set("Content-Type", contentType)
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunFunc(func(call shotgunCall) string {
+		switch call.Method {
+		case "schema_field_read":
+			if call.Query["type"] == "Sequence" {
+				return importSequenceSchema
+			}
+			return importSchema
+		case "read":
+			switch call.Query["type"] {
+			case "Sequence":
+				return `{"results":{"entities":[{"type":"Sequence","id":3,"code":"sq010"}],"paging_info":{"entity_count":1}}}`
+			case "Asset":
+				return `{"results":{"entities":[{"type":"Asset","id":7,"code":"hero"},{"type":"Asset","id":8,"code":"twin"},{"type":"Asset","id":9,"code":"twin"}],"paging_info":{"entity_count":3}}}`
+			case "Shot":
+				return `{"results":{"entities":[{"type":"Shot","id":5,"code":"sh010"}],"paging_info":{"entity_count":1}}}`
+			case "Project":
+				return `{"results":{"entities":[{"type":"Project","id":71,"name":"demo"}],"paging_info":{"entity_count":1}}}`
+			}
+		case "batch":
+			return `{"results":[{"type":"Shot","id":5},{"type":"Shot","id":6}]}`
+		}
+		return `{"exception":true,"message":"unexpected call","error_code":100}`
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	return w, calls
+}
+
+func importPath(query url.Values) string {
+	return "/Shot/_import?" + query.Encode()
+}
+
+func TestImportCSVUpsert(t *testing.T) {
+	query := url.Values{}
+	query.Set("mode", "upsert")
+	query.Set("key", "code")
+	query.Set("map[Shot]", "code")
+	query.Set("map[Seq]", "sg_sequence")
+	query.Set("map[Status]", "sg_status_list")
+	query.Set("map[Notes]", "")
+	w, calls := serveImport(importPath(query), "text/csv",
+		"Shot,Seq,Status,cut_in,assets,Notes\n"+
+			"sh010,sq010,ip,1001,hero,first\n"+
+			"sh020,sq010,fin,,,\n"+
+			"sh030,sq999,ip,abc,,\n"+
+			"sh040,sq010,bad,1001,twin,\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp importResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "upsert", resp.Mode)
+	assert.Equal(t, 1, resp.Created)
+	assert.Equal(t, 1, resp.Updated)
+	assert.Equal(t, 2, resp.Failed)
+	if assert.Len(t, resp.Rows, 4) {
+		assert.Equal(t, importRowReport{Row: 2, Status: "updated", ID: 5}, resp.Rows[0])
+		assert.Equal(t, importRowReport{Row: 3, Status: "created", ID: 6}, resp.Rows[1])
+		assert.Equal(t, 4, resp.Rows[2].Row)
+		assert.Equal(t, "failed", resp.Rows[2].Status)
+		assert.Equal(t, []string{"cut_in is not a number: 'abc'"}, resp.Rows[2].Errors)
+		assert.Equal(t, []string{"sg_status_list is not one of wtg, ip, fin: 'bad'"}, resp.Rows[3].Errors)
+	}
+
+	// Links are looked up a read per type.
+	for _, read := range calls.Method("read") {
+		if read.Query["type"] == "Sequence" {
+			conditions := read.Query["filters"].(map[string]interface{})["conditions"].([]interface{})
+			assert.Equal(t, "code", conditions[0].(map[string]interface{})["path"])
+			assert.Equal(t, "in", conditions[0].(map[string]interface{})["relation"])
+		}
+	}
+
+	batches := calls.Method("batch")
+	if assert.Len(t, batches, 1) {
+		requests := batches[0].Params[1].([]interface{})
+		if assert.Len(t, requests, 2) {
+			update := requests[0].(map[string]interface{})
+			assert.Equal(t, "update", update["request_type"])
+			assert.Equal(t, float64(5), update["id"])
+			assert.Contains(t, update["fields"], map[string]interface{}{
+				"field_name": "sg_sequence",
+				"value":      map[string]interface{}{"type": "Sequence", "id": float64(3)},
+			})
+			assert.Contains(t, update["fields"], map[string]interface{}{
+				"field_name": "assets",
+				"value":      []interface{}{map[string]interface{}{"type": "Asset", "id": float64(7)}},
+			})
+			assert.Contains(t, update["fields"], map[string]interface{}{"field_name": "cut_in", "value": float64(1001)})
+			assert.Len(t, update["fields"], 5)
+			assert.Equal(t, "create", requests[1].(map[string]interface{})["request_type"])
+		}
+	}
+}
+
+func TestImportNDJSONDryRun(t *testing.T) {
+	query := url.Values{}
+	query.Set("dry_run", "true")
+	w, calls := serveImport(importPath(query), "application/x-ndjson",
+		`{"code":"sh010","assets":["hero","twin"]}`+"\n\n"+
+			`{"code":"sh020","sg_sequence":"sq010","cut_in":1001}`+"\n"+
+			`not json`+"\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp importResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.DryRun)
+	assert.Equal(t, 1, resp.Created)
+	assert.Equal(t, 2, resp.Failed)
+	if assert.Len(t, resp.Rows, 3) {
+		assert.Equal(t, []string{"More than one Asset named 'twin'"}, resp.Rows[0].Errors)
+		assert.Equal(t, importRowReport{Row: 3, Status: "created"}, resp.Rows[1])
+		assert.Equal(t, importRowReport{Row: 4, Status: "failed", Errors: []string{"Line is not a json object"}}, resp.Rows[2])
+	}
+	assert.Len(t, calls.Method("batch"), 0)
+}
+
+func TestImportUpsertDryRun(t *testing.T) {
+	query := url.Values{}
+	query.Set("mode", "upsert")
+	query.Set("key", "code")
+	query.Set("dry_run", "true")
+	w, calls := serveImport(importPath(query), "text/csv", "code,cut_in\nsh010,1001\nsh020,1002\nsh030,abc\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp importResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.DryRun)
+	assert.Equal(t, 1, resp.Created)
+	assert.Equal(t, 1, resp.Updated)
+	assert.Equal(t, 1, resp.Failed)
+	if assert.Len(t, resp.Rows, 3) {
+		assert.Equal(t, importRowReport{Row: 2, Status: "updated", ID: 5}, resp.Rows[0])
+		assert.Equal(t, importRowReport{Row: 3, Status: "created"}, resp.Rows[1])
+	}
+	assert.Len(t, calls.Method("batch"), 0)
+}
+
+func TestImportBadRequests(t *testing.T) {
+	w, _ := serveImport("/Shot/_import", "text/csv", "code,id,sg_bogus\nsh010,1,x\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Unknown or read only fields: id, sg_bogus\n", w.Body.String())
+
+	w, _ = serveImport("/Shot/_import", "application/json", `[]`)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w, _ = serveImport("/Shot/_import?mode=upsert", "text/csv", "code\nsh010\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, _ = serveImport("/Shot/_import?mode=replace", "text/csv", "code\nsh010\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestImportProject(t *testing.T) {
+	query := url.Values{}
+	query.Set("project", "70")
+	w, calls := serveImport(importPath(query), "text/csv",
+		"code,project,sg_sequence,sg_aspect\n"+
+			"sh010,,sq010,1.85\n"+
+			"sh020,demo,sq010,\n"+
+			"sh030,,,NaN\n"+
+			"sh040,,,-Inf\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp importResponse
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Created)
+	assert.Equal(t, 2, resp.Failed)
+	if assert.Len(t, resp.Rows, 4) {
+		assert.Equal(t, []string{"sg_aspect is not a number: 'NaN'"}, resp.Rows[2].Errors)
+		assert.Equal(t, []string{"sg_aspect is not a number: '-Inf'"}, resp.Rows[3].Errors)
+	}
+
+	// Sequences are looked up in the row's project, or the one in the query.
+	projects := make([]interface{}, 0)
+	for _, read := range calls.Method("read") {
+		if read.Query["type"] == "Sequence" {
+			conditions := read.Query["filters"].(map[string]interface{})["conditions"].([]interface{})
+			if assert.Len(t, conditions, 2) {
+				assert.Equal(t, "project", conditions[1].(map[string]interface{})["path"])
+				projects = append(projects, conditions[1].(map[string]interface{})["values"].([]interface{})[0].(map[string]interface{})["id"])
+			}
+		}
+	}
+	assert.ElementsMatch(t, []interface{}{float64(70), float64(71)}, projects)
+
+	w, _ = serveImport("/Shot/_import?project=abc", "text/csv", "code\nsh010\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// returnPreference is the return preference from a Prefer header,
+// 'representation', 'minimal' or "" when there isn't one.
+func returnPreference(req *http.Request) string {
+	for _, header := range req.Header["Prefer"] {
+		for _, pref := range strings.Split(header, ",") {
+			pref = strings.TrimSpace(pref)
+			if !strings.HasPrefix(pref, "return=") {
+				continue
+			}
+			value := strings.Trim(strings.TrimPrefix(pref, "return="), `"`)
+			if value == "representation" || value == "minimal" {
+				return value
+			}
+		}
+	}
+	return ""
+}
+
+// readRepresentation reads an entity that was just written.
+func readRepresentation(sg Shotgun, entityType string, entityID int, fields []string) (map[string]interface{}, error) {
+	query := newReadQuery(entityType)
+	query.ReturnFields = fields
+	query.Paging["entities_per_page"] = 1
+	query.Filters.AddCondition(newQueryCondition("id", "is", entityID))
+
+	entities, err := readEntities(sg, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(entities) == 0 {
+		return nil, fmt.Errorf("%s %d not found", entityType, entityID)
+	}
+	return entities[0], nil
+}
+
+// writeEntityResult writes the result of a create or update. With a
+// 'fields' param or 'Prefer: return=representation' the entity is read back
+// with those fields, or the ones that were written, so deep links work.
+// 'Prefer: return=minimal' leaves the body out.
+func writeEntityResult(rw http.ResponseWriter, req *http.Request, sg Shotgun, entityType string, entityID int, data map[string]interface{}, result map[string]interface{}, status int) {
+	pref := returnPreference(req)
+	if pref != "" {
+		rw.Header().Set("Preference-Applied", "return="+pref)
+	}
+
+	if pref == "minimal" {
+		if status == http.StatusOK {
+			status = http.StatusNoContent
+		}
+		rw.WriteHeader(status)
+		return
+	}
+
+	// Not FormValue, that would read a form encoded body.
+	fieldsStr := req.URL.Query().Get("fields")
+	if fieldsStr != "" || pref == "representation" {
+		fields := []string{"id"}
+		if fieldsStr != "" {
+			fields = strings.Split(fieldsStr, ",")
+		} else {
+			for fieldName := range data {
+				fields = append(fields, fieldName)
+			}
+		}
+
+		entity, err := readRepresentation(sg, entityType, entityID, fields)
+		if err == nil {
+			result = entity
+		} else {
+			// The write worked so fall back to what Shotgun returned.
+			log.Error("Could not read representation: ", err)
+		}
+	}
+
+	writeJSON(rw, status, result)
+}
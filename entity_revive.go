@@ -60,15 +60,16 @@ func entityReviveHandler(config clientConfig) func(rw http.ResponseWriter, req *
 		sgReq, err := sg.Request("revive", query)
 		if err != nil {
 			log.Errorf("Request Error: %v", err)
-			rw.WriteHeader(http.StatusInternalServerError)
+			writeShotgunError(rw, err, http.StatusInternalServerError)
 			return
 		}
+		defer sgReq.Body.Close()
 
 		var reviveResp reviveResponse
 		respBody, err := ioutil.ReadAll(sgReq.Body)
 		if err != nil {
 			log.Error(err)
-			rw.WriteHeader(http.StatusBadGateway)
+			writeShotgunError(rw, err, http.StatusBadGateway)
 			return
 		}
 
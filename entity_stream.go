@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// streamEntities writes the entities of a read response as they're decoded.
+// There's no ETag since the body isn't known until it's been sent.
+func streamEntities(rw http.ResponseWriter, body io.Reader, serializer StreamSerializerI) {
+	stream, readResp, err := openReadStream(body)
+	if err != nil {
+		log.Error(err)
+		writeShotgunError(rw, err, http.StatusBadGateway)
+		return
+	}
+	if readResp.Exception {
+		rw.WriteHeader(http.StatusInternalServerError)
+		rw.Write([]byte(readResp.Message))
+		return
+	}
+	if stream == nil {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	rw.Header().Set("Content-Type", serializer.MediaTypes()[0])
+	rw.WriteHeader(http.StatusOK)
+	if err := serializer.StreamEntities(rw, stream.Next); err != nil {
+		// The status is sent, the client gets a cut off body.
+		log.Error("Streaming entities: ", err)
+		return
+	}
+	// Read the paging info so the connection can be reused.
+	io.Copy(ioutil.Discard, body)
+}
+
+// readStream decodes a read response token by token so its entities can be
+// written out one at a time instead of holding the whole page.
+type readStream struct {
+	decoder *json.Decoder
+	first   json.RawMessage
+	done    bool
+}
+
+// openReadStream reads a response up to its first entity. When there are
+// no entities to stream, ie: an exception or an empty page, the stream is
+// nil and the response has the rest.
+func openReadStream(r io.Reader) (*readStream, readResponse, error) {
+	var readResp readResponse
+	decoder := json.NewDecoder(r)
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, readResp, err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, readResp, err
+		}
+		switch key {
+		case "results":
+			stream, err := openResults(decoder, &readResp)
+			if stream != nil || err != nil {
+				return stream, readResp, err
+			}
+		case "exception":
+			err = decoder.Decode(&readResp.Exception)
+		case "message":
+			err = decoder.Decode(&readResp.Message)
+		case "error_code":
+			err = decoder.Decode(&readResp.ErrorCode)
+		default:
+			var skip json.RawMessage
+			err = decoder.Decode(&skip)
+		}
+		if err != nil {
+			return nil, readResp, err
+		}
+	}
+	return nil, readResp, nil
+}
+
+// openResults reads the results object up to its first entity.
+func openResults(decoder *json.Decoder, readResp *readResponse) (*readStream, error) {
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		key, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "entities":
+			if err := expectDelim(decoder, '['); err != nil {
+				return nil, err
+			}
+			if decoder.More() {
+				stream := &readStream{decoder: decoder}
+				return stream, decoder.Decode(&stream.first)
+			}
+			err = expectDelim(decoder, ']')
+		case "paging_info":
+			err = decoder.Decode(&readResp.Results.PagingInfo)
+		default:
+			var skip json.RawMessage
+			err = decoder.Decode(&skip)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, expectDelim(decoder, '}')
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("Expected '%v' in read response, got '%v'", delim, token)
+	}
+	return nil
+}
+
+// Next is the next entity, nil after the last.
+func (s *readStream) Next() (json.RawMessage, error) {
+	if s.first != nil {
+		entity := s.first
+		s.first = nil
+		return entity, nil
+	}
+	if s.done {
+		return nil, nil
+	}
+	if !s.decoder.More() {
+		s.done = true
+		return nil, expectDelim(s.decoder, ']')
+	}
+	var entity json.RawMessage
+	err := s.decoder.Decode(&entity)
+	return entity, err
+}
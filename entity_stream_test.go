@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// readBody is a read response with n shots.
+func readBody(n int) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(`{"results":{"entities":[`)
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, `{"type": "Shot", "id": %d, "code": "sh%04d", "sg_status_list": "ip", "project": {"type": "Project", "id": 65, "name": "Demo"}}`, i, i*10)
+	}
+	fmt.Fprintf(&buf, `],"paging_info":{"current_page":1,"page_count":1,"entity_count":%d,"entities_per_page":%d}}}`, n, n)
+	return buf.Bytes()
+}
+
+func TestReadStream(t *testing.T) {
+	body := readBody(3)
+	var expected readResponse
+	json.Unmarshal(body, &expected)
+
+	var buf bytes.Buffer
+	stream, _, err := openReadStream(bytes.NewReader(body))
+	if assert.Nil(t, err) && assert.NotNil(t, stream) {
+		assert.Nil(t, (&JSONSerializer{}).StreamEntities(&buf, stream.Next))
+	}
+	var entities []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &entities))
+	assert.Equal(t, expected.Results.Entities, entities)
+
+	buf.Reset()
+	stream, _, _ = openReadStream(bytes.NewReader(body))
+	assert.Nil(t, (&NDJSONSerializer{}).StreamEntities(&buf, stream.Next))
+	assert.Equal(t, 3, strings.Count(buf.String(), "\n"))
+	assert.True(t, strings.HasPrefix(buf.String(), `{"type":"Shot","id":1,"code":"sh0010"`))
+}
+
+func TestReadStreamNoEntities(t *testing.T) {
+	stream, readResp, err := openReadStream(strings.NewReader(`{"results":{"entities":[],"paging_info":{"entity_count":0}}}`))
+	assert.Nil(t, err)
+	assert.Nil(t, stream)
+	assert.Equal(t, 0, readResp.Results.PagingInfo["entity_count"])
+
+	stream, readResp, err = openReadStream(strings.NewReader(`{"exception":true,"message":"API read() invalid entity type","error_code":103}`))
+	assert.Nil(t, err)
+	assert.Nil(t, stream)
+	assert.True(t, readResp.Exception)
+	assert.Equal(t, "API read() invalid entity type", readResp.Message)
+
+	_, _, err = openReadStream(strings.NewReader(`<html>Bad Gateway</html>`))
+	assert.NotNil(t, err)
+	_, _, err = openReadStream(strings.NewReader(`[]`))
+	assert.NotNil(t, err)
+}
+
+func TestFindAllStreamed(t *testing.T) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	server, _, config := mockShotgun(200, string(readBody(5)))
+	defer server.Close()
+	config.streamPageSize = 2
+
+	w := httptest.NewRecorder()
+	router(config).ServeHTTP(w, getRequest("/Shot?limit=5"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Empty(t, w.Header().Get("ETag"))
+	var entities []map[string]interface{}
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &entities))
+	assert.Len(t, entities, 5)
+
+	// Formats that can't stream are buffered.
+	w = httptest.NewRecorder()
+	router(config).ServeHTTP(w, getRequest("/Shot?limit=5&format=csv"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+
+	// So are small pages.
+	w = httptest.NewRecorder()
+	router(config).ServeHTTP(w, getRequest("/Shot?limit=1"))
+	assert.NotEmpty(t, w.Header().Get("ETag"))
+}
+
+func TestFindAllStreamedUncached(t *testing.T) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	server, _, config, calls := mockShotgunMethods(map[string]string{"read": string(readBody(5))})
+	defer server.Close()
+	config.shotgunCache, _ = newCache("memory", 100)
+
+	// Pages of the default size stream, so every read goes to Shotgun.
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router(config).ServeHTTP(w, getRequest("/Shot"))
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("ETag"))
+	}
+	assert.Len(t, calls.Method("read"), 2)
+
+	// Buffered reads are cached.
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router(config).ServeHTTP(w, getRequest("/Shot?limit=5"))
+		assert.NotEmpty(t, w.Header().Get("ETag"))
+	}
+	assert.Len(t, calls.Method("read"), 3)
+}
+
+func TestFindAllStreamedErrors(t *testing.T) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	server, _, config := mockShotgun(200, `{"exception":true,"message":"API read() invalid entity type","error_code":103}`)
+	defer server.Close()
+	config.streamPageSize = 2
+
+	w := httptest.NewRecorder()
+	router(config).ServeHTTP(w, getRequest("/Shot?limit=5"))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "API read() invalid entity type", w.Body.String())
+
+	server, _, config = mockShotgun(200, `{"results":{"entities":[],"paging_info":{"entity_count":0}}}`)
+	defer server.Close()
+	config.streamPageSize = 2
+	w = httptest.NewRecorder()
+	router(config).ServeHTTP(w, getRequest("/Shot?limit=5&format=ndjson"))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+// The buffered read holds the body, the decoded entities and the response
+// at once, the streamed read an entity at a time.
+
+func BenchmarkReadBuffered(b *testing.B) {
+	body := readBody(5000)
+	serializer := &JSONSerializer{}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		respBody, _ := ioutil.ReadAll(bytes.NewReader(body))
+		var readResp readResponse
+		if err := json.Unmarshal(respBody, &readResp); err != nil {
+			b.Fatal(err)
+		}
+		out, err := serializer.Serialize(readResp.Results.Entities, nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ioutil.Discard.Write(out)
+	}
+}
+
+func BenchmarkReadStreamed(b *testing.B) {
+	body := readBody(5000)
+	serializer := &JSONSerializer{}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(body)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stream, _, err := openReadStream(bytes.NewReader(body))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := serializer.StreamEntities(ioutil.Discard, stream.Next); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
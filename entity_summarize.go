@@ -72,6 +72,11 @@ func entitySummarizeHandler(config clientConfig) func(rw http.ResponseWriter, re
 		}
 		log.Debugf("Entity: %s", entityType)
 
+		format, serializer, ok := negotiateFormat(rw, req)
+		if !ok {
+			return
+		}
+
 		query := newSummarizeQuery(entityType)
 
 		req.ParseForm()
@@ -134,30 +139,13 @@ func entitySummarizeHandler(config clientConfig) func(rw http.ResponseWriter, re
 		}
 		sg := sgConn.(Shotgun)
 
-		sgReq, err := sg.Request("summarize", query)
+		summarizeResp, status, err := summarizeEntities(sg, query)
 		if err != nil {
 			log.Error("Request Error: ", err)
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
-		}
-
-		var summarizeResp summarizeResponse
-		respBody, err := ioutil.ReadAll(sgReq.Body)
-		if err != nil {
-			log.Error(err)
-			rw.WriteHeader(http.StatusBadGateway)
-			return
-		}
-
-		err = json.Unmarshal(respBody, &summarizeResp)
-		if err != nil {
-			log.Error(err)
-			rw.WriteHeader(http.StatusBadGateway)
+			writeShotgunError(rw, err, status)
 			return
 		}
 
-		log.Debugf("Response: %v", summarizeResp)
-
 		if summarizeResp.Exception {
 			rw.WriteHeader(http.StatusInternalServerError)
 			rw.Write([]byte(summarizeResp.Message))
@@ -169,16 +157,53 @@ func entitySummarizeHandler(config clientConfig) func(rw http.ResponseWriter, re
 		// 	return
 		// }
 
-		var jsonResp []byte
-		jsonResp, err = json.Marshal(summarizeResp.Results)
+		var body []byte
+		if format == "json" {
+			body, err = json.Marshal(summarizeResp.Results)
+		} else if summarySerializer, ok := serializer.(summarySerializer); ok {
+			body, err = summarySerializer.SerializeSummary(entityType, query.Grouping, summarizeResp.Results)
+		} else {
+			// Other formats get a row per group.
+			columns := []string{}
+			for _, group := range query.Grouping {
+				columns = append(columns, group.Field)
+			}
+			for _, summary := range query.Summaries {
+				columns = append(columns, summary.Field)
+			}
+			body, err = serializer.Serialize(flattenSummary(query.Grouping, summarizeResp.Results), columns)
+		}
 
 		if err != nil {
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
 
-		rw.Header().Set("Content-Type", "application/json")
+		rw.Header().Set("Content-Type", serializer.MediaTypes()[0])
 		rw.WriteHeader(http.StatusOK)
-		rw.Write(jsonResp)
+		rw.Write(body)
+	}
+}
+
+// summarizeEntities runs a summarize. Like createEntity the status is only
+// for when the request itself fails.
+func summarizeEntities(sg Shotgun, query summarizeQuery) (summarizeResponse, int, error) {
+	var summarizeResp summarizeResponse
+	sgReq, err := sg.Request("summarize", query)
+	if err != nil {
+		return summarizeResp, shotgunErrorStatus(err, http.StatusInternalServerError), err
+	}
+	defer sgReq.Body.Close()
+
+	respBody, err := ioutil.ReadAll(sgReq.Body)
+	if err != nil {
+		return summarizeResp, shotgunErrorStatus(err, http.StatusBadGateway), err
+	}
+
+	err = json.Unmarshal(respBody, &summarizeResp)
+	if err != nil {
+		return summarizeResp, http.StatusBadGateway, err
 	}
+	log.Debugf("Response: %v", summarizeResp)
+	return summarizeResp, http.StatusOK, nil
 }
@@ -3,7 +3,9 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
@@ -44,7 +46,6 @@ func entityUpdateHandler(config clientConfig) func(rw http.ResponseWriter, req *
 		}
 		log.Debugf("Entity: %s - %d", entityType, entityID)
 
-		var patchData map[string]interface{}
 		patchBody, err := ioutil.ReadAll(req.Body)
 		if err != nil {
 			log.Error(err)
@@ -52,30 +53,6 @@ func entityUpdateHandler(config clientConfig) func(rw http.ResponseWriter, req *
 			return
 		}
 
-		err = json.Unmarshal(patchBody, &patchData)
-		if err != nil {
-			log.Error(err)
-			rw.WriteHeader(http.StatusBadRequest)
-			return
-		}
-		log.Info("Patch Data:", patchData)
-
-		fields := make([]map[string]interface{}, len(patchData))
-		i := 0
-		for key, value := range patchData {
-			field := make(map[string]interface{})
-			field["field_name"] = key
-			field["value"] = value
-			fields[i] = field
-			i++
-		}
-
-		query := map[string]interface{}{
-			"type":   entityType,
-			"id":     entityID,
-			"fields": fields,
-		}
-
 		ctx := req.Context()
 		sgConn := ctx.Value("sgConn")
 		if sgConn == nil {
@@ -83,52 +60,147 @@ func entityUpdateHandler(config clientConfig) func(rw http.ResponseWriter, req *
 			return
 		}
 		sg := sgConn.(Shotgun)
-		sgReq, err := sg.Request("update", query)
-		if err != nil {
-			log.Error("Request Error: ", err)
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
-		}
 
-		var updateResp updateResponse
-		respBody, err := ioutil.ReadAll(sgReq.Body)
+		var patchData map[string]interface{}
+		var fields []map[string]interface{}
+		mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		switch mediaType {
+		case jsonPatchType:
+			fields, patchData, err = jsonPatchFields(sg, entityType, entityID, patchBody)
+		case mergePatchType:
+			patchData, err = mergePatchData(patchBody)
+			if err == nil {
+				fields = entityFieldValues(patchData)
+			}
+		default:
+			err = json.Unmarshal(patchBody, &patchData)
+			if err != nil {
+				log.Error(err)
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// Not FormValue, that would read a form encoded body.
+			fields, err = entityUpdateFieldValues(patchData, bracketParams(req.URL.Query(), "mode"))
+		}
 		if err != nil {
 			log.Error(err)
-			rw.WriteHeader(http.StatusBadGateway)
+			if pe, ok := err.(patchError); ok {
+				shotgunRetryAfter(rw, pe.err)
+				rw.WriteHeader(pe.StatusCode)
+			} else {
+				rw.WriteHeader(http.StatusBadRequest)
+			}
+			fmt.Fprintln(rw, err)
 			return
 		}
+		log.Info("Patch Data:", patchData)
 
-		err = json.Unmarshal(respBody, &updateResp)
+		if !checkIfMatch(rw, req, sg, entityType, entityID) {
+			return
+		}
+		updateResp, status, err := updateEntity(sg, entityType, entityID, fields)
 		if err != nil {
 			log.Error(err)
-			rw.WriteHeader(http.StatusBadGateway)
+			writeShotgunError(rw, err, status)
 			return
 		}
 
-		log.Debug("Response: ", updateResp)
-
 		if updateResp.Exception {
-			if strings.Contains(updateResp.Message, "unique") {
-				rw.WriteHeader(http.StatusConflict)
-			} else if strings.Contains(updateResp.Message, "Permission") {
-				rw.WriteHeader(http.StatusForbidden)
-			} else if strings.Contains(updateResp.Message, "does not exist") {
-				rw.WriteHeader(http.StatusNotFound)
-			} else {
-				rw.WriteHeader(http.StatusBadRequest)
-			}
+			rw.WriteHeader(updateExceptionStatus(updateResp.Message))
 			rw.Write(bytes.NewBufferString(updateResp.Message).Bytes())
 			return
 		}
 
-		jsonResp, err := json.Marshal(updateResp.Results)
-		if err != nil {
-			rw.WriteHeader(http.StatusInternalServerError)
-			return
+		writeEntityResult(rw, req, sg, entityType, entityID, patchData, updateResp.Results, http.StatusOK)
+	}
+}
+
+// multiEntityUpdateModes are how a multi-entity field can be updated, either
+// as {"field": {"$add": [...]}} or with a 'mode[field]=add' param.
+var multiEntityUpdateModes = map[string]bool{
+	"add":    true,
+	"remove": true,
+	"set":    true,
+}
+
+// entityUpdateFieldValues is entityFieldValues with multi-entity update
+// modes, modes maps field names to a mode from the query string.
+func entityUpdateFieldValues(data map[string]interface{}, modes map[string]string) ([]map[string]interface{}, error) {
+	for fieldName, mode := range modes {
+		if !multiEntityUpdateModes[mode] {
+			return nil, fmt.Errorf("Invalid update mode for %s: '%s'", fieldName, mode)
+		}
+		if _, ok := data[fieldName]; !ok {
+			return nil, fmt.Errorf("Update mode for missing field: '%s'", fieldName)
 		}
+	}
+
+	fields := entityFieldValues(data)
+	for _, field := range fields {
+		fieldName := field["field_name"].(string)
+		mode, hasMode := modes[fieldName]
+
+		if value, ok := field["value"].(map[string]interface{}); ok && len(value) == 1 {
+			for key, modeValue := range value {
+				if !strings.HasPrefix(key, "$") {
+					break
+				}
+				bodyMode := strings.TrimPrefix(key, "$")
+				if !multiEntityUpdateModes[bodyMode] {
+					return nil, fmt.Errorf("Invalid update mode for %s: '%s'", fieldName, key)
+				}
+				if hasMode && mode != bodyMode {
+					return nil, fmt.Errorf("Conflicting update modes for %s: '%s' and '%s'", fieldName, mode, bodyMode)
+				}
+				mode, hasMode = bodyMode, true
+				field["value"] = modeValue
+			}
+		}
+
+		if hasMode {
+			field["multi_entity_update_mode"] = mode
+		}
+	}
+	return fields, nil
+}
+
+// updateEntity updates an entity with fields from entityFieldValues. Like
+// createEntity the status is only for when the request itself fails.
+func updateEntity(sg Shotgun, entityType string, entityID int, fields []map[string]interface{}) (updateResponse, int, error) {
+	var updateResp updateResponse
+	query := map[string]interface{}{
+		"type":   entityType,
+		"id":     entityID,
+		"fields": fields,
+	}
+
+	sgReq, err := sg.Request("update", query)
+	if err != nil {
+		return updateResp, shotgunErrorStatus(err, http.StatusInternalServerError), err
+	}
+	defer sgReq.Body.Close()
+
+	respBody, err := ioutil.ReadAll(sgReq.Body)
+	if err != nil {
+		return updateResp, shotgunErrorStatus(err, http.StatusBadGateway), err
+	}
+
+	err = json.Unmarshal(respBody, &updateResp)
+	if err != nil {
+		return updateResp, http.StatusBadGateway, err
+	}
+	log.Debug("Response: ", updateResp)
+	return updateResp, http.StatusOK, nil
+}
 
-		rw.Header().Set("Content-Type", "application/json")
-		rw.WriteHeader(http.StatusOK)
-		rw.Write(jsonResp)
+// updateExceptionStatus maps an update exception to a status.
+func updateExceptionStatus(message string) int {
+	if strings.Contains(message, "unique") {
+		return http.StatusConflict
+	} else if strings.Contains(message, "Permission") {
+		return http.StatusForbidden
+	} else if strings.Contains(message, "does not exist") {
+		return http.StatusNotFound
 	}
+	return http.StatusBadRequest
 }
@@ -108,3 +108,135 @@ func TestUpdateBadResponseJson(t *testing.T) {
 	router(config).ServeHTTP(w, req.WithContext(ctx))
 	assert.Equal(t, http.StatusBadGateway, w.Code)
 }
+
+func TestUpdateMultiEntityModes(t *testing.T) {
+	task := map[string]interface{}{"type": "Task", "id": float64(5)}
+	tests := []struct {
+		path string
+		body string
+		mode string
+	}{
+		{"/Shot/75", `{"tasks": {"$add": [{"type":"Task","id":5}]}}`, "add"},
+		{"/Shot/75", `{"tasks": {"$remove": [{"type":"Task","id":5}]}}`, "remove"},
+		{"/Shot/75", `{"tasks": {"$set": [{"type":"Task","id":5}]}}`, "set"},
+		{"/Shot/75?mode[tasks]=add", `{"tasks": [{"type":"Task","id":5}]}`, "add"},
+		{"/Shot/75?mode[tasks]=remove", `{"tasks": [{"type":"Task","id":5}]}`, "remove"},
+		{"/Shot/75?mode[tasks]=set", `{"tasks": [{"type":"Task","id":5}]}`, "set"},
+		{"/Shot/75?mode[tasks]=add", `{"tasks": {"$add": [{"type":"Task","id":5}]}}`, "add"},
+	}
+
+	for _, test := range tests {
+		req := patchRequest(test.path, test.body)
+		w := httptest.NewRecorder()
+
+		server, client, config, calls := mockShotgunMethods(map[string]string{
+			"update": `{"results":{"id":75,"type":"Shot"}}`,
+		})
+
+		ctx := req.Context()
+		ctx = context.WithValue(ctx, "sgConn", *client)
+		router(config).ServeHTTP(w, req.WithContext(ctx))
+		server.Close()
+		assert.Equal(t, http.StatusOK, w.Code, test.path)
+
+		updates := calls.Method("update")
+		if assert.Len(t, updates, 1) {
+			assert.Equal(t, []interface{}{
+				map[string]interface{}{
+					"field_name":               "tasks",
+					"value":                    []interface{}{task},
+					"multi_entity_update_mode": test.mode,
+				},
+			}, updates[0].Query["fields"], test.body)
+		}
+	}
+}
+
+func TestUpdateWithoutMode(t *testing.T) {
+	req := patchRequest("/Shot/75", `{"tasks": [{"type":"Task","id":5}], "sg_sequence": {"type":"Sequence","id":3}}`)
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"update": `{"results":{"id":75,"type":"Shot"}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	updates := calls.Method("update")
+	if assert.Len(t, updates, 1) {
+		for _, field := range updates[0].Query["fields"].([]interface{}) {
+			assert.NotContains(t, field, "multi_entity_update_mode")
+		}
+	}
+}
+
+func TestUpdateBadMode(t *testing.T) {
+	bad := []struct {
+		path string
+		body string
+	}{
+		{"/Shot/75", `{"tasks": {"$replace": [{"type":"Task","id":5}]}}`},
+		{"/Shot/75?mode[tasks]=replace", `{"tasks": [{"type":"Task","id":5}]}`},
+		{"/Shot/75?mode[assets]=add", `{"tasks": [{"type":"Task","id":5}]}`},
+		{"/Shot/75?mode[tasks]=remove", `{"tasks": {"$add": [{"type":"Task","id":5}]}}`},
+	}
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{})
+	defer server.Close()
+
+	for _, test := range bad {
+		req := patchRequest(test.path, test.body)
+		w := httptest.NewRecorder()
+		ctx := req.Context()
+		ctx = context.WithValue(ctx, "sgConn", *client)
+		router(config).ServeHTTP(w, req.WithContext(ctx))
+		assert.Equal(t, http.StatusBadRequest, w.Code, test.path+" "+test.body)
+	}
+	assert.Empty(t, calls.All())
+}
+
+func TestUpdatePreferRepresentation(t *testing.T) {
+	req := patchRequest("/Shot/7", `{"code": "sh020"}`)
+	req.Header.Set("Prefer", "handling=strict, return=representation")
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"update": `{"results":{"id":7,"code":"sh020","type":"Shot"}}`,
+		"read":   `{"results":{"entities":[{"type":"Shot","id":7,"code":"sh020"}],"paging_info":{"current_page":1,"page_count":1,"entity_count":1,"entities_per_page":1}}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "return=representation", w.Header().Get("Preference-Applied"))
+	assert.JSONEq(t, `{"type":"Shot","id":7,"code":"sh020"}`, w.Body.String())
+
+	reads := calls.Method("read")
+	if assert.Len(t, reads, 1) {
+		assert.Equal(t, []interface{}{"id", "code"}, reads[0].Query["return_fields"])
+	}
+}
+
+func TestUpdatePreferMinimal(t *testing.T) {
+	req := patchRequest("/Shot/7?fields=code", `{"code": "sh020"}`)
+	req.Header.Set("Prefer", "return=minimal")
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"update": `{"results":{"id":7,"code":"sh020","type":"Shot"}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Empty(t, calls.Method("read"))
+}
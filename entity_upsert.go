@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// entityUpsertHandler finds an entity by the 'key' fields of the posted data
+// and updates it, or creates it when there isn't one. Two upserts racing for
+// the same key can both create.
+func entityUpsertHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling entityUpsertHandler")
+		vars := mux.Vars(req)
+		entityType, ok := vars["entity_type"]
+		if !ok {
+			log.Errorf("Missing Entity Type")
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		keyFields := splitList(req.URL.Query().Get("key"))
+		if len(keyFields) == 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, "key missing")
+			return
+		}
+
+		var upsertData map[string]interface{}
+		upsertBody, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			log.Errorf("Bad Request Body: %v", err)
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, err)
+			return
+		}
+		err = json.Unmarshal(upsertBody, &upsertData)
+		if err != nil {
+			log.Errorf("Bad Json: %v", err)
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, err)
+			return
+		}
+
+		query := newReadQuery(entityType)
+		query.Paging["entities_per_page"] = 2
+		for _, keyField := range keyFields {
+			value, ok := upsertData[keyField]
+			if !ok {
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(rw, "Key field missing from body: '%s'\n", keyField)
+				return
+			}
+			query.Filters.AddCondition(queryCondition{
+				Path:     keyField,
+				Relation: "is",
+				Values:   []interface{}{value},
+			})
+		}
+		log.Debug(query)
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+		sgReq, err := sg.Request("read", query)
+		if err != nil {
+			log.Error("Request Error: ", err)
+			writeShotgunError(rw, err, http.StatusInternalServerError)
+			return
+		}
+		defer sgReq.Body.Close()
+
+		var readResp readResponse
+		respBody, err := ioutil.ReadAll(sgReq.Body)
+		if err != nil {
+			log.Error(err)
+			writeShotgunError(rw, err, http.StatusBadGateway)
+			return
+		}
+		err = json.Unmarshal(respBody, &readResp)
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		if readResp.Exception {
+			rw.WriteHeader(updateExceptionStatus(readResp.Message))
+			rw.Write(bytes.NewBufferString(readResp.Message).Bytes())
+			return
+		}
+
+		var results map[string]interface{}
+		status := http.StatusOK
+		switch len(readResp.Results.Entities) {
+		case 0:
+			createResp, errStatus, err := createEntity(sg, entityType, upsertData)
+			if err != nil {
+				log.Error(err)
+				writeShotgunError(rw, err, errStatus)
+				return
+			}
+			if createResp.Exception {
+				rw.WriteHeader(updateExceptionStatus(createResp.Message))
+				rw.Write(bytes.NewBufferString(createResp.Message).Bytes())
+				return
+			}
+			results = createResp.Results
+			status = http.StatusCreated
+			if id, ok := results["id"].(float64); ok {
+				rw.Header().Set("Location", fmt.Sprintf("/%s/%d", entityType, int(id)))
+			}
+		case 1:
+			entityID := int(readResp.Results.Entities[0]["id"].(float64))
+			updateResp, errStatus, err := updateEntity(sg, entityType, entityID, entityFieldValues(upsertData))
+			if err != nil {
+				log.Error(err)
+				writeShotgunError(rw, err, errStatus)
+				return
+			}
+			if updateResp.Exception {
+				rw.WriteHeader(updateExceptionStatus(updateResp.Message))
+				rw.Write(bytes.NewBufferString(updateResp.Message).Bytes())
+				return
+			}
+			results = updateResp.Results
+		default:
+			rw.WriteHeader(http.StatusConflict)
+			fmt.Fprintf(rw, "More than one %s matches key: %s\n", entityType, strings.Join(keyFields, ","))
+			return
+		}
+
+		jsonResp, err := json.Marshal(results)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(status)
+		rw.Write(jsonResp)
+	}
+}
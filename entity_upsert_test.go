@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpsertCreate(t *testing.T) {
+	req := putRequest("/Shot?key=code,project",
+		`{"code":"sh010","project":{"type":"Project","id":65},"description":"New"}`)
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read":   `{"results":{"entities":[],"paging_info":{"current_page":1,"page_count":0,"entity_count":0,"entities_per_page":2}}}`,
+		"create": `{"results":{"type":"Shot","id":7,"code":"sh010"}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "/Shot/7", w.Header().Get("Location"))
+	assert.JSONEq(t, `{"type":"Shot","id":7,"code":"sh010"}`, w.Body.String())
+
+	reads := calls.Method("read")
+	if assert.Len(t, reads, 1) {
+		filters := reads[0].Query["filters"].(map[string]interface{})
+		assert.Equal(t, []interface{}{
+			map[string]interface{}{"path": "code", "relation": "is", "values": []interface{}{"sh010"}},
+			map[string]interface{}{"path": "project", "relation": "is",
+				"values": []interface{}{map[string]interface{}{"type": "Project", "id": float64(65)}}},
+		}, filters["conditions"])
+	}
+	assert.Len(t, calls.Method("create"), 1)
+	assert.Empty(t, calls.Method("update"))
+}
+
+func TestUpsertUpdate(t *testing.T) {
+	req := postRequest("/Shot/_upsert?key=code", `{"code":"sh010","description":"Changed"}`)
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read":   `{"results":{"entities":[{"type":"Shot","id":7}],"paging_info":{"current_page":1,"page_count":1,"entity_count":1,"entities_per_page":2}}}`,
+		"update": `{"results":{"type":"Shot","id":7,"code":"sh010","description":"Changed"}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"type":"Shot","id":7,"code":"sh010","description":"Changed"}`, w.Body.String())
+
+	updates := calls.Method("update")
+	if assert.Len(t, updates, 1) {
+		assert.Equal(t, float64(7), updates[0].Query["id"])
+	}
+	assert.Empty(t, calls.Method("create"))
+}
+
+func TestUpsertConflict(t *testing.T) {
+	req := putRequest("/Shot?key=code", `{"code":"sh010"}`)
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read": `{"results":{"entities":[{"type":"Shot","id":7},{"type":"Shot","id":8}],"paging_info":{"current_page":1,"page_count":1,"entity_count":2,"entities_per_page":2}}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, calls.Method("create"))
+	assert.Empty(t, calls.Method("update"))
+}
+
+func TestUpsertBadKey(t *testing.T) {
+	server, client, config, calls := mockShotgunMethods(map[string]string{})
+	defer server.Close()
+
+	for _, req := range []*http.Request{
+		putRequest("/Shot", `{"code":"sh010"}`),
+		putRequest("/Shot?key=code,project", `{"code":"sh010"}`),
+		putRequest("/Shot?key=code", `foo`),
+	} {
+		w := httptest.NewRecorder()
+		ctx := req.Context()
+		ctx = context.WithValue(ctx, "sgConn", *client)
+		router(config).ServeHTTP(w, req.WithContext(ctx))
+		assert.Equal(t, http.StatusBadRequest, w.Code, req.URL.String())
+	}
+	assert.Empty(t, calls.All())
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	log "github.com/sirupsen/logrus"
+)
+
+// eventLogPageSize is the most EventLogEntry rows read per poll.
+const eventLogPageSize = 500
+
+// eventSubscriptionBuffer is the number of batches a subscriber can fall
+// behind before it is dropped.
+const eventSubscriptionBuffer = 64
+
+var eventLogFields = []string{
+	"id", "event_type", "attribute_name", "entity", "meta", "user", "project", "created_at",
+}
+
+// Event log actions keyed by the suffix of the event type.
+// ie: Shotgun_Version_Change
+var eventLogActions = map[string]string{
+	"New":        "create",
+	"Change":     "update",
+	"Retirement": "retire",
+	"Revival":    "revive",
+}
+
+// changeEvent is an EventLogEntry about an entity.
+type changeEvent struct {
+	ID         int                    `json:"id"`
+	Action     string                 `json:"action"`
+	EntityType string                 `json:"entity_type"`
+	EntityID   int                    `json:"entity_id"`
+	Attribute  string                 `json:"attribute,omitempty"`
+	Entity     map[string]interface{} `json:"entity"`
+	Meta       map[string]interface{} `json:"meta,omitempty"`
+	User       map[string]interface{} `json:"user,omitempty"`
+	Project    map[string]interface{} `json:"project,omitempty"`
+	CreatedAt  string                 `json:"created_at,omitempty"`
+}
+
+func eventLogTypes(entityTypes []string) []interface{} {
+	eventTypes := make([]interface{}, 0, len(entityTypes)*len(eventLogActions))
+	for _, entityType := range entityTypes {
+		for suffix := range eventLogActions {
+			eventTypes = append(eventTypes, "Shotgun_"+entityType+"_"+suffix)
+		}
+	}
+	return eventTypes
+}
+
+func newChangeEvent(entry map[string]interface{}) (changeEvent, bool) {
+	eventType, _ := entry["event_type"].(string)
+	if !strings.HasPrefix(eventType, "Shotgun_") {
+		return changeEvent{}, false
+	}
+	idx := strings.LastIndex(eventType, "_")
+	action, ok := eventLogActions[eventType[idx+1:]]
+	if !ok || idx <= len("Shotgun_") {
+		return changeEvent{}, false
+	}
+
+	event := changeEvent{
+		Action:     action,
+		EntityType: eventType[len("Shotgun_"):idx],
+	}
+	if id, ok := entry["id"].(float64); ok {
+		event.ID = int(id)
+	}
+	event.Attribute, _ = entry["attribute_name"].(string)
+	event.Entity, _ = entry["entity"].(map[string]interface{})
+	event.Meta, _ = entry["meta"].(map[string]interface{})
+	event.User, _ = entry["user"].(map[string]interface{})
+	event.Project, _ = entry["project"].(map[string]interface{})
+	event.CreatedAt, _ = entry["created_at"].(string)
+
+	// The entity link is empty once an entity is retired but the meta data
+	// always has the id.
+	if id, ok := event.Meta["entity_id"].(float64); ok {
+		event.EntityID = int(id)
+	} else if id, ok := event.Entity["id"].(float64); ok {
+		event.EntityID = int(id)
+	}
+	if event.Entity == nil {
+		event.Entity = map[string]interface{}{
+			"type": event.EntityType,
+			"id":   event.EntityID,
+		}
+	}
+	return event, true
+}
+
+// readEventLog reads the change events for the entity types with an id
+// greater than afterID, oldest first. If beforeID is greater than zero only
+// events up to and including it are read.
+func readEventLog(sg Shotgun, entityTypes []string, afterID, beforeID int) ([]changeEvent, error) {
+	query := newReadQuery("EventLogEntry")
+	query.ReturnFields = eventLogFields
+	query.Paging["entities_per_page"] = eventLogPageSize
+	query.Sorts = []readSort{{FieldName: "id", Direction: "asc"}}
+	query.Filters.AddCondition(newQueryCondition("id", "greater_than", afterID))
+	if beforeID > 0 {
+		query.Filters.AddCondition(newQueryCondition("id", "less_than", beforeID+1))
+	}
+	query.Filters.AddCondition(newQueryCondition("event_type", "in", eventLogTypes(entityTypes)))
+
+	entries, err := readEntities(sg, query)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]changeEvent, 0, len(entries))
+	for _, entry := range entries {
+		if event, ok := newChangeEvent(entry); ok {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// latestEventID returns the id of the newest EventLogEntry.
+func latestEventID(sg Shotgun) (int, error) {
+	query := newReadQuery("EventLogEntry")
+	query.Paging["entities_per_page"] = 1
+	query.Sorts = []readSort{{FieldName: "id", Direction: "desc"}}
+
+	entries, err := readEntities(sg, query)
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	id, _ := entries[0]["id"].(float64)
+	return int(id), nil
+}
+
+// readEntities runs a read and returns the entities from the response.
+func readEntities(sg Shotgun, query interface{}) ([]map[string]interface{}, error) {
+	result, err := sg.Client().Find(sg.Context(), query)
+	if err != nil {
+		return nil, err
+	}
+	return result.Entities, nil
+}
+
+// filterGroup is a readFilters that can hold other groups as conditions.
+type filterGroup struct {
+	LogicalOperator string        `json:"logical_operator"`
+	Conditions      []interface{} `json:"conditions"`
+}
+
+// entityMatchQuery is a readQuery with nested filters.
+type entityMatchQuery struct {
+	readQuery
+	Filters filterGroup `json:"filters"`
+}
+
+// matchEntities reads the entities with the ids that also match the filters.
+// Retired entities are matched when retired is true.
+func matchEntities(sg Shotgun, entityType string, filters *readFilters, ids []int, fields []string, retired bool) ([]map[string]interface{}, error) {
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+
+	query := entityMatchQuery{readQuery: newReadQuery(entityType)}
+	query.Paging["entities_per_page"] = len(ids)
+	if len(fields) > 0 {
+		query.ReturnFields = fields
+	}
+	if retired {
+		query.ReturnOnly = "retired"
+	}
+	query.Filters = filterGroup{
+		LogicalOperator: "and",
+		Conditions: []interface{}{
+			newQueryCondition("id", "in", values),
+		},
+	}
+	if filters != nil {
+		query.Filters.Conditions = append(query.Filters.Conditions, *filters)
+	}
+	return readEntities(sg, query)
+}
+
+// eventSubscription receives batches of change events from a poller.
+type eventSubscription struct {
+	poller *eventPoller
+	types  map[string]bool
+	// Since is the last event id the poller had read when the subscription
+	// was made. Only events after it are sent to Events.
+	Since  int
+	Events chan []changeEvent
+}
+
+// Close stops the subscription. Events is closed once it is done.
+func (es *eventSubscription) Close() {
+	es.poller.unsubscribe(es)
+}
+
+// eventPoller tails the EventLogEntry table for one Shotgun connection and
+// fans the events out to its subscribers so they don't each poll Shotgun.
+type eventPoller struct {
+	key      string
+	sg       Shotgun
+	interval time.Duration
+
+	lock        sync.Mutex
+	lastID      int
+	subscribers map[*eventSubscription]bool
+}
+
+var eventPollers = make(map[string]*eventPoller)
+var eventPollersLock sync.Mutex
+
+// subscribeEvents subscribes to the change events for the entity types using
+// the poller for the connection key, starting the poller if needed.
+func subscribeEvents(key string, sg Shotgun, interval time.Duration, entityTypes []string) (*eventSubscription, error) {
+	// The poller outlives the request that started it.
+	sg = sg.WithContext(context.Background())
+
+	latestID := 0
+	eventPollersLock.Lock()
+	poller, ok := eventPollers[key]
+	if !ok || !poller.polls(entityTypes) {
+		// The poller's last id only moves over the types it polls, events
+		// of a new type are only new after the latest id. Reading it can be
+		// slow, so it's done without blocking every other subscriber.
+		eventPollersLock.Unlock()
+		var err error
+		latestID, err = latestEventID(sg)
+		if err != nil {
+			return nil, err
+		}
+		eventPollersLock.Lock()
+		poller, ok = eventPollers[key]
+		if !ok {
+			poller = newEventPoller(key, sg, interval, latestID)
+		}
+	}
+	defer eventPollersLock.Unlock()
+
+	sub := &eventSubscription{
+		poller: poller,
+		types:  make(map[string]bool),
+		Events: make(chan []changeEvent, eventSubscriptionBuffer),
+	}
+	for _, entityType := range entityTypes {
+		sub.types[entityType] = true
+	}
+
+	poller.lock.Lock()
+	sub.Since = poller.lastID
+	if latestID > sub.Since {
+		sub.Since = latestID
+	}
+	poller.subscribers[sub] = true
+	poller.lock.Unlock()
+
+	return sub, nil
+}
+
+// newEventPoller starts and registers a poller, eventPollersLock must be
+// held.
+func newEventPoller(key string, sg Shotgun, interval time.Duration, lastID int) *eventPoller {
+	poller := &eventPoller{
+		key:         key,
+		sg:          sg,
+		interval:    interval,
+		lastID:      lastID,
+		subscribers: make(map[*eventSubscription]bool),
+	}
+	eventPollers[key] = poller
+	go poller.run()
+	log.WithFields(logrus.Fields{
+		"last_id": lastID,
+	}).Debug("Started event poller")
+	return poller
+}
+
+func (ep *eventPoller) unsubscribe(sub *eventSubscription) {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+	if !ep.subscribers[sub] {
+		return
+	}
+	delete(ep.subscribers, sub)
+	close(sub.Events)
+}
+
+// stopIfIdle unregisters the poller when it has no subscribers left.
+func (ep *eventPoller) stopIfIdle() bool {
+	eventPollersLock.Lock()
+	defer eventPollersLock.Unlock()
+
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+	if len(ep.subscribers) > 0 {
+		return false
+	}
+	if eventPollers[ep.key] == ep {
+		delete(eventPollers, ep.key)
+	}
+	log.Debug("Stopped event poller")
+	return true
+}
+
+// polls is whether the poller already reads all the entity types.
+func (ep *eventPoller) polls(entityTypes []string) bool {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+	polled := make(map[string]bool)
+	for sub := range ep.subscribers {
+		for entityType := range sub.types {
+			polled[entityType] = true
+		}
+	}
+	for _, entityType := range entityTypes {
+		if !polled[entityType] {
+			return false
+		}
+	}
+	return true
+}
+
+func (ep *eventPoller) entityTypes() []string {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+	seen := make(map[string]bool)
+	entityTypes := make([]string, 0)
+	for sub := range ep.subscribers {
+		for entityType := range sub.types {
+			if !seen[entityType] {
+				seen[entityType] = true
+				entityTypes = append(entityTypes, entityType)
+			}
+		}
+	}
+	return entityTypes
+}
+
+func (ep *eventPoller) run() {
+	ticker := time.NewTicker(ep.interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if ep.stopIfIdle() {
+			return
+		}
+		ep.poll()
+	}
+}
+
+func (ep *eventPoller) poll() {
+	entityTypes := ep.entityTypes()
+	if len(entityTypes) == 0 {
+		return
+	}
+
+	ep.lock.Lock()
+	lastID := ep.lastID
+	ep.lock.Unlock()
+
+	events, err := readEventLog(ep.sg, entityTypes, lastID, 0)
+	if err != nil {
+		log.Error("Event poller: ", err)
+		return
+	}
+
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+	for _, event := range events {
+		if event.ID > ep.lastID {
+			ep.lastID = event.ID
+		}
+	}
+
+	for sub := range ep.subscribers {
+		batch := make([]changeEvent, 0)
+		for _, event := range events {
+			if event.ID > sub.Since && sub.types[event.EntityType] {
+				batch = append(batch, event)
+			}
+		}
+		if len(batch) == 0 {
+			continue
+		}
+		select {
+		case sub.Events <- batch:
+		default:
+			// The subscriber has fallen too far behind. Dropping it lets
+			// the client reconnect and catch up from its last event id.
+			log.Warn("Event poller: dropping slow subscriber")
+			delete(ep.subscribers, sub)
+			close(sub.Events)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// eventStreamHeartbeat is how often a comment is sent to keep idle
+// connections open through proxies.
+var eventStreamHeartbeat = 15 * time.Second
+
+// eventFilter decides which change events a client gets.
+type eventFilter struct {
+	sg          Shotgun
+	typeFilters map[string]readFilters
+	fields      []string
+}
+
+// match drops the events for entities that don't match the type's query.
+// When fields were asked for the entities are read and added to the events.
+func (ef eventFilter) match(events []changeEvent) ([]changeEvent, error) {
+	if len(ef.typeFilters) == 0 && len(ef.fields) == 0 {
+		return events, nil
+	}
+
+	type matchKey struct {
+		entityType string
+		retired    bool
+	}
+
+	ids := make(map[matchKey][]int)
+	for _, event := range events {
+		key := matchKey{event.EntityType, event.Action == "retire"}
+		ids[key] = append(ids[key], event.EntityID)
+	}
+
+	matched := make(map[matchKey]map[int]map[string]interface{})
+	for key, entityIDs := range ids {
+		var filters *readFilters
+		if typeFilters, ok := ef.typeFilters[key.entityType]; ok {
+			filters = &typeFilters
+		}
+		entities, err := matchEntities(ef.sg, key.entityType, filters, entityIDs, ef.fields, key.retired)
+		if err != nil {
+			return nil, err
+		}
+		matched[key] = make(map[int]map[string]interface{})
+		for _, entity := range entities {
+			if id, ok := entity["id"].(float64); ok {
+				matched[key][int(id)] = entity
+			}
+		}
+	}
+
+	filtered := make([]changeEvent, 0, len(events))
+	for _, event := range events {
+		key := matchKey{event.EntityType, event.Action == "retire"}
+		entity, ok := matched[key][event.EntityID]
+		if !ok {
+			continue
+		}
+		if len(ef.fields) > 0 {
+			event.Entity = entity
+		}
+		filtered = append(filtered, event)
+	}
+	return filtered, nil
+}
+
+// Handlers
+
+// eventStreamHandler pushes create/update/retire/revive events for the
+// requested entity types to the client as Server-Sent Events. Events come
+// from a poller shared by every client using the same connection.
+func eventStreamHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling eventStreamHandler")
+
+		flusher, ok := rw.(http.Flusher)
+		if !ok {
+			log.Error("Streaming not supported")
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		req.ParseForm()
+
+		entityTypes := splitList(req.FormValue("types"))
+		if len(entityTypes) == 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, "types missing")
+			return
+		}
+
+		typeFilters, err := parseTypeQueries(req, entityTypes)
+		if err != nil {
+			qpeError := err.(queryParseError)
+			log.Error("Request Error: ", qpeError)
+			rw.WriteHeader(qpeError.StatusCode)
+			return
+		}
+
+		// EventSource sends Last-Event-ID when it reconnects. The query string
+		// version is for clients that can't set headers.
+		lastEventID := 0
+		lastEventIDStr := req.Header.Get("Last-Event-ID")
+		if lastEventIDStr == "" {
+			lastEventIDStr = req.FormValue("last_event_id")
+		}
+		if lastEventIDStr != "" {
+			lastEventID, err = strconv.Atoi(lastEventIDStr)
+			if err != nil {
+				log.Errorf("Could not convert last event id '%v' to int", lastEventIDStr)
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(rw, "Could not convert last event id '%v' to int", lastEventIDStr)
+				return
+			}
+		}
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+		sgConnKey, _ := ctx.Value("sgConnKey").(string)
+
+		filter := eventFilter{
+			sg:          sg,
+			typeFilters: typeFilters,
+			fields:      splitList(req.FormValue("fields")),
+		}
+
+		sub, err := subscribeEvents(sgConnKey, sg, config.eventPollInterval, entityTypes)
+		if err != nil {
+			log.Error("Request Error: ", err)
+			rw.WriteHeader(http.StatusBadGateway)
+			rw.Write([]byte(err.Error()))
+			return
+		}
+		defer sub.Close()
+
+		rw.Header().Set("Content-Type", "text/event-stream")
+		rw.Header().Set("Cache-Control", "no-cache")
+		rw.Header().Set("Connection", "keep-alive")
+		rw.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		sent := lastEventID
+		send := func(events []changeEvent) error {
+			events, err := filter.match(events)
+			if err != nil {
+				return err
+			}
+			for _, event := range events {
+				if event.ID <= sent {
+					continue
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(rw, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Action, data)
+				sent = event.ID
+			}
+			flusher.Flush()
+			return nil
+		}
+
+		// Catch up on anything missed since the client's last event. Newer
+		// events come from the subscription.
+		for lastEventID > 0 && sent < sub.Since {
+			events, err := readEventLog(sg, entityTypes, sent, sub.Since)
+			if err != nil {
+				log.Error("Event stream: ", err)
+				return
+			}
+			if len(events) == 0 {
+				break
+			}
+			if err := send(events); err != nil {
+				log.Error("Event stream: ", err)
+				return
+			}
+			if events[len(events)-1].ID > sent {
+				sent = events[len(events)-1].ID
+			}
+			if len(events) < eventLogPageSize {
+				break
+			}
+		}
+
+		heartbeat := time.NewTicker(eventStreamHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(rw, ": ping\n\n")
+				flusher.Flush()
+			case events, ok := <-sub.Events:
+				if !ok {
+					// Dropped by the poller for falling behind. The client
+					// will reconnect with its last event id.
+					return
+				}
+				if err := send(events); err != nil {
+					log.Error("Event stream: ", err)
+				}
+			}
+		}
+	}
+}
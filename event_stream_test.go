@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeEventLog is a Shotgun server with just enough of read to serve the
+// EventLogEntry table and the entities the events point at.
+type fakeEventLog struct {
+	sync.Mutex
+	events []map[string]interface{}
+	// entities that exist, keyed by type and id. Anything missing doesn't
+	// match the query.
+	entities map[string]map[int]map[string]interface{}
+}
+
+func newFakeEventLog() *fakeEventLog {
+	return &fakeEventLog{
+		entities: make(map[string]map[int]map[string]interface{}),
+	}
+}
+
+func (fel *fakeEventLog) addEvent(id int, entityType, action string, entityID int) {
+	fel.Lock()
+	defer fel.Unlock()
+	fel.events = append(fel.events, map[string]interface{}{
+		"id":             id,
+		"event_type":     fmt.Sprintf("Shotgun_%s_%s", entityType, action),
+		"attribute_name": "sg_status_list",
+		"entity":         map[string]interface{}{"type": entityType, "id": entityID},
+		"meta":           map[string]interface{}{"entity_type": entityType, "entity_id": entityID},
+	})
+}
+
+func (fel *fakeEventLog) addEntity(entityType string, entity map[string]interface{}) {
+	fel.Lock()
+	defer fel.Unlock()
+	if _, ok := fel.entities[entityType]; !ok {
+		fel.entities[entityType] = make(map[int]map[string]interface{})
+	}
+	fel.entities[entityType][entity["id"].(int)] = entity
+}
+
+func (fel *fakeEventLog) removeEntity(entityType string, id int) {
+	fel.Lock()
+	defer fel.Unlock()
+	delete(fel.entities[entityType], id)
+}
+
+func (fel *fakeEventLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var request struct {
+		MethodName string `json:"method_name"`
+		Params     []struct {
+			Type    string `json:"type"`
+			Paging  map[string]int
+			Sorts   []readSort `json:"sorts"`
+			Filters struct {
+				Conditions []map[string]interface{} `json:"conditions"`
+			} `json:"filters"`
+		} `json:"params"`
+	}
+	json.Unmarshal(body, &request)
+	query := request.Params[1]
+
+	fel.Lock()
+	defer fel.Unlock()
+
+	entities := make([]map[string]interface{}, 0)
+	if query.Type == "EventLogEntry" {
+		for _, event := range fel.events {
+			if fel.eventMatches(event, query.Filters.Conditions) {
+				entities = append(entities, event)
+			}
+		}
+		if len(query.Sorts) > 0 && query.Sorts[0].Direction == "desc" {
+			sort.Slice(entities, func(i, j int) bool {
+				return entities[i]["id"].(int) > entities[j]["id"].(int)
+			})
+		}
+		if limit := query.Paging["entities_per_page"]; limit > 0 && len(entities) > limit {
+			entities = entities[:limit]
+		}
+	} else {
+		byID := false
+		for _, cond := range query.Filters.Conditions {
+			if cond["path"] != "id" {
+				continue
+			}
+			byID = true
+			for _, id := range cond["values"].([]interface{}) {
+				if entity, ok := fel.entities[query.Type][int(id.(float64))]; ok {
+					entities = append(entities, entity)
+				}
+			}
+		}
+		if !byID {
+			for _, entity := range fel.entities[query.Type] {
+				entities = append(entities, entity)
+			}
+		}
+	}
+
+	resp, _ := json.Marshal(map[string]interface{}{
+		"results": map[string]interface{}{"entities": entities},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+func (fel *fakeEventLog) eventMatches(event map[string]interface{}, conditions []map[string]interface{}) bool {
+	id := event["id"].(int)
+	for _, cond := range conditions {
+		values := cond["values"].([]interface{})
+		switch cond["relation"] {
+		case "greater_than":
+			if id <= int(values[0].(float64)) {
+				return false
+			}
+		case "less_than":
+			if id >= int(values[0].(float64)) {
+				return false
+			}
+		case "in":
+			found := false
+			for _, value := range values {
+				if value == event["event_type"] {
+					found = true
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  map[string]interface{}
+}
+
+// readSSE parses the event stream from the body onto a channel.
+func readSSE(resp *http.Response) chan sseEvent {
+	events := make(chan sseEvent, 100)
+	go func() {
+		defer close(events)
+		scanner := bufio.NewScanner(resp.Body)
+		var event sseEvent
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if event.ID != "" {
+					events <- event
+				}
+				event = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				event.ID = line[4:]
+			case strings.HasPrefix(line, "event: "):
+				event.Event = line[7:]
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(line[6:]), &event.Data)
+			}
+		}
+	}()
+	return events
+}
+
+func nextSSE(events chan sseEvent) (sseEvent, bool) {
+	select {
+	case event, ok := <-events:
+		return event, ok
+	case <-time.After(2 * time.Second):
+		return sseEvent{}, false
+	}
+}
+
+type EventStreamTestSuite struct {
+	suite.Suite
+	eventLog *fakeEventLog
+	sgServer *httptest.Server
+	server   *httptest.Server
+}
+
+func (suite *EventStreamTestSuite) SetupSuite() {
+	manager := GetQPManager()
+	log.Info(" -- EventStream Test Suite --\n")
+	manager.SetActiveParsers("format1", "format2", "format3")
+}
+
+func (suite *EventStreamTestSuite) SetupTest() {
+	suite.eventLog = newFakeEventLog()
+	for i := 1; i <= 5; i++ {
+		suite.eventLog.addEvent(i, "Version", "Change", i)
+	}
+	suite.sgServer = httptest.NewServer(suite.eventLog)
+
+	config := newClientConfig("0.0.0-test.1", suite.sgServer.URL)
+	config.eventPollInterval = 10 * time.Millisecond
+	suite.server = httptest.NewServer(router(config))
+}
+
+func (suite *EventStreamTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.sgServer.Close()
+}
+
+func (suite *EventStreamTestSuite) stream(path, lastEventID string) (*http.Response, chan sseEvent) {
+	req := getRequest(suite.server.URL + path)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	suite.Require().Nil(err)
+	return resp, readSSE(resp)
+}
+
+func TestEventStreamTestSuite(t *testing.T) {
+	suite.Run(t, new(EventStreamTestSuite))
+}
+
+func (suite *EventStreamTestSuite) TestStreamNewEvents() {
+	resp, events := suite.stream("/_events?types=Version", "")
+	defer resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+	suite.Equal("text/event-stream", resp.Header.Get("Content-Type"))
+
+	suite.eventLog.addEvent(6, "Task", "Change", 1)
+	suite.eventLog.addEvent(7, "Version", "New", 10)
+
+	event, ok := nextSSE(events)
+	suite.True(ok)
+	suite.Equal("7", event.ID)
+	suite.Equal("create", event.Event)
+	suite.Equal("Version", event.Data["entity_type"])
+	suite.Equal(float64(10), event.Data["entity_id"])
+}
+
+func (suite *EventStreamTestSuite) TestStreamResume() {
+	resp, events := suite.stream("/_events?types=Version", "3")
+	defer resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	event, ok := nextSSE(events)
+	suite.True(ok)
+	suite.Equal("4", event.ID)
+
+	event, ok = nextSSE(events)
+	suite.True(ok)
+	suite.Equal("5", event.ID)
+
+	suite.eventLog.addEvent(6, "Version", "Retirement", 2)
+
+	event, ok = nextSSE(events)
+	suite.True(ok)
+	suite.Equal("6", event.ID)
+	suite.Equal("retire", event.Event)
+}
+
+func (suite *EventStreamTestSuite) TestStreamQuery() {
+	suite.eventLog.addEntity("Version", map[string]interface{}{"type": "Version", "id": 11, "code": "match"})
+
+	resp, events := suite.stream(`/_events?types=Version&fields=code&q=[["code","is","match"]]`, "")
+	defer resp.Body.Close()
+	suite.Equal(http.StatusOK, resp.StatusCode)
+
+	suite.eventLog.addEvent(6, "Version", "Change", 12)
+	suite.eventLog.addEvent(7, "Version", "Change", 11)
+
+	event, ok := nextSSE(events)
+	suite.True(ok)
+	suite.Equal("7", event.ID)
+	suite.Equal("match", event.Data["entity"].(map[string]interface{})["code"])
+}
+
+func (suite *EventStreamTestSuite) TestStreamSharesPoller() {
+	resp1, events1 := suite.stream("/_events?types=Version", "")
+	defer resp1.Body.Close()
+	resp2, events2 := suite.stream("/_events?types=Version", "")
+	defer resp2.Body.Close()
+
+	key := connectionKey(suite.sgServer.URL, false, "fake-script", "fake-key")
+	eventPollersLock.Lock()
+	poller := eventPollers[key]
+	eventPollersLock.Unlock()
+	suite.Require().NotNil(poller)
+	poller.lock.Lock()
+	suite.Len(poller.subscribers, 2)
+	poller.lock.Unlock()
+
+	suite.eventLog.addEvent(6, "Version", "Change", 1)
+
+	event, ok := nextSSE(events1)
+	suite.True(ok)
+	suite.Equal("6", event.ID)
+	event, ok = nextSSE(events2)
+	suite.True(ok)
+	suite.Equal("6", event.ID)
+}
+
+func (suite *EventStreamTestSuite) TestStreamMissingTypes() {
+	req := getRequest(suite.server.URL + "/_events")
+	resp, err := http.DefaultClient.Do(req)
+	suite.Nil(err)
+	defer resp.Body.Close()
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func (suite *EventStreamTestSuite) TestStreamBadLastEventID() {
+	resp, _ := suite.stream("/_events?types=Version", "foo")
+	defer resp.Body.Close()
+	suite.Equal(http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestSubscribeEventsSlowShotgun(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		http.Error(w, "gone", http.StatusBadGateway)
+	}))
+	defer slow.Close()
+	defer close(release)
+	eventLog := newFakeEventLog()
+	eventLog.addEvent(1, "Version", "Change", 1)
+	fast := httptest.NewServer(eventLog)
+	defer fast.Close()
+
+	go subscribeEvents("slow-subscribe-test", NewShotgun(slow.URL, "fake-script", "fake-key"), time.Second, []string{"Version"})
+	time.Sleep(20 * time.Millisecond)
+
+	// Waiting on the slow Shotgun doesn't hold up other connections.
+	done := make(chan error)
+	go func() {
+		sub, err := subscribeEvents("fast-subscribe-test", NewShotgun(fast.URL, "fake-script", "fake-key"), time.Second, []string{"Version"})
+		if err == nil {
+			sub.Close()
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("subscribing waited on another connection's Shotgun")
+	}
+}
+
+func TestSubscribeEventsNewType(t *testing.T) {
+	eventLog := newFakeEventLog()
+	eventLog.addEvent(1, "Version", "Change", 1)
+	server := httptest.NewServer(eventLog)
+	defer server.Close()
+	sg := NewShotgun(server.URL, "fake-script", "fake-key")
+
+	versions, err := subscribeEvents("new-type-test", sg, 10*time.Millisecond, []string{"Version"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer versions.Close()
+
+	// The poller only reads Version, so its last id doesn't move past this.
+	eventLog.addEvent(2, "Shot", "Change", 1)
+	time.Sleep(30 * time.Millisecond)
+
+	shots, err := subscribeEvents("new-type-test", sg, 10*time.Millisecond, []string{"Shot"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shots.Close()
+	if shots.Since != 2 {
+		t.Fatalf("subscribed since %d, not the latest event 2", shots.Since)
+	}
+
+	eventLog.addEvent(3, "Shot", "Change", 1)
+	select {
+	case batch := <-shots.Events:
+		if len(batch) != 1 || batch[0].ID != 3 {
+			t.Fatalf("got %v, not just event 3", batch)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no events for the new type")
+	}
+}
@@ -0,0 +1,764 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	log "github.com/sirupsen/logrus"
+)
+
+// graphqlSchemaHolder keeps the GraphQL schema built from the Shotgun schema
+// with the script connection, so every user gets the same schema whatever
+// they can read. It is built at startup and once it is older than Refresh it
+// is rebuilt in the background while the old one is served.
+type graphqlSchemaHolder struct {
+	// sg is the script connection, GraphQL is off while it is nil.
+	sg      *Shotgun
+	Refresh time.Duration
+
+	lock       sync.Mutex
+	schema     *graphql.Schema
+	sgSchema   map[string]map[string]schemaField
+	loadedAt   time.Time
+	refreshing bool
+}
+
+func newGraphQLSchemaHolder(refresh time.Duration) *graphqlSchemaHolder {
+	return &graphqlSchemaHolder{Refresh: refresh}
+}
+
+// Load builds the schema with sg.
+func (h *graphqlSchemaHolder) Load(sg Shotgun) error {
+	sgSchema, err := readSchema(sg)
+	if err != nil {
+		return err
+	}
+	schema, err := newGraphQLSchema(sgSchema)
+	if err != nil {
+		return err
+	}
+
+	h.lock.Lock()
+	h.schema = &schema
+	h.sgSchema = sgSchema
+	h.loadedAt = time.Now()
+	h.lock.Unlock()
+	log.Infof("GraphQL schema loaded with %d entity types", len(sgSchema))
+	return nil
+}
+
+// Get returns the schema and the Shotgun schema it was built from, loading
+// them with the script connection if they haven't been yet.
+func (h *graphqlSchemaHolder) Get() (*graphql.Schema, map[string]map[string]schemaField, error) {
+	if h.sg == nil {
+		return nil, nil, errors.New("GraphQL needs script credentials")
+	}
+	h.lock.Lock()
+	schema, sgSchema := h.schema, h.sgSchema
+	stale := schema != nil && h.Refresh > 0 && time.Since(h.loadedAt) > h.Refresh && !h.refreshing
+	if stale {
+		h.refreshing = true
+	}
+	h.lock.Unlock()
+
+	if schema == nil {
+		if err := h.Load(*h.sg); err != nil {
+			return nil, nil, err
+		}
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		return h.schema, h.sgSchema, nil
+	}
+
+	if stale {
+		sg := h.sg.WithContext(context.Background())
+		go func() {
+			if err := h.Load(sg); err != nil {
+				log.Error("GraphQL Schema Error: ", err)
+			}
+			h.lock.Lock()
+			h.refreshing = false
+			h.lock.Unlock()
+		}()
+	}
+	return schema, sgSchema, nil
+}
+
+// graphqlDepth is how deeply the operations in doc nest their fields,
+// through fragments too. Introspection fields don't read from Shotgun and
+// aren't counted.
+func graphqlDepth(doc *ast.Document) int {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, definition := range doc.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	visiting := make(map[string]bool)
+	var depth func(set *ast.SelectionSet) int
+	depth = func(set *ast.SelectionSet) int {
+		deepest := 0
+		if set == nil {
+			return deepest
+		}
+		for _, selection := range set.Selections {
+			selectionDepth := 0
+			switch selection := selection.(type) {
+			case *ast.Field:
+				if strings.HasPrefix(selection.Name.Value, "__") {
+					continue
+				}
+				selectionDepth = 1 + depth(selection.SelectionSet)
+			case *ast.InlineFragment:
+				selectionDepth = depth(selection.SelectionSet)
+			case *ast.FragmentSpread:
+				// Fragment cycles are left to validation.
+				name := selection.Name.Value
+				if fragment, ok := fragments[name]; ok && !visiting[name] {
+					visiting[name] = true
+					selectionDepth = depth(fragment.SelectionSet)
+					delete(visiting, name)
+				}
+			}
+			if selectionDepth > deepest {
+				deepest = selectionDepth
+			}
+		}
+		return deepest
+	}
+
+	deepest := 0
+	for _, definition := range doc.Definitions {
+		if operation, ok := definition.(*ast.OperationDefinition); ok {
+			if operationDepth := depth(operation.SelectionSet); operationDepth > deepest {
+				deepest = operationDepth
+			}
+		}
+	}
+	return deepest
+}
+
+// graphqlNameRegexp matches the names GraphQL allows.
+var graphqlNameRegexp = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+
+// graphqlJSON passes json values through as they are, it is used for
+// fields without a better type and for mutation data.
+var graphqlJSON = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "Any json value.",
+	Serialize: func(value interface{}) interface{} {
+		return value
+	},
+	ParseValue: func(value interface{}) interface{} {
+		return value
+	},
+	ParseLiteral: graphqlLiteral,
+})
+
+// graphqlLiteral turns a literal from a query into its json value.
+func graphqlLiteral(value ast.Value) interface{} {
+	switch value := value.(type) {
+	case *ast.ObjectValue:
+		object := make(map[string]interface{})
+		for _, field := range value.Fields {
+			object[field.Name.Value] = graphqlLiteral(field.Value)
+		}
+		return object
+	case *ast.ListValue:
+		list := make([]interface{}, len(value.Values))
+		for i, item := range value.Values {
+			list[i] = graphqlLiteral(item)
+		}
+		return list
+	case *ast.IntValue:
+		number, _ := strconv.ParseFloat(value.Value, 64)
+		return number
+	case *ast.FloatValue:
+		number, _ := strconv.ParseFloat(value.Value, 64)
+		return number
+	case *ast.BooleanValue:
+		return value.Value
+	case *ast.StringValue:
+		return value.Value
+	case *ast.EnumValue:
+		return value.Value
+	}
+	return nil
+}
+
+// graphqlScalars are the GraphQL types of Shotgun's data types, the rest are
+// JSON.
+var graphqlScalars = map[string]graphql.Output{
+	"checkbox":    graphql.Boolean,
+	"color":       graphql.String,
+	"currency":    graphql.Float,
+	"date":        graphql.String,
+	"date_time":   graphql.String,
+	"duration":    graphql.Int,
+	"entity_type": graphql.String,
+	"float":       graphql.Float,
+	"list":        graphql.String,
+	"number":      graphql.Int,
+	"percent":     graphql.Int,
+	"status_list": graphql.String,
+	"text":        graphql.String,
+	"timecode":    graphql.Int,
+	"uuid":        graphql.String,
+}
+
+// graphqlBuilder builds a GraphQL schema from the Shotgun schema.
+type graphqlBuilder struct {
+	sgSchema map[string]map[string]schemaField
+	objects  map[string]*graphql.Object
+	entity   *graphql.Interface
+}
+
+// newGraphQLSchema makes a type per entity type with a query to list them
+// and create, update, delete and revive mutations.
+func newGraphQLSchema(sgSchema map[string]map[string]schemaField) (graphql.Schema, error) {
+	b := &graphqlBuilder{sgSchema: sgSchema, objects: make(map[string]*graphql.Object)}
+	b.entity = graphql.NewInterface(graphql.InterfaceConfig{
+		Name:        "Entity",
+		Description: "A linked entity that can be one of several types.",
+		Fields: graphql.Fields{
+			"type": &graphql.Field{Type: graphql.String},
+			"id":   &graphql.Field{Type: graphql.Int},
+		},
+		ResolveType: func(p graphql.ResolveTypeParams) *graphql.Object {
+			if entity, ok := p.Value.(map[string]interface{}); ok {
+				if entityType, ok := entity["type"].(string); ok {
+					return b.objects[entityType]
+				}
+			}
+			return nil
+		},
+	})
+
+	entityTypes := make([]string, 0, len(sgSchema))
+	for entityType := range sgSchema {
+		if graphqlNameRegexp.MatchString(entityType) && !strings.HasPrefix(entityType, "__") {
+			entityTypes = append(entityTypes, entityType)
+		}
+	}
+	sort.Strings(entityTypes)
+
+	for _, entityType := range entityTypes {
+		b.objects[entityType] = graphql.NewObject(graphql.ObjectConfig{
+			Name:       entityType,
+			Interfaces: []*graphql.Interface{b.entity},
+			Fields:     b.objectFields(entityType),
+		})
+	}
+
+	queries := graphql.Fields{}
+	mutations := graphql.Fields{}
+	for _, entityType := range entityTypes {
+		object := b.objects[entityType]
+		queries[entityType] = &graphql.Field{
+			Type:        graphql.NewList(object),
+			Description: fmt.Sprintf("List %s entities.", entityType),
+			Args: graphql.FieldConfigArgument{
+				"id":    &graphql.ArgumentConfig{Type: graphql.Int},
+				"q":     &graphql.ArgumentConfig{Type: graphql.String, Description: "A query in any of the query formats."},
+				"sort":  &graphql.ArgumentConfig{Type: graphql.String, Description: "Fields to sort by, '-' sorts descending."},
+				"limit": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 50},
+				"page":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 1},
+			},
+			Resolve: b.listResolver(entityType),
+		}
+		mutations["create_"+entityType] = &graphql.Field{
+			Type: object,
+			Args: graphql.FieldConfigArgument{
+				"data": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphqlJSON)},
+			},
+			Resolve: b.createResolver(entityType),
+		}
+		mutations["update_"+entityType] = &graphql.Field{
+			Type: object,
+			Args: graphql.FieldConfigArgument{
+				"id":   &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+				"data": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphqlJSON)},
+			},
+			Resolve: b.updateResolver(entityType),
+		}
+		mutations["delete_"+entityType] = &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			},
+			Resolve: b.requestResolver("delete", entityType),
+		}
+		mutations["revive_"+entityType] = &graphql.Field{
+			Type: graphql.Boolean,
+			Args: graphql.FieldConfigArgument{
+				"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+			},
+			Resolve: b.requestResolver("revive", entityType),
+		}
+	}
+	if len(queries) == 0 {
+		return graphql.Schema{}, errors.New("Schema has no entity types")
+	}
+
+	types := make([]graphql.Type, 0, len(b.objects))
+	for _, entityType := range entityTypes {
+		types = append(types, b.objects[entityType])
+	}
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query:    graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: queries}),
+		Mutation: graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutations}),
+		Types:    types,
+	})
+}
+
+// objectFields are the fields of an entity type. They are a thunk so types
+// can link to each other.
+func (b *graphqlBuilder) objectFields(entityType string) graphql.FieldsThunk {
+	return func() graphql.Fields {
+		fields := graphql.Fields{
+			"type": &graphql.Field{Type: graphql.String},
+			"id":   &graphql.Field{Type: graphql.Int},
+		}
+		for fieldName, field := range b.sgSchema[entityType] {
+			if !graphqlNameRegexp.MatchString(fieldName) || strings.HasPrefix(fieldName, "__") || fieldName == "type" || fieldName == "id" {
+				continue
+			}
+			switch field.DataType {
+			case "entity":
+				fields[fieldName] = &graphql.Field{Type: b.linkType(field), Resolve: b.linkResolver(fieldName)}
+			case "multi_entity":
+				fields[fieldName] = &graphql.Field{Type: graphql.NewList(b.linkType(field)), Resolve: b.linkResolver(fieldName)}
+			default:
+				output, ok := graphqlScalars[field.DataType]
+				if !ok {
+					output = graphqlJSON
+				}
+				fields[fieldName] = &graphql.Field{Type: output}
+			}
+		}
+		return fields
+	}
+}
+
+// linkType is the type of a link field, the Entity interface unless it can
+// only link to one type.
+func (b *graphqlBuilder) linkType(field schemaField) graphql.Output {
+	if len(field.ValidTypes) == 1 {
+		if object, ok := b.objects[field.ValidTypes[0]]; ok {
+			return object
+		}
+	}
+	return b.entity
+}
+
+// graphqlSelection lists the fields selected under the field being
+// resolved, including those in fragments.
+func graphqlSelection(info graphql.ResolveInfo) []string {
+	seen := make(map[string]bool)
+	var walk func(selectionSet *ast.SelectionSet)
+	walk = func(selectionSet *ast.SelectionSet) {
+		if selectionSet == nil {
+			return
+		}
+		for _, selection := range selectionSet.Selections {
+			switch selection := selection.(type) {
+			case *ast.Field:
+				if !strings.HasPrefix(selection.Name.Value, "__") {
+					seen[selection.Name.Value] = true
+				}
+			case *ast.InlineFragment:
+				walk(selection.SelectionSet)
+			case *ast.FragmentSpread:
+				if fragment, ok := info.Fragments[selection.Name.Value].(*ast.FragmentDefinition); ok {
+					walk(fragment.SelectionSet)
+				}
+			}
+		}
+	}
+	for _, field := range info.FieldASTs {
+		walk(field.SelectionSet)
+	}
+
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// returnFields is the selected fields that entityType has, always with id.
+func (b *graphqlBuilder) returnFields(entityType string, selected []string) []string {
+	fields := []string{"id"}
+	for _, field := range selected {
+		if _, ok := b.sgSchema[entityType][field]; ok && field != "id" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// graphqlConn is the connection from the request.
+func graphqlConn(p graphql.ResolveParams) (Shotgun, error) {
+	sg, ok := p.Context.Value("sgConn").(Shotgun)
+	if !ok {
+		return sg, errors.New("No Shotgun connection")
+	}
+	return sg, nil
+}
+
+func (b *graphqlBuilder) listResolver(entityType string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		sg, err := graphqlConn(p)
+		if err != nil {
+			return nil, err
+		}
+
+		query := newReadQuery(entityType)
+		query.ReturnFields = b.returnFields(entityType, graphqlSelection(p.Info))
+		if q, ok := p.Args["q"].(string); ok && q != "" {
+			filters, err := parseQuery(q)
+			if err != nil {
+				return nil, err
+			}
+			query.Filters = filters
+		}
+		if id, ok := p.Args["id"].(int); ok {
+			query.Filters.AddCondition(newQueryCondition("id", "is", id))
+		}
+		if sortStr, ok := p.Args["sort"].(string); ok {
+			for _, field := range splitList(sortStr) {
+				direction := "asc"
+				if strings.HasPrefix(field, "-") {
+					field, direction = field[1:], "desc"
+				}
+				query.Sorts = append(query.Sorts, readSort{FieldName: field, Direction: direction})
+			}
+		}
+		if limit, ok := p.Args["limit"].(int); ok && limit > 0 && limit < 500 {
+			query.Paging["entities_per_page"] = limit
+		}
+		if page, ok := p.Args["page"].(int); ok && page > 0 {
+			query.Paging["current_page"] = page
+		}
+		return readEntities(sg, query)
+	}
+}
+
+// linkResolver resolves a link through the request's loader so links to the
+// same type are read together.
+func (b *graphqlBuilder) linkResolver(fieldName string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		source, ok := p.Source.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		loader, ok := p.Context.Value(graphqlLoaderKey).(*graphqlLoader)
+		if !ok {
+			return source[fieldName], nil
+		}
+		selected := graphqlSelection(p.Info)
+
+		switch value := source[fieldName].(type) {
+		case map[string]interface{}:
+			loader.add(value, selected)
+			return func() (interface{}, error) {
+				return loader.get(value)
+			}, nil
+		case []interface{}:
+			for _, item := range value {
+				if link, ok := item.(map[string]interface{}); ok {
+					loader.add(link, selected)
+				}
+			}
+			return func() (interface{}, error) {
+				entities := make([]interface{}, 0, len(value))
+				for _, item := range value {
+					link, ok := item.(map[string]interface{})
+					if !ok {
+						continue
+					}
+					entity, err := loader.get(link)
+					if err != nil {
+						return nil, err
+					}
+					entities = append(entities, entity)
+				}
+				return entities, nil
+			}, nil
+		}
+		return nil, nil
+	}
+}
+
+func (b *graphqlBuilder) createResolver(entityType string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		sg, err := graphqlConn(p)
+		if err != nil {
+			return nil, err
+		}
+		data, ok := p.Args["data"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("data must be an object")
+		}
+
+		createResp, _, err := createEntity(sg, entityType, data)
+		if err != nil {
+			return nil, err
+		}
+		if createResp.Exception {
+			return nil, errors.New(createResp.Message)
+		}
+		id, _ := createResp.Results["id"].(float64)
+		return readRepresentation(sg, entityType, int(id), b.returnFields(entityType, graphqlSelection(p.Info)))
+	}
+}
+
+func (b *graphqlBuilder) updateResolver(entityType string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		sg, err := graphqlConn(p)
+		if err != nil {
+			return nil, err
+		}
+		id, _ := p.Args["id"].(int)
+		data, ok := p.Args["data"].(map[string]interface{})
+		if !ok {
+			return nil, errors.New("data must be an object")
+		}
+
+		fields, err := entityUpdateFieldValues(data, nil)
+		if err != nil {
+			return nil, err
+		}
+		updateResp, _, err := updateEntity(sg, entityType, id, fields)
+		if err != nil {
+			return nil, err
+		}
+		if updateResp.Exception {
+			return nil, errors.New(updateResp.Message)
+		}
+		return readRepresentation(sg, entityType, id, b.returnFields(entityType, graphqlSelection(p.Info)))
+	}
+}
+
+// requestResolver resolves delete and revive, which take a type and id and
+// return true.
+func (b *graphqlBuilder) requestResolver(method string, entityType string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		sg, err := graphqlConn(p)
+		if err != nil {
+			return nil, err
+		}
+		id, _ := p.Args["id"].(int)
+
+		return entityIDRequest(sg, method, entityType, id)
+	}
+}
+
+type graphqlContextKey string
+
+const graphqlLoaderKey graphqlContextKey = "graphqlLoader"
+
+// graphqlLoader batches the reads of linked entities. Links are added as
+// they are resolved and read a type at a time when the first is needed,
+// which is after every link at that depth has been added.
+type graphqlLoader struct {
+	sg       Shotgun
+	sgSchema map[string]map[string]schemaField
+	// maxLinks caps the linked entities a query can read, 0 is no limit.
+	maxLinks int
+
+	lock     sync.Mutex
+	read     int
+	pending  map[string]map[int]bool
+	fields   map[string]map[string]bool
+	entities map[string]map[string]interface{}
+	errs     map[string]error
+}
+
+func newGraphQLLoader(sg Shotgun, sgSchema map[string]map[string]schemaField, maxLinks int) *graphqlLoader {
+	return &graphqlLoader{
+		sg:       sg,
+		sgSchema: sgSchema,
+		maxLinks: maxLinks,
+		pending:  make(map[string]map[int]bool),
+		fields:   make(map[string]map[string]bool),
+		entities: make(map[string]map[string]interface{}),
+		errs:     make(map[string]error),
+	}
+}
+
+// add queues a link to be read with the selected fields. Links that already
+// have every field, like type, id and name, aren't read.
+func (l *graphqlLoader) add(link map[string]interface{}, selected []string) {
+	entityType, _ := link["type"].(string)
+	id, ok := link["id"].(float64)
+	if !ok {
+		return
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	missing := false
+	for _, field := range selected {
+		if _, has := link[field]; has {
+			continue
+		}
+		if _, exists := l.sgSchema[entityType][field]; !exists {
+			continue
+		}
+		missing = true
+		if l.fields[entityType] == nil {
+			l.fields[entityType] = map[string]bool{"id": true}
+		}
+		l.fields[entityType][field] = true
+	}
+	if missing {
+		if l.pending[entityType] == nil {
+			l.pending[entityType] = make(map[int]bool)
+		}
+		l.pending[entityType][int(id)] = true
+	}
+}
+
+// get returns the linked entity, reading every pending link first.
+func (l *graphqlLoader) get(link map[string]interface{}) (interface{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	for entityType, ids := range l.pending {
+		delete(l.pending, entityType)
+		if l.maxLinks > 0 && l.read+len(ids) > l.maxLinks {
+			l.errs[entityType] = fmt.Errorf("Query links more than the limit of %d entities", l.maxLinks)
+			continue
+		}
+		l.read += len(ids)
+
+		values := make([]interface{}, 0, len(ids))
+		for id := range ids {
+			values = append(values, id)
+		}
+		fields := make([]string, 0, len(l.fields[entityType]))
+		for field := range l.fields[entityType] {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		filters := newReadFilters()
+		filters.AddCondition(newQueryCondition("id", "in", values))
+		entities, err := readAllEntities(l.sg, entityType, &filters, fields)
+		if err != nil {
+			l.errs[entityType] = err
+		}
+		for _, entity := range entities {
+			if key, ok := entityKey(entity); ok {
+				l.entities[key] = entity
+			}
+		}
+	}
+
+	entityType, _ := link["type"].(string)
+	if err := l.errs[entityType]; err != nil {
+		return nil, err
+	}
+	key, _ := entityKey(link)
+	entity, ok := l.entities[key]
+	if !ok {
+		return link, nil
+	}
+	// Keep the name from the link, the read may not have it.
+	merged := make(map[string]interface{})
+	for field, value := range link {
+		merged[field] = value
+	}
+	for field, value := range entity {
+		merged[field] = value
+	}
+	return merged, nil
+}
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Handlers
+
+// graphqlHandler runs GraphQL queries and mutations against the schema
+// built from Shotgun's.
+func graphqlHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling graphqlHandler")
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var gqlReq graphqlRequest
+		err = json.Unmarshal(body, &gqlReq)
+		if err != nil || gqlReq.Query == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, "Body must be a json object with a query")
+			return
+		}
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+
+		if config.graphql == nil || config.graphql.sg == nil {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(rw, "GraphQL needs --script-name and --script-key")
+			return
+		}
+
+		// Parse errors are left to graphql.Do to report.
+		doc, err := parser.Parse(parser.ParseParams{Source: gqlReq.Query})
+		if err == nil && config.graphqlMaxDepth > 0 {
+			if depth := graphqlDepth(doc); depth > config.graphqlMaxDepth {
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(rw, "Query is nested %d deep, more than the limit of %d\n", depth, config.graphqlMaxDepth)
+				return
+			}
+		}
+
+		schema, sgSchema, err := config.graphql.Get()
+		if err != nil {
+			log.Error("GraphQL Schema Error: ", err)
+			shotgunRetryAfter(rw, err)
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(rw, err)
+			return
+		}
+
+		result := graphql.Do(graphql.Params{
+			Schema:         *schema,
+			RequestString:  gqlReq.Query,
+			VariableValues: gqlReq.Variables,
+			OperationName:  gqlReq.OperationName,
+			Context:        context.WithValue(ctx, graphqlLoaderKey, newGraphQLLoader(sg, sgSchema, config.graphqlMaxLinks)),
+		})
+		writeJSON(rw, http.StatusOK, result)
+	}
+}
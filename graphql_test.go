@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const graphqlSchemaRead = `{"results":{
+	"Shot":{
+		"id":{"data_type":{"value":"number"},"editable":{"value":false},"properties":{}},
+		"code":{"data_type":{"value":"text"},"editable":{"value":true},"properties":{}},
+		"cut_in":{"data_type":{"value":"number"},"editable":{"value":true},"properties":{}},
+		"sg_sequence":{"data_type":{"value":"entity"},"editable":{"value":true},"properties":{"valid_types":{"value":["Sequence"]}}},
+		"entity_links":{"data_type":{"value":"multi_entity"},"editable":{"value":true},"properties":{"valid_types":{"value":["Sequence","Asset"]}}},
+		"image":{"data_type":{"value":"image"},"editable":{"value":true},"properties":{}}
+	},
+	"Sequence":{
+		"id":{"data_type":{"value":"number"},"editable":{"value":false},"properties":{}},
+		"code":{"data_type":{"value":"text"},"editable":{"value":true},"properties":{}},
+		"description":{"data_type":{"value":"text"},"editable":{"value":true},"properties":{}}
+	},
+	"Asset":{
+		"id":{"data_type":{"value":"number"},"editable":{"value":false},"properties":{}},
+		"code":{"data_type":{"value":"text"},"editable":{"value":true},"properties":{}}
+	}
+}}`
+
+// serveGraphQL posts a query, reads return Shots 1 and 2 in sequences 3 and
+// 4 or the linked entities.
+func serveGraphQL(query string) (*httptest.ResponseRecorder, *shotgunCalls) {
+	return serveGraphQLWith(query, func(config *clientConfig) {})
+}
+
+// serveGraphQLWith is serveGraphQL with a config changed by configure, the
+// schema is loaded with the request's connection as the script's.
+func serveGraphQLWith(query string, configure func(config *clientConfig)) (*httptest.ResponseRecorder, *shotgunCalls) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	body, _ := json.Marshal(map[string]interface{}{"query": query})
+	req := postRequest("/graphql", string(body))
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunFunc(func(call shotgunCall) string {
+		switch call.Method {
+		case "schema_read":
+			return graphqlSchemaRead
+		case "read":
+			switch call.Query["type"] {
+			case "Shot":
+				return `{"results":{"entities":[
+					{"type":"Shot","id":1,"code":"sh010","sg_sequence":{"type":"Sequence","id":3,"name":"sq010"},"entity_links":[{"type":"Asset","id":7,"name":"hero"},{"type":"Sequence","id":4,"name":"sq020"}]},
+					{"type":"Shot","id":2,"code":"sh020","sg_sequence":{"type":"Sequence","id":4,"name":"sq020"},"entity_links":[]}
+				],"paging_info":{"entity_count":2}}}`
+			case "Sequence":
+				return `{"results":{"entities":[{"type":"Sequence","id":3,"description":"Opening"},{"type":"Sequence","id":4,"description":"Chase"}],"paging_info":{"entity_count":2}}}`
+			}
+		case "create":
+			return `{"results":{"type":"Shot","id":1}}`
+		case "delete":
+			return `{"results":true}`
+		}
+		return `{"exception":true,"message":"unexpected call","error_code":100}`
+	})
+	defer server.Close()
+
+	config.graphql = newGraphQLSchemaHolder(time.Minute)
+	config.graphql.sg = client
+	configure(&config)
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	return w, calls
+}
+
+func TestGraphQLQuery(t *testing.T) {
+	w, calls := serveGraphQL(`{
+		Shot(q: "[[\"code\",\"starts_with\",\"sh\"]]", sort: "-code", limit: 2) {
+			id
+			code
+			sg_sequence { id code description }
+			entity_links { type id ... on Sequence { description } }
+		}
+	}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":{"Shot":[
+		{"id":1,"code":"sh010","sg_sequence":{"id":3,"code":null,"description":"Opening"},"entity_links":[{"type":"Asset","id":7},{"type":"Sequence","id":4,"description":"Chase"}]},
+		{"id":2,"code":"sh020","sg_sequence":{"id":4,"code":null,"description":"Chase"},"entity_links":[]}
+	]}}`, w.Body.String())
+
+	reads := calls.Method("read")
+	if assert.Len(t, reads, 2) {
+		shots := reads[0].Query
+		assert.Equal(t, "Shot", shots["type"])
+		assert.Equal(t, []interface{}{"id", "code", "entity_links", "sg_sequence"}, shots["return_fields"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"field_name": "code", "direction": "desc"}}, shots["sorts"])
+		assert.Equal(t, float64(2), shots["paging"].(map[string]interface{})["entities_per_page"])
+		conditions := shots["filters"].(map[string]interface{})["conditions"].([]interface{})
+		assert.Equal(t, "starts_with", conditions[0].(map[string]interface{})["relation"])
+
+		// Every linked sequence in one read.
+		sequences := reads[1].Query
+		assert.Equal(t, "Sequence", sequences["type"])
+		assert.Equal(t, []interface{}{"code", "description", "id"}, sequences["return_fields"])
+		conditions = sequences["filters"].(map[string]interface{})["conditions"].([]interface{})
+		assert.ElementsMatch(t, []interface{}{float64(3), float64(4)}, conditions[0].(map[string]interface{})["values"])
+	}
+}
+
+func TestGraphQLLinkNamesOnly(t *testing.T) {
+	w, calls := serveGraphQL(`{ Shot { sg_sequence { type id } } }`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"sg_sequence":{"id":3,"type":"Sequence"}`)
+	assert.Len(t, calls.Method("read"), 1)
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	w, calls := serveGraphQL(`mutation { create_Shot(data: {code: "sh010", cut_in: 1001}) { id code } }`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":{"create_Shot":{"id":1,"code":"sh010"}}}`, w.Body.String())
+	creates := calls.Method("create")
+	if assert.Len(t, creates, 1) {
+		assert.Equal(t, "Shot", creates[0].Query["type"])
+		assert.ElementsMatch(t, []interface{}{
+			map[string]interface{}{"field_name": "code", "value": "sh010"},
+			map[string]interface{}{"field_name": "cut_in", "value": float64(1001)},
+		}, creates[0].Query["fields"])
+	}
+
+	w, calls = serveGraphQL(`mutation { delete_Shot(id: 1) }`)
+	assert.JSONEq(t, `{"data":{"delete_Shot":true}}`, w.Body.String())
+	assert.Equal(t, map[string]interface{}{"type": "Shot", "id": float64(1)}, calls.Method("delete")[0].Query)
+
+	w, _ = serveGraphQL(`mutation { update_Shot(id: 1, data: {code: "x"}) { id } }`)
+	assert.Contains(t, w.Body.String(), "unexpected call")
+}
+
+func TestGraphQLBadRequest(t *testing.T) {
+	req := postRequest("/graphql", `{}`)
+	w := httptest.NewRecorder()
+	server, client, config, _ := mockShotgunMethods(map[string]string{})
+	defer server.Close()
+	ctx := context.WithValue(req.Context(), "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, _ = serveGraphQL(`{ Nope { id } }`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `Cannot query field \"Nope\"`)
+}
+
+func TestGraphQLNeedsScript(t *testing.T) {
+	w, calls := serveGraphQLWith(`{ Shot { id } }`, func(config *clientConfig) {
+		config.graphql.sg = nil
+	})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "GraphQL needs --script-name and --script-key\n", w.Body.String())
+	assert.Len(t, calls.All(), 0)
+}
+
+func TestGraphQLMaxDepth(t *testing.T) {
+	limit := func(config *clientConfig) {
+		config.graphqlMaxDepth = 2
+	}
+	w, calls := serveGraphQLWith(`{ Shot { sg_sequence { id } } }`, limit)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "Query is nested 3 deep, more than the limit of 2\n", w.Body.String())
+	assert.Len(t, calls.All(), 0)
+
+	// Fragments count where they're spread, introspection doesn't count.
+	w, _ = serveGraphQLWith(`{ ...shots } fragment shots on Query { Shot { ... on Shot { entity_links { id } } } }`, limit)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, _ = serveGraphQLWith(`{ Shot { id } __schema { types { fields { type { ofType { name } } } } } }`, limit)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGraphQLMaxLinks(t *testing.T) {
+	w, calls := serveGraphQLWith(`{ Shot { id sg_sequence { description } } }`, func(config *clientConfig) {
+		config.graphqlMaxLinks = 1
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Query links more than the limit of 1 entities")
+	assert.Len(t, calls.Method("read"), 1)
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/brandonvfx/sg-restful/shotgun"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+/*
+The gRPC API is the service in sg_restful.proto. Requests and responses are google.protobuf.Struct so
+clients only need the service definition, requests look like:
+
+	{"entity_type": "Shot", "q": "[[\"code\", \"is\", \"sh010\"]]", "fields": ["code", "sg_status_list"]}
+
+Credentials go in the 'authorization' metadata, the same as the Authorization header.
+*/
+
+// grpcShotgunServer is the sgrestful.Shotgun service.
+type grpcShotgunServer interface {
+	Find(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	FindOne(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	Create(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	Update(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	Delete(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	Revive(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	Summarize(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error)
+	StreamFind(in *structpb.Struct, stream grpc.ServerStream) error
+}
+
+const grpcServiceName = "sgrestful.Shotgun"
+
+// grpcUnaryHandler adapts a method of the service to a grpc.MethodHandler.
+func grpcUnaryHandler(name string, method func(grpcShotgunServer, context.Context, *structpb.Struct) (*structpb.Struct, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		in := new(structpb.Struct)
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return method(srv.(grpcShotgunServer), ctx, in)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + grpcServiceName + "/" + name}
+		handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+			return method(srv.(grpcShotgunServer), ctx, req.(*structpb.Struct))
+		}
+		return interceptor(ctx, in, info, handler)
+	}
+}
+
+func grpcStreamFindHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(structpb.Struct)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(grpcShotgunServer).StreamFind(in, stream)
+}
+
+// grpcServiceDesc is what protoc would generate from sg_restful.proto.
+var grpcServiceDesc = grpc.ServiceDesc{
+	ServiceName: grpcServiceName,
+	HandlerType: (*grpcShotgunServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Find", Handler: grpcUnaryHandler("Find", grpcShotgunServer.Find)},
+		{MethodName: "FindOne", Handler: grpcUnaryHandler("FindOne", grpcShotgunServer.FindOne)},
+		{MethodName: "Create", Handler: grpcUnaryHandler("Create", grpcShotgunServer.Create)},
+		{MethodName: "Update", Handler: grpcUnaryHandler("Update", grpcShotgunServer.Update)},
+		{MethodName: "Delete", Handler: grpcUnaryHandler("Delete", grpcShotgunServer.Delete)},
+		{MethodName: "Revive", Handler: grpcUnaryHandler("Revive", grpcShotgunServer.Revive)},
+		{MethodName: "Summarize", Handler: grpcUnaryHandler("Summarize", grpcShotgunServer.Summarize)},
+	},
+	Streams: []grpc.StreamDesc{
+		{StreamName: "StreamFind", Handler: grpcStreamFindHandler, ServerStreams: true},
+	},
+	Metadata: "sg_restful.proto",
+}
+
+// newGRPCServer makes the gRPC server, authenticating every call like
+// ShotgunAuthMiddleware.
+func newGRPCServer(config clientConfig) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(grpcAuthUnaryInterceptor(config)),
+		grpc.StreamInterceptor(grpcAuthStreamInterceptor(config)),
+	)
+	server.RegisterService(&grpcServiceDesc, &grpcServer{config: config})
+	return server
+}
+
+// grpcAuth adds the connection for the 'authorization' metadata to ctx.
+func grpcAuth(ctx context.Context, config clientConfig) (context.Context, error) {
+	authorization := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authorization = values[0]
+		}
+	}
+
+	conn, hash, httpStatus := shotgunConnection(config, authorization)
+	if httpStatus != http.StatusOK {
+		return nil, status.Error(grpcCode(httpStatus), http.StatusText(httpStatus))
+	}
+	ctx = context.WithValue(ctx, "sgConn", conn.WithContext(ctx))
+	ctx = context.WithValue(ctx, "sgConnKey", hash)
+	return ctx, nil
+}
+
+func grpcAuthUnaryInterceptor(config clientConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		log.Debug("gRPC: ", info.FullMethod)
+		ctx, err := grpcAuth(ctx, config)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// grpcAuthStream is a stream with the connection in its context.
+type grpcAuthStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *grpcAuthStream) Context() context.Context {
+	return s.ctx
+}
+
+func grpcAuthStreamInterceptor(config clientConfig) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		log.Debug("gRPC: ", info.FullMethod)
+		ctx, err := grpcAuth(stream.Context(), config)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &grpcAuthStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// grpcCode is the gRPC code for the HTTP status the REST API would use.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case statusClientClosedRequest:
+		return codes.Canceled
+	}
+	return codes.Internal
+}
+
+// grpcError turns a Shotgun error into a status.
+func grpcError(err error) error {
+	message := err.Error()
+	if strings.Contains(message, "not found") {
+		return status.Error(codes.NotFound, message)
+	}
+	return grpcShotgunError(grpcCode(shotgunErrorStatus(err, updateExceptionStatus(message))), err)
+}
+
+// grpcShotgunError is the status for an error calling Shotgun. When the
+// breaker is open it says when to retry in a RetryInfo detail, as
+// Retry-After does over http.
+func grpcShotgunError(code codes.Code, err error) error {
+	st := status.New(code, err.Error())
+	if retryAfter, ok := shotgun.CircuitRetryAfter(err); ok {
+		if detailed, detailErr := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)}); detailErr == nil {
+			st = detailed
+		}
+	}
+	return st.Err()
+}
+
+// grpcStruct converts a json shaped value to a Struct.
+func grpcStruct(value interface{}) (*structpb.Struct, error) {
+	var data map[string]interface{}
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if err := json.Unmarshal(jsonValue, &data); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	out, err := structpb.NewStruct(data)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return out, nil
+}
+
+// grpcRequest is the fields of a request Struct.
+type grpcRequest map[string]interface{}
+
+func (r grpcRequest) String(key string) string {
+	value, _ := r[key].(string)
+	return value
+}
+
+func (r grpcRequest) Int(key string) (int, bool) {
+	value, ok := r[key].(float64)
+	return int(value), ok
+}
+
+// Fields is the 'fields' list, or comma separated string.
+func (r grpcRequest) Fields() []string {
+	switch value := r["fields"].(type) {
+	case string:
+		return splitList(value)
+	case []interface{}:
+		fields := make([]string, 0, len(value))
+		for _, field := range value {
+			if fieldName, ok := field.(string); ok {
+				fields = append(fields, fieldName)
+			}
+		}
+		return fields
+	}
+	return nil
+}
+
+// Target is the entity_type and id of a request.
+func (r grpcRequest) Target(needID bool) (string, int, error) {
+	entityType := r.String("entity_type")
+	if entityType == "" {
+		return "", 0, status.Error(codes.InvalidArgument, "entity_type missing")
+	}
+	id, ok := r.Int("id")
+	if needID && !ok {
+		return "", 0, status.Error(codes.InvalidArgument, "id missing")
+	}
+	return entityType, id, nil
+}
+
+// Data is the 'data' object of a create or update.
+func (r grpcRequest) Data() (map[string]interface{}, error) {
+	data, ok := r["data"].(map[string]interface{})
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "data must be an object")
+	}
+	return data, nil
+}
+
+// ReadQuery builds a read from 'q', 'fields', 'sort', 'page' and 'limit'.
+func (r grpcRequest) ReadQuery(entityType string) (readQuery, error) {
+	query := newReadQuery(entityType)
+	if fields := r.Fields(); len(fields) > 0 {
+		query.ReturnFields = fields
+	}
+	if q := r.String("q"); q != "" {
+		filters, err := parseQuery(q)
+		if err != nil {
+			return query, status.Error(codes.InvalidArgument, err.Error())
+		}
+		query.Filters = filters
+	}
+	for _, field := range splitList(r.String("sort")) {
+		direction := "asc"
+		if strings.HasPrefix(field, "-") {
+			field, direction = field[1:], "desc"
+		}
+		query.Sorts = append(query.Sorts, readSort{FieldName: field, Direction: direction})
+	}
+	if page, ok := r.Int("page"); ok && page > 0 {
+		query.Paging["current_page"] = page
+	}
+	if limit, ok := r.Int("limit"); ok && limit > 0 && limit < 500 {
+		query.Paging["entities_per_page"] = limit
+	}
+	return query, nil
+}
+
+// grpcServer implements the service with the same helpers as the handlers.
+type grpcServer struct {
+	config clientConfig
+}
+
+func (s *grpcServer) conn(ctx context.Context) (Shotgun, error) {
+	sg, ok := ctx.Value("sgConn").(Shotgun)
+	if !ok {
+		return sg, status.Error(codes.Unauthenticated, "No Shotgun connection")
+	}
+	return sg, nil
+}
+
+// Find returns {"entities": [...]} for a page of entities.
+func (s *grpcServer) Find(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	sg, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := grpcRequest(in.AsMap())
+	entityType, _, err := req.Target(false)
+	if err != nil {
+		return nil, err
+	}
+	query, err := req.ReadQuery(entityType)
+	if err != nil {
+		return nil, err
+	}
+
+	entities, err := readEntities(sg, query)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return grpcStruct(map[string]interface{}{"entities": entities})
+}
+
+// FindOne returns an entity by id.
+func (s *grpcServer) FindOne(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	sg, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := grpcRequest(in.AsMap())
+	entityType, id, err := req.Target(true)
+	if err != nil {
+		return nil, err
+	}
+
+	entity, err := readRepresentation(sg, entityType, id, append([]string{"id"}, req.Fields()...))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return grpcStruct(entity)
+}
+
+// Create returns the new entity, with 'fields' if they are given.
+func (s *grpcServer) Create(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	sg, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := grpcRequest(in.AsMap())
+	entityType, _, err := req.Target(false)
+	if err != nil {
+		return nil, err
+	}
+	data, err := req.Data()
+	if err != nil {
+		return nil, err
+	}
+
+	createResp, httpStatus, err := createEntity(sg, entityType, data)
+	if err != nil {
+		return nil, grpcShotgunError(grpcCode(httpStatus), err)
+	}
+	if createResp.Exception {
+		return nil, grpcError(errors.New(createResp.Message))
+	}
+	id, _ := createResp.Results["id"].(float64)
+	return s.result(sg, entityType, int(id), req.Fields(), createResp.Results)
+}
+
+// Update takes the same data as PATCH, including update modes.
+func (s *grpcServer) Update(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	sg, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := grpcRequest(in.AsMap())
+	entityType, id, err := req.Target(true)
+	if err != nil {
+		return nil, err
+	}
+	data, err := req.Data()
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := entityUpdateFieldValues(data, nil)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	updateResp, httpStatus, err := updateEntity(sg, entityType, id, fields)
+	if err != nil {
+		return nil, grpcShotgunError(grpcCode(httpStatus), err)
+	}
+	if updateResp.Exception {
+		return nil, grpcError(errors.New(updateResp.Message))
+	}
+	return s.result(sg, entityType, id, req.Fields(), updateResp.Results)
+}
+
+// result reads the entity back when fields are asked for.
+func (s *grpcServer) result(sg Shotgun, entityType string, id int, fields []string, result map[string]interface{}) (*structpb.Struct, error) {
+	if len(fields) > 0 {
+		entity, err := readRepresentation(sg, entityType, id, append([]string{"id"}, fields...))
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		result = entity
+	}
+	return grpcStruct(result)
+}
+
+// Delete returns {"results": true}.
+func (s *grpcServer) Delete(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	return s.idRequest(ctx, "delete", in)
+}
+
+// Revive returns {"results": true}.
+func (s *grpcServer) Revive(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	return s.idRequest(ctx, "revive", in)
+}
+
+func (s *grpcServer) idRequest(ctx context.Context, method string, in *structpb.Struct) (*structpb.Struct, error) {
+	sg, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entityType, id, err := grpcRequest(in.AsMap()).Target(true)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := entityIDRequest(sg, method, entityType, id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return grpcStruct(map[string]interface{}{"results": results})
+}
+
+// Summarize takes 'q' and the 'summaries' and 'grouping' lists the REST
+// API takes as json.
+func (s *grpcServer) Summarize(ctx context.Context, in *structpb.Struct) (*structpb.Struct, error) {
+	sg, err := s.conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req := grpcRequest(in.AsMap())
+	entityType, _, err := req.Target(false)
+	if err != nil {
+		return nil, err
+	}
+
+	query := newSummarizeQuery(entityType)
+	if q := req.String("q"); q != "" {
+		filters, err := parseQuery(q)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		query.Filters = filters
+	}
+	for key, target := range map[string]interface{}{"summaries": &query.Summaries, "grouping": &query.Grouping} {
+		if value, ok := req[key]; ok {
+			jsonValue, _ := json.Marshal(value)
+			if err := json.Unmarshal(jsonValue, target); err != nil {
+				return nil, status.Errorf(codes.InvalidArgument, "Bad %s: %v", key, err)
+			}
+		}
+	}
+
+	summarizeResp, httpStatus, err := summarizeEntities(sg, query)
+	if err != nil {
+		return nil, grpcShotgunError(grpcCode(httpStatus), err)
+	}
+	if summarizeResp.Exception {
+		return nil, grpcError(errors.New(summarizeResp.Message))
+	}
+	return grpcStruct(summarizeResp.Results)
+}
+
+// StreamFind sends every entity matching the query, a page at a time.
+func (s *grpcServer) StreamFind(in *structpb.Struct, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	sg, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+	req := grpcRequest(in.AsMap())
+	entityType, _, err := req.Target(false)
+	if err != nil {
+		return err
+	}
+	query, err := req.ReadQuery(entityType)
+	if err != nil {
+		return err
+	}
+
+	for {
+		entities, err := readEntities(sg, query)
+		if err != nil {
+			return grpcError(err)
+		}
+		for _, entity := range entities {
+			out, err := grpcStruct(entity)
+			if err != nil {
+				return err
+			}
+			if err := stream.SendMsg(out); err != nil {
+				return err
+			}
+		}
+		if len(entities) < query.Paging["entities_per_page"] {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return status.FromContextError(err).Err()
+		}
+		query.Paging["current_page"]++
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/brandonvfx/sg-restful/shotgun"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// dialGRPC serves the gRPC API against a mock Shotgun and returns a client
+// connection to it. stop closes everything.
+func dialGRPC(t *testing.T, respond func(call shotgunCall) string) (*grpc.ClientConn, *shotgunCalls, func()) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	server, _, config, calls := mockShotgunFunc(respond)
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := newGRPCServer(config)
+	go grpcServer.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	assert.Nil(t, err)
+
+	return conn, calls, func() {
+		conn.Close()
+		grpcServer.Stop()
+		server.Close()
+	}
+}
+
+func grpcAuthContext() context.Context {
+	auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("script:key"))
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", auth)
+}
+
+func invokeGRPC(ctx context.Context, conn *grpc.ClientConn, method string, in map[string]interface{}) (map[string]interface{}, error) {
+	req, err := structpb.NewStruct(in)
+	if err != nil {
+		return nil, err
+	}
+	out := new(structpb.Struct)
+	if err := conn.Invoke(ctx, "/sgrestful.Shotgun/"+method, req, out); err != nil {
+		return nil, err
+	}
+	return out.AsMap(), nil
+}
+
+func TestGRPCFind(t *testing.T) {
+	conn, calls, stop := dialGRPC(t, func(call shotgunCall) string {
+		return `{"results":{"entities":[{"type":"Shot","id":1,"code":"sh010"}],"paging_info":{"entity_count":1}}}`
+	})
+	defer stop()
+
+	out, err := invokeGRPC(grpcAuthContext(), conn, "Find", map[string]interface{}{
+		"entity_type": "Shot",
+		"q":           `[["code","is","sh010"]]`,
+		"fields":      []interface{}{"code"},
+		"sort":        "-code",
+		"limit":       10,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"entities": []interface{}{map[string]interface{}{"type": "Shot", "id": float64(1), "code": "sh010"}},
+	}, out)
+
+	reads := calls.Method("read")
+	if assert.Len(t, reads, 1) {
+		query := reads[0].Query
+		assert.Equal(t, "Shot", query["type"])
+		assert.Equal(t, []interface{}{"code"}, query["return_fields"])
+		assert.Equal(t, []interface{}{map[string]interface{}{"field_name": "code", "direction": "desc"}}, query["sorts"])
+		assert.Equal(t, float64(10), query["paging"].(map[string]interface{})["entities_per_page"])
+	}
+}
+
+func TestGRPCFindOneNotFound(t *testing.T) {
+	conn, _, stop := dialGRPC(t, func(call shotgunCall) string {
+		return `{"results":{"entities":[],"paging_info":{"entity_count":0}}}`
+	})
+	defer stop()
+
+	_, err := invokeGRPC(grpcAuthContext(), conn, "FindOne", map[string]interface{}{"entity_type": "Shot", "id": 1})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = invokeGRPC(grpcAuthContext(), conn, "FindOne", map[string]interface{}{"entity_type": "Shot"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCShotgunError(t *testing.T) {
+	err := grpcShotgunError(codes.Unavailable, &shotgun.CircuitOpenError{RetryAfter: time.Minute})
+	st := status.Convert(err)
+	assert.Equal(t, codes.Unavailable, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		assert.Equal(t, time.Minute, st.Details()[0].(*errdetails.RetryInfo).RetryDelay.AsDuration())
+	}
+
+	st = status.Convert(grpcShotgunError(codes.Internal, errors.New("bad")))
+	assert.Equal(t, codes.Internal, st.Code())
+	assert.Len(t, st.Details(), 0)
+}
+
+func TestGRPCWrites(t *testing.T) {
+	conn, calls, stop := dialGRPC(t, func(call shotgunCall) string {
+		switch call.Method {
+		case "create":
+			return `{"results":{"type":"Shot","id":1,"code":"sh010"}}`
+		case "update":
+			return `{"exception":true,"message":"API update() CRUD ERROR #5: Entity Shot 2 does not exist","error_code":104}`
+		case "delete":
+			return `{"results":true}`
+		}
+		return `{"exception":true,"message":"unexpected call","error_code":100}`
+	})
+	defer stop()
+
+	out, err := invokeGRPC(grpcAuthContext(), conn, "Create", map[string]interface{}{
+		"entity_type": "Shot",
+		"data":        map[string]interface{}{"code": "sh010"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "sh010", out["code"])
+	creates := calls.Method("create")
+	if assert.Len(t, creates, 1) {
+		assert.Equal(t, []interface{}{map[string]interface{}{"field_name": "code", "value": "sh010"}}, creates[0].Query["fields"])
+	}
+
+	_, err = invokeGRPC(grpcAuthContext(), conn, "Update", map[string]interface{}{
+		"entity_type": "Shot",
+		"id":          2,
+		"data":        map[string]interface{}{"code": "sh020"},
+	})
+	assert.NotNil(t, err)
+	assert.NotEqual(t, codes.OK, status.Code(err))
+
+	out, err = invokeGRPC(grpcAuthContext(), conn, "Delete", map[string]interface{}{"entity_type": "Shot", "id": 1})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"results": true}, out)
+}
+
+func TestGRPCSummarize(t *testing.T) {
+	conn, calls, stop := dialGRPC(t, func(call shotgunCall) string {
+		return `{"results":{"summaries":{"id":3},"groups":[]}}`
+	})
+	defer stop()
+
+	out, err := invokeGRPC(grpcAuthContext(), conn, "Summarize", map[string]interface{}{
+		"entity_type": "Shot",
+		"summaries":   []interface{}{map[string]interface{}{"field": "id", "type": "count"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"id": float64(3)}, out["summaries"])
+
+	summarizes := calls.Method("summarize")
+	if assert.Len(t, summarizes, 1) {
+		assert.Equal(t, []interface{}{map[string]interface{}{"field": "id", "type": "count"}}, summarizes[0].Query["summaries"])
+	}
+}
+
+func TestGRPCStreamFind(t *testing.T) {
+	conn, calls, stop := dialGRPC(t, func(call shotgunCall) string {
+		page := call.Query["paging"].(map[string]interface{})["current_page"]
+		if page == float64(1) {
+			return `{"results":{"entities":[{"type":"Shot","id":1},{"type":"Shot","id":2}],"paging_info":{"entity_count":3}}}`
+		}
+		return `{"results":{"entities":[{"type":"Shot","id":3}],"paging_info":{"entity_count":3}}}`
+	})
+	defer stop()
+
+	ctx, cancel := context.WithCancel(grpcAuthContext())
+	defer cancel()
+	stream, err := conn.NewStream(ctx, &grpcServiceDesc.Streams[0], "/sgrestful.Shotgun/StreamFind")
+	assert.Nil(t, err)
+	req, _ := structpb.NewStruct(map[string]interface{}{"entity_type": "Shot", "limit": 2})
+	assert.Nil(t, stream.SendMsg(req))
+	assert.Nil(t, stream.CloseSend())
+
+	var ids []float64
+	for {
+		out := new(structpb.Struct)
+		err := stream.RecvMsg(out)
+		if err == io.EOF {
+			break
+		}
+		if !assert.Nil(t, err) {
+			break
+		}
+		ids = append(ids, out.AsMap()["id"].(float64))
+	}
+	assert.Equal(t, []float64{1, 2, 3}, ids)
+	assert.Len(t, calls.Method("read"), 2)
+}
+
+func TestGRPCAuth(t *testing.T) {
+	conn, calls, stop := dialGRPC(t, func(call shotgunCall) string {
+		return `{"results":{"entities":[],"paging_info":{"entity_count":0}}}`
+	})
+	defer stop()
+
+	_, err := invokeGRPC(context.Background(), conn, "Find", map[string]interface{}{"entity_type": "Shot"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	noColon := "Basic " + base64.StdEncoding.EncodeToString([]byte("script"))
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", noColon)
+	_, err = invokeGRPC(ctx, conn, "Find", map[string]interface{}{"entity_type": "Shot"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	assert.Len(t, calls.Method("read"), 0)
+}
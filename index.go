@@ -28,6 +28,7 @@ func indexHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Re
 			rw.WriteHeader(http.StatusInternalServerError)
 			return
 		}
+		defer sgReq.Body.Close()
 
 		if sgReq.StatusCode >= 400 && sgReq.StatusCode < 500 {
 			log.Errorf("Shotgun Response Status Code: %v ", sgReq.StatusCode)
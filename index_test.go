@@ -91,7 +91,7 @@ func TestIndexBadShotgunHost(t *testing.T) {
 		ServerURL:  "http://localhost:102782/",
 		ScriptName: "fake-script",
 		ScriptKey:  "fake-key",
-		client:     http.Client{},
+		client:     shotgunHTTPClient,
 	})
 	config := newClientConfig("0.0.0-test.1", "http://localhost:102782/")
 
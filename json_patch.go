@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	jsonPatchType  = "application/json-patch+json"
+	mergePatchType = "application/merge-patch+json"
+)
+
+type patchError struct {
+	StatusCode int
+	Message    string
+	// err is the Shotgun error the patch failed on, if any.
+	err error
+}
+
+func (pe patchError) Error() string {
+	return pe.Message
+}
+
+func newPatchError(statusCode int, format string, args ...interface{}) patchError {
+	return patchError{StatusCode: statusCode, Message: fmt.Sprintf(format, args...)}
+}
+
+// jsonPatchOp is one RFC 6902 operation, only add, remove, replace and test
+// are supported.
+type jsonPatchOp struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value"`
+}
+
+// mergePatchData reads an RFC 7386 merge patch. Shotgun field values are
+// replaced as a whole so only the top level is merged, null clears a field.
+func mergePatchData(body []byte) (map[string]interface{}, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(body, &data); err != nil || data == nil {
+		return nil, newPatchError(http.StatusBadRequest, "Merge patch must be an object")
+	}
+	return data, nil
+}
+
+// jsonPointer splits a path into a field and an optional array index,
+// deeper paths aren't supported.
+func jsonPointer(path string) (string, string, error) {
+	if !strings.HasPrefix(path, "/") || path == "/" {
+		return "", "", newPatchError(http.StatusUnprocessableEntity, "Invalid path: '%s'", path)
+	}
+	parts := strings.Split(path[1:], "/")
+	if len(parts) > 2 {
+		return "", "", newPatchError(http.StatusUnprocessableEntity, "Path is too deep: '%s'", path)
+	}
+	for i, part := range parts {
+		parts[i] = strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+	}
+	if len(parts) == 1 {
+		return parts[0], "", nil
+	}
+	return parts[0], parts[1], nil
+}
+
+// patchIndex turns an index segment into an index into list. '-' is the end
+// of the list and is only allowed when adding.
+func patchIndex(list []interface{}, index string, adding bool) (int, error) {
+	if index == "-" && adding {
+		return len(list), nil
+	}
+	i, err := strconv.Atoi(index)
+	max := len(list) - 1
+	if adding {
+		max = len(list)
+	}
+	if err != nil || i < 0 || i > max {
+		return 0, newPatchError(http.StatusUnprocessableEntity, "Invalid index: '%s'", index)
+	}
+	return i, nil
+}
+
+// applyJSONPatchOp applies op to doc, which holds the current values of
+// every field the patch touches.
+func applyJSONPatchOp(doc map[string]interface{}, op jsonPatchOp) error {
+	field, index, err := jsonPointer(op.Path)
+	if err != nil {
+		return err
+	}
+	current, exists := doc[field]
+
+	if index == "" {
+		switch op.Op {
+		case "add":
+			doc[field] = op.Value
+		case "replace":
+			if !exists {
+				return newPatchError(http.StatusUnprocessableEntity, "Field does not exist: '%s'", field)
+			}
+			doc[field] = op.Value
+		case "remove":
+			if !exists {
+				return newPatchError(http.StatusUnprocessableEntity, "Field does not exist: '%s'", field)
+			}
+			// Fields can't be removed from an entity, only cleared.
+			doc[field] = nil
+		case "test":
+			if !reflect.DeepEqual(current, op.Value) {
+				return newPatchError(http.StatusConflict, "Test failed: '%s'", op.Path)
+			}
+		}
+		return nil
+	}
+
+	list, ok := current.([]interface{})
+	if !ok {
+		if current != nil || op.Op != "add" {
+			return newPatchError(http.StatusUnprocessableEntity, "Field is not a list: '%s'", field)
+		}
+		list = []interface{}{}
+	}
+	i, err := patchIndex(list, index, op.Op == "add")
+	if err != nil {
+		return err
+	}
+
+	switch op.Op {
+	case "add":
+		updated := append(append(append([]interface{}{}, list[:i]...), op.Value), list[i:]...)
+		doc[field] = updated
+	case "replace":
+		updated := append([]interface{}{}, list...)
+		updated[i] = op.Value
+		doc[field] = updated
+	case "remove":
+		doc[field] = append(append([]interface{}{}, list[:i]...), list[i+1:]...)
+	case "test":
+		if !reflect.DeepEqual(list[i], op.Value) {
+			return newPatchError(http.StatusConflict, "Test failed: '%s'", op.Path)
+		}
+	}
+	return nil
+}
+
+// entityKey identifies an entity in a multi-entity field.
+func entityKey(value interface{}) (string, bool) {
+	entity, ok := value.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	entityType, typeOK := entity["type"].(string)
+	id, idOK := entity["id"].(float64)
+	if !typeOK || !idOK {
+		return "", false
+	}
+	return fmt.Sprintf("%s:%d", entityType, int(id)), true
+}
+
+// entityListChanges finds the entities added to and removed from a
+// multi-entity field. ok is false if either isn't a list of entities.
+func entityListChanges(before, after interface{}) (added, removed []interface{}, ok bool) {
+	beforeList, beforeOK := before.([]interface{})
+	afterList, afterOK := after.([]interface{})
+	if !beforeOK || !afterOK {
+		return nil, nil, false
+	}
+
+	beforeKeys := make(map[string]bool)
+	for _, entity := range beforeList {
+		key, isEntity := entityKey(entity)
+		if !isEntity {
+			return nil, nil, false
+		}
+		beforeKeys[key] = true
+	}
+	afterKeys := make(map[string]bool)
+	for _, entity := range afterList {
+		key, isEntity := entityKey(entity)
+		if !isEntity {
+			return nil, nil, false
+		}
+		afterKeys[key] = true
+		if !beforeKeys[key] {
+			added = append(added, entity)
+		}
+	}
+	for _, entity := range beforeList {
+		key, _ := entityKey(entity)
+		if !afterKeys[key] {
+			removed = append(removed, entity)
+		}
+	}
+	return added, removed, true
+}
+
+// jsonPatchFields turns an RFC 6902 patch into update fields. The fields it
+// touches are read first and the patch applied to them, then multi-entity
+// fields that only gained or lost entities use the add or remove modes so
+// they don't race with other writers. The patched values are returned too.
+func jsonPatchFields(sg Shotgun, entityType string, entityID int, body []byte) ([]map[string]interface{}, map[string]interface{}, error) {
+	var ops []jsonPatchOp
+	if err := json.Unmarshal(body, &ops); err != nil {
+		return nil, nil, newPatchError(http.StatusBadRequest, "JSON patch must be a list of operations")
+	}
+
+	fieldNames := []string{}
+	seen := make(map[string]bool)
+	modified := make(map[string]bool)
+	for _, op := range ops {
+		switch op.Op {
+		case "add", "remove", "replace", "test":
+		default:
+			return nil, nil, newPatchError(http.StatusBadRequest, "Unsupported op: '%s'", op.Op)
+		}
+		field, _, err := jsonPointer(op.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !seen[field] {
+			seen[field] = true
+			fieldNames = append(fieldNames, field)
+		}
+		if op.Op != "test" {
+			modified[field] = true
+		}
+	}
+
+	current, err := readRepresentation(sg, entityType, entityID, fieldNames)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil, nil, newPatchError(http.StatusNotFound, "%s", err)
+		} else if strings.Contains(err.Error(), "Permission") {
+			return nil, nil, newPatchError(http.StatusForbidden, "%s", err)
+		}
+		pe := newPatchError(shotgunErrorStatus(err, http.StatusBadRequest), "%s", err)
+		pe.err = err
+		return nil, nil, pe
+	}
+
+	doc := make(map[string]interface{})
+	for _, field := range fieldNames {
+		if value, ok := current[field]; ok {
+			doc[field] = value
+		}
+	}
+	for _, op := range ops {
+		if err := applyJSONPatchOp(doc, op); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	fields := make([]map[string]interface{}, 0)
+	patchData := make(map[string]interface{})
+	for _, fieldName := range fieldNames {
+		if !modified[fieldName] {
+			continue
+		}
+		value := doc[fieldName]
+		patchData[fieldName] = value
+		field := map[string]interface{}{
+			"field_name": fieldName,
+			"value":      value,
+		}
+		added, removed, isList := entityListChanges(current[fieldName], value)
+		if isList && len(added) > 0 && len(removed) == 0 {
+			field["value"] = added
+			field["multi_entity_update_mode"] = "add"
+		} else if isList && len(removed) > 0 && len(added) == 0 {
+			field["value"] = removed
+			field["multi_entity_update_mode"] = "remove"
+		}
+		fields = append(fields, field)
+	}
+	return fields, patchData, nil
+}
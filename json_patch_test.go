@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const jsonPatchCurrent = `{"results":{"entities":[{"type":"Shot","id":7,"code":"sh010","description":"Old","tasks":[{"type":"Task","id":1},{"type":"Task","id":2}]}],"paging_info":{"current_page":1,"page_count":1,"entity_count":1,"entities_per_page":1}}}`
+
+func jsonPatchRequest(contentType, body string) *http.Request {
+	req := patchRequest("/Shot/7", body)
+	req.Header.Set("Content-Type", contentType)
+	return req
+}
+
+func serveJSONPatch(req *http.Request) (*httptest.ResponseRecorder, *shotgunCalls) {
+	w := httptest.NewRecorder()
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"read":   jsonPatchCurrent,
+		"update": `{"results":{"type":"Shot","id":7}}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	return w, calls
+}
+
+func updateFields(t *testing.T, calls *shotgunCalls) []interface{} {
+	updates := calls.Method("update")
+	if !assert.Len(t, updates, 1) {
+		return nil
+	}
+	return updates[0].Query["fields"].([]interface{})
+}
+
+func TestJSONPatchReplaceRemove(t *testing.T) {
+	w, calls := serveJSONPatch(jsonPatchRequest(jsonPatchType,
+		`[{"op":"test","path":"/code","value":"sh010"},{"op":"replace","path":"/code","value":"sh020"},{"op":"remove","path":"/description"}]`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	reads := calls.Method("read")
+	if assert.Len(t, reads, 1) {
+		assert.Equal(t, []interface{}{"code", "description"}, reads[0].Query["return_fields"])
+	}
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"field_name": "code", "value": "sh020"},
+		map[string]interface{}{"field_name": "description", "value": nil},
+	}, updateFields(t, calls))
+}
+
+func TestJSONPatchMultiEntityAdd(t *testing.T) {
+	w, calls := serveJSONPatch(jsonPatchRequest(jsonPatchType,
+		`[{"op":"add","path":"/tasks/-","value":{"type":"Task","id":3}}]`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"field_name":               "tasks",
+			"value":                    []interface{}{map[string]interface{}{"type": "Task", "id": float64(3)}},
+			"multi_entity_update_mode": "add",
+		},
+	}, updateFields(t, calls))
+}
+
+func TestJSONPatchMultiEntityRemove(t *testing.T) {
+	w, calls := serveJSONPatch(jsonPatchRequest(jsonPatchType,
+		`[{"op":"test","path":"/tasks/0","value":{"type":"Task","id":1}},{"op":"remove","path":"/tasks/0"}]`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"field_name":               "tasks",
+			"value":                    []interface{}{map[string]interface{}{"type": "Task", "id": float64(1)}},
+			"multi_entity_update_mode": "remove",
+		},
+	}, updateFields(t, calls))
+}
+
+func TestJSONPatchMultiEntityReplace(t *testing.T) {
+	w, calls := serveJSONPatch(jsonPatchRequest(jsonPatchType,
+		`[{"op":"replace","path":"/tasks/1","value":{"type":"Task","id":3}}]`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{
+			"field_name": "tasks",
+			"value": []interface{}{
+				map[string]interface{}{"type": "Task", "id": float64(1)},
+				map[string]interface{}{"type": "Task", "id": float64(3)},
+			},
+		},
+	}, updateFields(t, calls))
+}
+
+func TestJSONPatchTestFailed(t *testing.T) {
+	w, calls := serveJSONPatch(jsonPatchRequest(jsonPatchType,
+		`[{"op":"test","path":"/code","value":"sh999"},{"op":"replace","path":"/code","value":"sh020"}]`))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Empty(t, calls.Method("update"))
+}
+
+func TestJSONPatchInvalid(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+	}{
+		{`{"op":"add"}`, http.StatusBadRequest},
+		{`[{"op":"move","from":"/code","path":"/description"}]`, http.StatusBadRequest},
+		{`[{"op":"add","path":"code","value":"sh020"}]`, http.StatusUnprocessableEntity},
+		{`[{"op":"add","path":"/project/name","value":"foo"}]`, http.StatusUnprocessableEntity},
+		{`[{"op":"remove","path":"/tasks/5"}]`, http.StatusUnprocessableEntity},
+		{`[{"op":"add","path":"/code/0","value":"s"}]`, http.StatusUnprocessableEntity},
+	}
+	for _, test := range tests {
+		w, calls := serveJSONPatch(jsonPatchRequest(jsonPatchType, test.body))
+		assert.Equal(t, test.status, w.Code, test.body)
+		assert.Empty(t, calls.Method("update"), test.body)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	w, calls := serveJSONPatch(jsonPatchRequest(mergePatchType+"; charset=utf-8",
+		`{"description":null,"tasks":{"$add":[{"type":"Task","id":3}]}}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, calls.Method("read"))
+
+	// '$add' is only for plain json, a merge patch sets the value as is.
+	fields := updateFields(t, calls)
+	assert.Len(t, fields, 2)
+	assert.Contains(t, fields, map[string]interface{}{"field_name": "description", "value": nil})
+	assert.Contains(t, fields, map[string]interface{}{
+		"field_name": "tasks",
+		"value":      map[string]interface{}{"$add": []interface{}{map[string]interface{}{"type": "Task", "id": float64(3)}}},
+	})
+
+	w, calls = serveJSONPatch(jsonPatchRequest(mergePatchType, `[1,2]`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, calls.All())
+}
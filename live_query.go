@@ -0,0 +1,347 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+// liveQueryPing is how often clients are pinged to keep the socket open.
+var liveQueryPing = 30 * time.Second
+
+// liveQueryCheckOrigin only lets browsers open sockets from the api's own
+// host or the allowed origins. Browsers send cached Basic credentials with
+// the handshake, any other site could read live queries as the user.
+// Clients that aren't browsers don't send an Origin.
+func liveQueryCheckOrigin(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, allow := range allowed {
+			if strings.EqualFold(origin, allow) {
+				return true
+			}
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
+
+// liveQueryMessage is sent by clients to start and stop live queries.
+// ie: {"op": "subscribe", "id": "board", "type": "Task", "q": "...", "fields": ["content"]}
+type liveQueryMessage struct {
+	Op     string   `json:"op"`
+	ID     string   `json:"id"`
+	Type   string   `json:"type"`
+	Query  string   `json:"q"`
+	Fields []string `json:"fields"`
+}
+
+// liveQueryUpdate is sent to clients. The first update for a live query is
+// 'init' with every matching entity, followed by 'add', 'change' and
+// 'remove' as entities enter, change inside or leave the results.
+type liveQueryUpdate struct {
+	Op       string                   `json:"op"`
+	ID       string                   `json:"id"`
+	Entities []map[string]interface{} `json:"entities,omitempty"`
+	Entity   map[string]interface{}   `json:"entity,omitempty"`
+	Message  string                   `json:"message,omitempty"`
+}
+
+// liveQueryConn is a websocket with any number of live queries on it.
+type liveQueryConn struct {
+	ws        *websocket.Conn
+	sg        Shotgun
+	sgConnKey string
+	config    clientConfig
+
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	queries   map[string]*eventSubscription
+	wg        sync.WaitGroup
+}
+
+func (lqc *liveQueryConn) send(update liveQueryUpdate) error {
+	lqc.writeLock.Lock()
+	defer lqc.writeLock.Unlock()
+	return lqc.ws.WriteJSON(update)
+}
+
+func (lqc *liveQueryConn) ping() error {
+	lqc.writeLock.Lock()
+	defer lqc.writeLock.Unlock()
+	return lqc.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+}
+
+func (lqc *liveQueryConn) sendError(id, message string) {
+	lqc.send(liveQueryUpdate{Op: "error", ID: id, Message: message})
+}
+
+func (lqc *liveQueryConn) subscribe(msg liveQueryMessage) {
+	if msg.ID == "" || msg.Type == "" {
+		lqc.sendError(msg.ID, "id and type are required")
+		return
+	}
+
+	var filters *readFilters
+	if msg.Query != "" {
+		queryFilters, err := parseQuery(msg.Query)
+		if err != nil {
+			lqc.sendError(msg.ID, err.Error())
+			return
+		}
+		filters = &queryFilters
+	}
+
+	lqc.lock.Lock()
+	if _, ok := lqc.queries[msg.ID]; ok {
+		lqc.lock.Unlock()
+		lqc.sendError(msg.ID, "id already subscribed")
+		return
+	}
+	// Subscribe before the first read so nothing that changes in between
+	// is missed. Diffs are against the current results so seeing a change
+	// twice is harmless.
+	sub, err := subscribeEvents(lqc.sgConnKey, lqc.sg, lqc.config.eventPollInterval, []string{msg.Type})
+	if err != nil {
+		lqc.lock.Unlock()
+		lqc.sendError(msg.ID, err.Error())
+		return
+	}
+	lqc.queries[msg.ID] = sub
+	lqc.lock.Unlock()
+
+	// The first read can be big, so it's done without holding up the
+	// client's other messages.
+	lqc.wg.Add(1)
+	go func() {
+		defer lqc.wg.Done()
+		lqc.run(msg, filters, sub)
+	}()
+}
+
+// run sends the first results of a live query and then its changes until
+// the subscription is closed.
+func (lqc *liveQueryConn) run(msg liveQueryMessage, filters *readFilters, sub *eventSubscription) {
+	limit := lqc.config.liveQueryMaxResults
+	entities, err := readEntitiesUpTo(lqc.sg, msg.Type, filters, msg.Fields, limit)
+	if err == nil && limit > 0 && len(entities) > limit {
+		err = fmt.Errorf("Query matches more than the limit of %d entities", limit)
+	}
+	if err != nil {
+		lqc.unsubscribe(msg.ID)
+		lqc.sendError(msg.ID, err.Error())
+		return
+	}
+
+	results := make(map[int]map[string]interface{})
+	for _, entity := range entities {
+		if id, ok := entity["id"].(float64); ok {
+			results[int(id)] = entity
+		}
+	}
+	if err := lqc.send(liveQueryUpdate{Op: "init", ID: msg.ID, Entities: entities}); err != nil {
+		return
+	}
+
+	for events := range sub.Events {
+		ids := make([]int, 0, len(events))
+		seen := make(map[int]bool)
+		for _, event := range events {
+			if !seen[event.EntityID] {
+				seen[event.EntityID] = true
+				ids = append(ids, event.EntityID)
+			}
+		}
+
+		matched, err := matchEntities(lqc.sg, msg.Type, filters, ids, msg.Fields, false)
+		if err != nil {
+			log.Error("Live query: ", err)
+			lqc.sendError(msg.ID, err.Error())
+			continue
+		}
+		current := make(map[int]map[string]interface{})
+		for _, entity := range matched {
+			if id, ok := entity["id"].(float64); ok {
+				current[int(id)] = entity
+			}
+		}
+
+		for _, id := range ids {
+			before, wasIn := results[id]
+			after, isIn := current[id]
+			update := liveQueryUpdate{ID: msg.ID}
+			switch {
+			case wasIn && !isIn:
+				update.Op = "remove"
+				update.Entity = map[string]interface{}{"type": msg.Type, "id": id}
+				delete(results, id)
+			case !wasIn && isIn:
+				update.Op = "add"
+				update.Entity = after
+				results[id] = after
+			case wasIn && isIn && !reflect.DeepEqual(before, after):
+				update.Op = "change"
+				update.Entity = after
+				results[id] = after
+			default:
+				continue
+			}
+			if err := lqc.send(update); err != nil {
+				return
+			}
+		}
+	}
+
+	// Events is closed by unsubscribing too, which already took the query
+	// out. Otherwise the poller dropped it for falling behind and changes
+	// were missed, the client has to start over.
+	lqc.lock.Lock()
+	dropped := lqc.queries[msg.ID] == sub
+	lqc.lock.Unlock()
+	if dropped {
+		lqc.sendError(msg.ID, "Live query fell behind the event log")
+		lqc.writeLock.Lock()
+		lqc.ws.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "live query fell behind"),
+			time.Now().Add(10*time.Second))
+		lqc.writeLock.Unlock()
+		// Ends the read loop, which closes everything else.
+		lqc.ws.Close()
+	}
+}
+
+func (lqc *liveQueryConn) unsubscribe(id string) {
+	lqc.lock.Lock()
+	defer lqc.lock.Unlock()
+	if sub, ok := lqc.queries[id]; ok {
+		sub.Close()
+		delete(lqc.queries, id)
+	}
+}
+
+func (lqc *liveQueryConn) close() {
+	lqc.lock.Lock()
+	for id, sub := range lqc.queries {
+		sub.Close()
+		delete(lqc.queries, id)
+	}
+	lqc.lock.Unlock()
+	lqc.wg.Wait()
+	lqc.ws.Close()
+}
+
+// readAllEntities reads every page of entities matching the filters.
+func readAllEntities(sg Shotgun, entityType string, filters *readFilters, fields []string) ([]map[string]interface{}, error) {
+	return readEntitiesUpTo(sg, entityType, filters, fields, 0)
+}
+
+// readEntitiesUpTo is readAllEntities that stops paging once more than limit
+// entities were read, 0 is no limit. Over the limit at most a page more
+// than it is returned.
+func readEntitiesUpTo(sg Shotgun, entityType string, filters *readFilters, fields []string, limit int) ([]map[string]interface{}, error) {
+	query := newReadQuery(entityType)
+	if filters != nil {
+		query.Filters = *filters
+	}
+	if len(fields) > 0 {
+		query.ReturnFields = fields
+	}
+	if limit > 0 && limit < query.Paging["entities_per_page"] {
+		query.Paging["entities_per_page"] = limit + 1
+	}
+
+	entities := make([]map[string]interface{}, 0)
+	for {
+		page, err := readEntities(sg, query)
+		if err != nil {
+			return nil, err
+		}
+		entities = append(entities, page...)
+		if len(page) < query.Paging["entities_per_page"] || (limit > 0 && len(entities) > limit) {
+			return entities, nil
+		}
+		query.Paging["current_page"]++
+	}
+}
+
+// Handlers
+
+// liveQueryHandler upgrades to a websocket that pushes changes to the
+// results of the client's queries, driven by the shared event log poller.
+func liveQueryHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling liveQueryHandler")
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+		sgConnKey, _ := ctx.Value("sgConnKey").(string)
+
+		upgrader := websocket.Upgrader{CheckOrigin: liveQueryCheckOrigin(config.liveQueryOrigins)}
+		ws, err := upgrader.Upgrade(rw, req, nil)
+		if err != nil {
+			// Upgrade has already written the error response.
+			log.Error("Websocket Upgrade Error: ", err)
+			return
+		}
+
+		lqc := &liveQueryConn{
+			ws:        ws,
+			sg:        sg,
+			sgConnKey: sgConnKey,
+			config:    config,
+			queries:   make(map[string]*eventSubscription),
+		}
+		defer lqc.close()
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(liveQueryPing)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if err := lqc.ping(); err != nil {
+						return
+					}
+				}
+			}
+		}()
+
+		for {
+			var msg liveQueryMessage
+			if err := ws.ReadJSON(&msg); err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					log.Debug("Websocket Read Error: ", err)
+				}
+				return
+			}
+
+			switch msg.Op {
+			case "subscribe":
+				lqc.subscribe(msg)
+			case "unsubscribe":
+				lqc.unsubscribe(msg.ID)
+			default:
+				lqc.sendError(msg.ID, "unknown op: "+msg.Op)
+			}
+		}
+	}
+}
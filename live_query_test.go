@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type LiveQueryTestSuite struct {
+	suite.Suite
+	eventLog *fakeEventLog
+	sgServer *httptest.Server
+	server   *httptest.Server
+}
+
+func (suite *LiveQueryTestSuite) SetupSuite() {
+	manager := GetQPManager()
+	log.Info(" -- LiveQuery Test Suite --\n")
+	manager.SetActiveParsers("format1", "format2", "format3")
+}
+
+func (suite *LiveQueryTestSuite) SetupTest() {
+	suite.eventLog = newFakeEventLog()
+	suite.eventLog.addEvent(1, "Task", "New", 1)
+	suite.eventLog.addEntity("Task", map[string]interface{}{"type": "Task", "id": 1, "sg_status_list": "ip"})
+	suite.sgServer = httptest.NewServer(suite.eventLog)
+
+	config := newClientConfig("0.0.0-test.1", suite.sgServer.URL)
+	config.eventPollInterval = 10 * time.Millisecond
+	suite.server = httptest.NewServer(router(config))
+}
+
+func (suite *LiveQueryTestSuite) TearDownTest() {
+	suite.server.Close()
+	suite.sgServer.Close()
+}
+
+func (suite *LiveQueryTestSuite) dial() *websocket.Conn {
+	header := http.Header{}
+	header.Set("Authorization", fmt.Sprintf("Basic %s", fakeAuthB64))
+	url := "ws" + strings.TrimPrefix(suite.server.URL, "http") + "/_live"
+	ws, _, err := websocket.DefaultDialer.Dial(url, header)
+	suite.Require().Nil(err)
+	return ws
+}
+
+func (suite *LiveQueryTestSuite) next(ws *websocket.Conn) liveQueryUpdate {
+	var update liveQueryUpdate
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	err := ws.ReadJSON(&update)
+	suite.Require().Nil(err)
+	return update
+}
+
+func TestLiveQueryTestSuite(t *testing.T) {
+	suite.Run(t, new(LiveQueryTestSuite))
+}
+
+func (suite *LiveQueryTestSuite) TestLiveQueryDiffs() {
+	ws := suite.dial()
+	defer ws.Close()
+
+	err := ws.WriteJSON(liveQueryMessage{
+		Op:     "subscribe",
+		ID:     "board",
+		Type:   "Task",
+		Query:  `[["sg_status_list","is","ip"]]`,
+		Fields: []string{"sg_status_list"},
+	})
+	suite.Nil(err)
+
+	update := suite.next(ws)
+	suite.Equal("init", update.Op)
+	suite.Equal("board", update.ID)
+	suite.Len(update.Entities, 1)
+
+	// Enters the results
+	suite.eventLog.addEntity("Task", map[string]interface{}{"type": "Task", "id": 2, "sg_status_list": "ip"})
+	suite.eventLog.addEvent(2, "Task", "New", 2)
+	update = suite.next(ws)
+	suite.Equal("add", update.Op)
+	suite.Equal(float64(2), update.Entity["id"])
+
+	// Changes inside the results
+	suite.eventLog.addEntity("Task", map[string]interface{}{"type": "Task", "id": 1, "sg_status_list": "ip", "content": "x"})
+	suite.eventLog.addEvent(3, "Task", "Change", 1)
+	update = suite.next(ws)
+	suite.Equal("change", update.Op)
+	suite.Equal(float64(1), update.Entity["id"])
+
+	// Leaves the results
+	suite.eventLog.removeEntity("Task", 2)
+	suite.eventLog.addEvent(4, "Task", "Change", 2)
+	update = suite.next(ws)
+	suite.Equal("remove", update.Op)
+	suite.Equal(float64(2), update.Entity["id"])
+}
+
+func (suite *LiveQueryTestSuite) TestLiveQueryUnchangedIsQuiet() {
+	ws := suite.dial()
+	defer ws.Close()
+
+	ws.WriteJSON(liveQueryMessage{Op: "subscribe", ID: "board", Type: "Task"})
+	update := suite.next(ws)
+	suite.Equal("init", update.Op)
+
+	// Nothing changed for 1 so only the new entity is sent.
+	suite.eventLog.addEvent(2, "Task", "Change", 1)
+	suite.eventLog.addEntity("Task", map[string]interface{}{"type": "Task", "id": 3, "sg_status_list": "wtg"})
+	suite.eventLog.addEvent(3, "Task", "New", 3)
+	update = suite.next(ws)
+	suite.Equal("add", update.Op)
+	suite.Equal(float64(3), update.Entity["id"])
+}
+
+func (suite *LiveQueryTestSuite) TestLiveQueryErrors() {
+	ws := suite.dial()
+	defer ws.Close()
+
+	ws.WriteJSON(liveQueryMessage{Op: "subscribe", ID: "board"})
+	update := suite.next(ws)
+	suite.Equal("error", update.Op)
+
+	ws.WriteJSON(liveQueryMessage{Op: "subscribe", ID: "board", Type: "Task", Query: "foo"})
+	update = suite.next(ws)
+	suite.Equal("error", update.Op)
+
+	ws.WriteJSON(liveQueryMessage{Op: "foo", ID: "board"})
+	update = suite.next(ws)
+	suite.Equal("error", update.Op)
+}
+
+func (suite *LiveQueryTestSuite) TestLiveQueryUnauthorized() {
+	url := "ws" + strings.TrimPrefix(suite.server.URL, "http") + "/_live"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	suite.NotNil(err)
+	suite.Equal(http.StatusUnauthorized, resp.StatusCode)
+}
+
+func (suite *LiveQueryTestSuite) TestLiveQueryOrigin() {
+	url := "ws" + strings.TrimPrefix(suite.server.URL, "http") + "/_live"
+	header := http.Header{}
+	header.Set("Authorization", fmt.Sprintf("Basic %s", fakeAuthB64))
+
+	// Another site can't use the browser's credentials.
+	header.Set("Origin", "https://evil.example.com")
+	_, resp, err := websocket.DefaultDialer.Dial(url, header)
+	suite.NotNil(err)
+	suite.Equal(http.StatusForbidden, resp.StatusCode)
+
+	header.Set("Origin", suite.server.URL)
+	ws, _, err := websocket.DefaultDialer.Dial(url, header)
+	suite.Require().Nil(err)
+	ws.Close()
+}
+
+func (suite *LiveQueryTestSuite) TestLiveQueryAllowedOrigins() {
+	check := liveQueryCheckOrigin([]string{"https://tracker.example.com"})
+	req := httptest.NewRequest("GET", "http://api.example.com/_live", nil)
+	suite.True(check(req))
+	req.Header.Set("Origin", "https://tracker.example.com")
+	suite.True(check(req))
+	req.Header.Set("Origin", "http://api.example.com")
+	suite.True(check(req))
+	req.Header.Set("Origin", "https://evil.example.com")
+	suite.False(check(req))
+}
+
+func (suite *LiveQueryTestSuite) TestLiveQueryMaxResults() {
+	suite.eventLog.addEntity("Task", map[string]interface{}{"type": "Task", "id": 2, "sg_status_list": "ip"})
+	config := newClientConfig("0.0.0-test.1", suite.sgServer.URL)
+	config.eventPollInterval = 10 * time.Millisecond
+	config.liveQueryMaxResults = 1
+	suite.server.Close()
+	suite.server = httptest.NewServer(router(config))
+
+	ws := suite.dial()
+	defer ws.Close()
+	ws.WriteJSON(liveQueryMessage{Op: "subscribe", ID: "board", Type: "Task"})
+	update := suite.next(ws)
+	suite.Equal("error", update.Op)
+	suite.Equal("Query matches more than the limit of 1 entities", update.Message)
+}
+
+func (suite *LiveQueryTestSuite) TestLiveQueryDropped() {
+	ws := suite.dial()
+	defer ws.Close()
+	ws.WriteJSON(liveQueryMessage{Op: "subscribe", ID: "board", Type: "Task"})
+	update := suite.next(ws)
+	suite.Equal("init", update.Op)
+
+	// What the poller does to a subscriber that fell behind.
+	eventPollersLock.Lock()
+	var poller *eventPoller
+	for _, p := range eventPollers {
+		if strings.HasPrefix(p.sg.ServerURL, suite.sgServer.URL) {
+			poller = p
+		}
+	}
+	eventPollersLock.Unlock()
+	suite.Require().NotNil(poller)
+	poller.lock.Lock()
+	for sub := range poller.subscribers {
+		delete(poller.subscribers, sub)
+		close(sub.Events)
+	}
+	poller.lock.Unlock()
+
+	update = suite.next(ws)
+	suite.Equal("error", update.Op)
+	_, _, err := ws.ReadMessage()
+	suite.True(websocket.IsCloseError(err, websocket.CloseTryAgainLater))
+}
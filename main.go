@@ -1,10 +1,15 @@
 package main
 
 import (
+	"encoding/json"
+	"expvar"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/brandonvfx/sg-restful/shotgun"
 	"github.com/gorilla/mux"
 	"github.com/meatballhat/negroni-logrus"
 	"github.com/rs/cors"
@@ -23,12 +28,30 @@ func router(config clientConfig) *mux.Router {
 	authMiddleware := negroni.HandlerFunc(ShotgunAuthMiddleware(config))
 
 	entityRoutes := mux.NewRouter()
+	entityRoutes.Path("/debug/vars").HandlerFunc(debugVarsHandler).Methods("GET")
+	entityRoutes.Path("/_webhooks").HandlerFunc(webhookListHandler(config)).Methods("GET")
+	entityRoutes.Path("/_webhooks").HandlerFunc(webhookCreateHandler(config)).Methods("POST")
+	entityRoutes.Path("/_webhooks/dead-letters").HandlerFunc(webhookDeadLettersHandler(config)).Methods("GET")
+	entityRoutes.Path("/_webhooks/dead-letters/{id}/redeliver").
+		HandlerFunc(webhookRedeliverHandler(config)).Methods("POST")
+	entityRoutes.Path("/_webhooks/{id}").HandlerFunc(webhookGetHandler(config)).Methods("GET")
+	entityRoutes.Path("/_webhooks/{id}").HandlerFunc(webhookDeleteHandler(config)).Methods("DELETE")
+	entityRoutes.Path("/_webhooks/{id}/deliveries").
+		HandlerFunc(webhookDeliveriesHandler(config)).Methods("GET")
+	entityRoutes.Path("/_search").HandlerFunc(textSearchHandler(config)).Methods("GET")
+	entityRoutes.Path("/_events").HandlerFunc(eventStreamHandler(config)).Methods("GET")
+	entityRoutes.Path("/_live").HandlerFunc(liveQueryHandler(config)).Methods("GET")
+	entityRoutes.Path("/graphql").HandlerFunc(graphqlHandler(config)).Methods("POST")
 	entityRoutes.Path("/{entity_type}/{id:[0-9]+}").HandlerFunc(entityGetHandler(config)).Methods("GET")
 	entityRoutes.Path("/{entity_type}/{id:[0-9]+}").HandlerFunc(entityUpdateHandler(config)).Methods("PATCH")
 	entityRoutes.Path("/{entity_type}/{id:[0-9]+}").
 		HandlerFunc(entityDeleteHandler(config)).Methods("DELETE")
 	entityRoutes.Path("/{entity_type}/{id:[0-9]+}/revive").
 		HandlerFunc(entityReviveHandler(config)).Methods("POST")
+	entityRoutes.Path("/{entity_type}/{id:[0-9]+}/activity").
+		HandlerFunc(entityActivityHandler(config)).Methods("GET")
+	entityRoutes.Path("/Note/{id:[0-9]+}/thread").
+		HandlerFunc(noteThreadHandler(config)).Methods("GET")
 	// entityRoutes.Path("/{entity_type}/{id:[0-9]+}/followers").
 	// 	HandlerFunc(entityGetFollowersHandler(config)).Methods("GET")
 	//entityRoutes.Path("/{entity_type}/{id:[0-9]+}/followers").
@@ -36,8 +59,13 @@ func router(config clientConfig) *mux.Router {
 	//entityRoutes.Path("/{entity_type}/{id:[0-9]+}/followers/{user_type}/{user_id:[0-9]+}").
 	//		       HandlerFunc(entityDeleteFollowersHandler(config)).Methods("DELETE")
 	entityRoutes.Path("/{entity_type}/summarize").HandlerFunc(entitySummarizeHandler(config)).Methods("GET")
+	entityRoutes.Path("/{entity_type}/_upsert").HandlerFunc(entityUpsertHandler(config)).Methods("POST")
+	entityRoutes.Path("/{entity_type}/_import").HandlerFunc(entityImportHandler(config)).Methods("POST")
 	entityRoutes.Path("/{entity_type}").HandlerFunc(entityGetAllHandler(config)).Methods("GET")
 	entityRoutes.Path("/{entity_type}").HandlerFunc(entityCreateHandler(config)).Methods("POST")
+	entityRoutes.Path("/{entity_type}").HandlerFunc(entityUpsertHandler(config)).Methods("PUT")
+	entityRoutes.Path("/{entity_type}").HandlerFunc(entityBulkUpdateHandler(config)).Methods("PATCH")
+	entityRoutes.Path("/{entity_type}").HandlerFunc(entityBulkDeleteHandler(config)).Methods("DELETE")
 
 	// Adds auth on the sub router so that / can be accessed freely.
 	r.PathPrefix("/{entity_type}").Handler(negroni.New(
@@ -48,6 +76,27 @@ func router(config clientConfig) *mux.Router {
 	return r
 }
 
+// debugVars are the expvars shown on /debug/vars. The defaults aren't,
+// cmdline would show --script-key.
+var debugVars = []string{"shotgun_coalescing"}
+
+// publishCoalescing shows how many Shotgun calls were shared on /debug/vars.
+func publishCoalescing(coalescer *shotgun.Coalescer) {
+	expvar.Publish("shotgun_coalescing", expvar.Func(func() interface{} {
+		return coalescer.Stats()
+	}))
+}
+
+func debugVarsHandler(rw http.ResponseWriter, req *http.Request) {
+	vars := make(map[string]json.RawMessage)
+	for _, name := range debugVars {
+		if v := expvar.Get(name); v != nil {
+			vars[name] = json.RawMessage(v.String())
+		}
+	}
+	writeJSON(rw, http.StatusOK, vars)
+}
+
 func main() {
 	f, err := os.OpenFile("sg-restful.log", os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
 	if err != nil {
@@ -72,12 +121,208 @@ func main() {
 			Usage:  "Port to listen on",
 			EnvVar: "PORT",
 		},
+		cli.StringFlag{
+			Name:   "grpc-port",
+			Value:  "",
+			Usage:  "Port the gRPC API listens on, empty is disabled",
+			EnvVar: "SG_GRPC_PORT",
+		},
 		cli.StringFlag{
 			Name:   "shotgun-host, s",
 			Value:  "",
 			Usage:  "Shotgun host",
 			EnvVar: "SG_HOST",
 		},
+		cli.DurationFlag{
+			Name:   "shotgun-timeout",
+			Value:  time.Minute,
+			Usage:  "How long a Shotgun call can take before the request is a 504, 0 is no limit",
+			EnvVar: "SG_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "shotgun-method-timeouts",
+			Value:  "",
+			Usage:  "Timeouts for single Shotgun methods. ie: read=30s,summarize=2m",
+			EnvVar: "SG_METHOD_TIMEOUTS",
+		},
+		cli.IntFlag{
+			Name:   "shotgun-retries",
+			Value:  2,
+			Usage:  "Times a read, summarize, info or schema call is retried when Shotgun is unreachable or answers 502, 503 or 504",
+			EnvVar: "SG_RETRIES",
+		},
+		cli.DurationFlag{
+			Name:   "shotgun-retry-backoff",
+			Value:  100 * time.Millisecond,
+			Usage:  "Wait before the first retry, it doubles after each up to 2s",
+			EnvVar: "SG_RETRY_BACKOFF",
+		},
+		cli.IntFlag{
+			Name:   "shotgun-breaker-threshold",
+			Value:  5,
+			Usage:  "Shotgun failures in a row before requests fail fast with 503, 0 is never",
+			EnvVar: "SG_BREAKER_THRESHOLD",
+		},
+		cli.DurationFlag{
+			Name:   "shotgun-breaker-cooldown",
+			Value:  30 * time.Second,
+			Usage:  "How long requests fail fast before Shotgun is tried again",
+			EnvVar: "SG_BREAKER_COOLDOWN",
+		},
+		cli.IntFlag{
+			Name:   "shotgun-max-idle-conns",
+			Value:  32,
+			Usage:  "Idle connections kept open to Shotgun",
+			EnvVar: "SG_MAX_IDLE_CONNS",
+		},
+		cli.DurationFlag{
+			Name:   "shotgun-idle-conn-timeout",
+			Value:  90 * time.Second,
+			Usage:  "How long an idle connection to Shotgun is kept",
+			EnvVar: "SG_IDLE_CONN_TIMEOUT",
+		},
+		cli.DurationFlag{
+			Name:   "shotgun-keep-alive",
+			Value:  30 * time.Second,
+			Usage:  "TCP keep-alive period of connections to Shotgun, 0 is off",
+			EnvVar: "SG_KEEP_ALIVE",
+		},
+		cli.BoolTFlag{
+			Name:   "shotgun-http2",
+			Usage:  "Use HTTP/2 with Shotgun when it supports it",
+			EnvVar: "SG_HTTP2",
+		},
+		cli.StringFlag{
+			Name:   "shotgun-proxy",
+			Value:  "",
+			Usage:  "Proxy url for Shotgun, empty uses HTTP_PROXY/HTTPS_PROXY/NO_PROXY",
+			EnvVar: "SG_PROXY",
+		},
+		cli.StringFlag{
+			Name:   "shotgun-ca-file",
+			Value:  "",
+			Usage:  "PEM bundle of CAs to trust for Shotgun along with the system's",
+			EnvVar: "SG_CA_FILE",
+		},
+		cli.StringFlag{
+			Name:   "shotgun-cert-file",
+			Value:  "",
+			Usage:  "Client certificate for Shotgun",
+			EnvVar: "SG_CERT_FILE",
+		},
+		cli.StringFlag{
+			Name:   "shotgun-key-file",
+			Value:  "",
+			Usage:  "Key of the client certificate",
+			EnvVar: "SG_KEY_FILE",
+		},
+		cli.BoolTFlag{
+			Name:   "coalesce-reads",
+			Usage:  "Share one Shotgun call between identical reads made at the same time",
+			EnvVar: "SG_COALESCE_READS",
+		},
+		cli.StringFlag{
+			Name:   "cache",
+			Value:  "",
+			Usage:  "Cache reads, summaries and schema in memory or redis, ie: memory or redis://localhost:6379/0",
+			EnvVar: "SG_CACHE",
+		},
+		cli.IntFlag{
+			Name:   "cache-size",
+			Value:  10000,
+			Usage:  "Most responses the memory cache keeps",
+			EnvVar: "SG_CACHE_SIZE",
+		},
+		cli.DurationFlag{
+			Name:   "cache-ttl",
+			Value:  time.Minute,
+			Usage:  "How long responses are cached",
+			EnvVar: "SG_CACHE_TTL",
+		},
+		cli.StringFlag{
+			Name:   "cache-ttls",
+			Value:  "",
+			Usage:  "How long responses of single entity types are cached, 0 is not at all. Writes only drop their own type, so types read through dotted link or reverse fields need a short one. ie: Version=10s,schema=10m",
+			EnvVar: "SG_CACHE_TTLS",
+		},
+		cli.StringFlag{
+			Name:   "cache-event-types",
+			Value:  "",
+			Usage:  "Entity types whose cached responses are dropped when the event log changes them, needs --script-name",
+			EnvVar: "SG_CACHE_EVENT_TYPES",
+		},
+		cli.DurationFlag{
+			Name:   "event-poll-interval",
+			Value:  2 * time.Second,
+			Usage:  "How often the event log is polled for change feeds",
+			EnvVar: "SG_EVENT_POLL_INTERVAL",
+		},
+		cli.IntFlag{
+			Name:   "bulk-max-affected",
+			Value:  500,
+			Usage:  "Most entities a bulk update or retire can change, 0 is no limit",
+			EnvVar: "SG_BULK_MAX_AFFECTED",
+		},
+		cli.IntFlag{
+			Name:   "stream-page-size",
+			Value:  500,
+			Usage:  "Json reads of pages this big or bigger are streamed without an ETag, 0 is never",
+			EnvVar: "SG_STREAM_PAGE_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "live-query-origins",
+			Value:  "",
+			Usage:  "Origins browsers can open live queries from besides this host. ie: https://tracker.example.com",
+			EnvVar: "SG_LIVE_QUERY_ORIGINS",
+		},
+		cli.IntFlag{
+			Name:   "live-query-max-results",
+			Value:  5000,
+			Usage:  "Most entities a live query can start with, 0 is no limit",
+			EnvVar: "SG_LIVE_QUERY_MAX_RESULTS",
+		},
+		cli.StringFlag{
+			Name:   "script-name",
+			Value:  "",
+			Usage:  "Script name used for background work. ie: webhooks",
+			EnvVar: "SG_SCRIPT_NAME",
+		},
+		cli.StringFlag{
+			Name:   "script-key",
+			Value:  "",
+			Usage:  "Script key used for background work",
+			EnvVar: "SG_SCRIPT_KEY",
+		},
+		cli.StringFlag{
+			Name:   "webhook-store",
+			Value:  "webhooks.json",
+			Usage:  "File webhook registrations are kept in",
+			EnvVar: "SG_WEBHOOK_STORE",
+		},
+		cli.DurationFlag{
+			Name:   "graphql-schema-refresh",
+			Value:  10 * time.Minute,
+			Usage:  "How often the GraphQL schema is rebuilt from Shotgun's, 0 is never",
+			EnvVar: "SG_GRAPHQL_SCHEMA_REFRESH",
+		},
+		cli.IntFlag{
+			Name:   "graphql-max-depth",
+			Value:  5,
+			Usage:  "How deeply GraphQL queries can nest fields, 0 is no limit",
+			EnvVar: "SG_GRAPHQL_MAX_DEPTH",
+		},
+		cli.IntFlag{
+			Name:   "graphql-max-links",
+			Value:  5000,
+			Usage:  "Most linked entities a GraphQL query can read, 0 is no limit",
+			EnvVar: "SG_GRAPHQL_MAX_LINKS",
+		},
+		cli.IntFlag{
+			Name:   "webhook-max-attempts",
+			Value:  5,
+			Usage:  "Number of times a webhook delivery is tried",
+			EnvVar: "SG_WEBHOOK_MAX_ATTEMPTS",
+		},
 	}
 
 	app.Action = func(c *cli.Context) {
@@ -86,11 +331,101 @@ func main() {
 			log.Fatalln("Shotgun host not set.")
 		}
 		log.Infof("Shotgun Host: %v", c.String("shotgun-host"))
+		transport, err := newTransport(transportConfig{
+			MaxIdleConnsPerHost: c.Int("shotgun-max-idle-conns"),
+			IdleConnTimeout:     c.Duration("shotgun-idle-conn-timeout"),
+			KeepAlive:           c.Duration("shotgun-keep-alive"),
+			HTTP2:               c.BoolT("shotgun-http2"),
+			Proxy:               c.String("shotgun-proxy"),
+			CAFile:              c.String("shotgun-ca-file"),
+			CertFile:            c.String("shotgun-cert-file"),
+			KeyFile:             c.String("shotgun-key-file"),
+		})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		shotgunHTTPClient = &http.Client{Transport: transport}
+
 		config := newClientConfig(Version, c.String("shotgun-host"))
+		config.eventPollInterval = c.Duration("event-poll-interval")
+		config.shotgunTimeout = c.Duration("shotgun-timeout")
+		methodTimeouts, err := parseDurations(c.String("shotgun-method-timeouts"))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		config.shotgunMethodTimeouts = methodTimeouts
+		config.shotgunRetry.Retries = c.Int("shotgun-retries")
+		config.shotgunRetry.Backoff = c.Duration("shotgun-retry-backoff")
+		config.shotgunBreaker = shotgun.NewBreaker(c.Int("shotgun-breaker-threshold"), c.Duration("shotgun-breaker-cooldown"))
+		if c.BoolT("coalesce-reads") {
+			publishCoalescing(config.shotgunCoalescer)
+		} else {
+			config.shotgunCoalescer = nil
+		}
+		config.bulkMaxAffected = c.Int("bulk-max-affected")
+		config.streamPageSize = c.Int("stream-page-size")
+		config.liveQueryOrigins = splitList(c.String("live-query-origins"))
+		config.liveQueryMaxResults = c.Int("live-query-max-results")
+		config.shotgunCache, err = newCache(c.String("cache"), c.Int("cache-size"))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		config.shotgunCacheTTL = c.Duration("cache-ttl")
+		config.shotgunCacheTTLs, err = parseDurations(c.String("cache-ttls"))
+		if err != nil {
+			log.Fatalln(err)
+		}
+		config.graphql.Refresh = c.Duration("graphql-schema-refresh")
+		config.graphqlMaxDepth = c.Int("graphql-max-depth")
+		config.graphqlMaxLinks = c.Int("graphql-max-links")
+
+		if c.String("script-name") != "" {
+			store, err := newWebhookStore(c.String("webhook-store"))
+			if err != nil {
+				log.Fatalln("Could not load webhook store: ", err)
+			}
+			sg := NewShotgun(config.shotgunHost, c.String("script-name"), c.String("script-key"))
+			sg.Timeout = config.shotgunTimeout
+			sg.MethodTimeouts = config.shotgunMethodTimeouts
+			sg.Retry = config.shotgunRetry
+			sg.Breaker = config.shotgunBreaker
+			sg.Coalescer = config.shotgunCoalescer
+			sg.Cache = config.shotgunCache
+			sg.CacheTTL = config.shotgunCacheTTL
+			sg.CacheTTLs = config.shotgunCacheTTLs
+			sgConnKey := connectionKey(config.shotgunHost, false, c.String("script-name"), c.String("script-key"))
+			config.webhooks = newWebhookDispatcher(sg, sgConnKey, store, config.eventPollInterval)
+			config.webhooks.MaxAttempts = c.Int("webhook-max-attempts")
+			config.webhooks.Start()
+
+			config.graphql.sg = &sg
+			if err := config.graphql.Load(sg); err != nil {
+				log.Error("Could not load GraphQL schema: ", err)
+			}
+
+			if cacheEventTypes := splitList(c.String("cache-event-types")); config.shotgunCache != nil && len(cacheEventTypes) > 0 {
+				go invalidateFromEvents(config.shotgunCache, sgConnKey, sg, config.eventPollInterval, cacheEventTypes, nil)
+			}
+		} else {
+			log.Info("No script credentials, webhooks and GraphQL are disabled.")
+		}
 
 		qpm := GetQPManager()
 		qpm.SetActiveParsers("format1", "format2", "format3")
 
+		if c.String("grpc-port") != "" {
+			listener, err := net.Listen("tcp", ":"+c.String("grpc-port"))
+			if err != nil {
+				log.Fatalln("Could not listen for gRPC: ", err)
+			}
+			log.Infof("gRPC listening on %v", listener.Addr())
+			go func() {
+				if err := newGRPCServer(config).Serve(listener); err != nil {
+					log.Error("gRPC server stopped: ", err)
+				}
+			}()
+		}
+
 		r := router(config)
 		corsMiddleware := cors.AllowAll()
 
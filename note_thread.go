@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+// Response Structs
+type noteThreadResponse struct {
+	Results   []map[string]interface{} `json:"results"`
+	Exception bool                     `json:"exception,omitempty"`
+	Message   string                   `json:"message,omitempty"`
+	ErrorCode int                      `json:"error_code,omitempty"`
+}
+
+// Query Structs
+type noteThreadQuery struct {
+	NoteID       int                 `json:"note_id"`
+	EntityFields map[string][]string `json:"entity_fields,omitempty"`
+}
+
+// Handlers
+
+// noteThreadHandler returns a note with its replies and attachments. Shotgun
+// exposes this as 'note_thread_contents', which is what the python api's
+// note_thread_read uses.
+func noteThreadHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling noteThreadHandler")
+		vars := mux.Vars(req)
+
+		var noteID int
+		var err error
+		noteIDStr, ok := vars["id"]
+		if ok {
+			noteID, err = strconv.Atoi(noteIDStr)
+			if err != nil {
+				rw.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		} else {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, "Id missing")
+			return
+		}
+		log.Debugf("Note: %d", noteID)
+
+		req.ParseForm()
+
+		query := noteThreadQuery{
+			NoteID:       noteID,
+			EntityFields: entityFieldsParams(req),
+		}
+
+		log.Debugf("Query: %v", StructToString(query))
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+
+		sgReq, err := sg.Request("note_thread_contents", query)
+		if err != nil {
+			log.Error("Request Error: ", err)
+			writeShotgunError(rw, err, http.StatusInternalServerError)
+			return
+		}
+		defer sgReq.Body.Close()
+
+		var threadResp noteThreadResponse
+		respBody, err := ioutil.ReadAll(sgReq.Body)
+		if err != nil {
+			log.Error(err)
+			writeShotgunError(rw, err, http.StatusBadGateway)
+			return
+		}
+		err = json.Unmarshal(respBody, &threadResp)
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		log.Debugf("Response: %v", threadResp)
+
+		if threadResp.Exception {
+			if strings.Contains(threadResp.Message, "Permission") {
+				rw.WriteHeader(http.StatusForbidden)
+			} else if strings.Contains(threadResp.Message, "does not exist") {
+				rw.WriteHeader(http.StatusNotFound)
+			} else {
+				rw.WriteHeader(http.StatusBadRequest)
+			}
+			rw.Write(bytes.NewBufferString(threadResp.Message).Bytes())
+			return
+		}
+
+		if len(threadResp.Results) == 0 {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		jsonResp, err := json.Marshal(threadResp.Results)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(jsonResp)
+	}
+}
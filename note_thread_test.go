@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoteThreadSimple(t *testing.T) {
+	req := getRequest("/Note/7/thread?fields[Note]=tasks&fields[Reply]=content")
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"note_thread_contents": `{"results":[{"type":"Note","id":7,"content":"Looks good"},{"type":"Reply","id":3,"content":"Thanks"}]}`,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var jsonResp []map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &jsonResp)
+	assert.Nil(t, err)
+	assert.Len(t, jsonResp, 2)
+
+	sent := calls.Method("note_thread_contents")
+	assert.Len(t, sent, 1)
+	assert.Equal(t, float64(7), sent[0].Query["note_id"])
+	assert.Equal(t, map[string]interface{}{
+		"Note":  []interface{}{"tasks"},
+		"Reply": []interface{}{"content"},
+	}, sent[0].Query["entity_fields"])
+}
+
+func TestNoteThreadOnlyNotes(t *testing.T) {
+	req := getRequest("/Shot/7/thread")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200, `foo`)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestNoteThreadEmpty(t *testing.T) {
+	req := getRequest("/Note/7000/thread")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200, `{"results":[]}`)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestNoteThreadPermission(t *testing.T) {
+	req := getRequest("/Note/7/thread")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200,
+		`{"exception":true,"message":"API note_thread_contents() Permission denied","error_code":100}`)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -47,6 +47,31 @@ func parseQuery(queryStr string) (readFilters, error) {
 	}
 }
 
+// parseTypeQueries parses 'q' and 'q[<type>]' from the request's form for
+// each of the entity types. 'q[<type>]' overrides 'q' for that type. Types
+// without a query are left out of the returned map.
+func parseTypeQueries(req *http.Request, entityTypes []string) (map[string]readFilters, error) {
+	typeFilters := make(map[string]readFilters)
+	typeQueries := bracketParams(req.Form, "q")
+	for _, entityType := range entityTypes {
+		queryStr, ok := typeQueries[entityType]
+		if !ok {
+			queryStr = req.FormValue("q")
+		}
+
+		if queryStr == "" {
+			continue
+		}
+
+		queryFilters, err := parseQuery(queryStr)
+		if err != nil {
+			return typeFilters, err
+		}
+		typeFilters[entityType] = queryFilters
+	}
+	return typeFilters, nil
+}
+
 //
 // func parseQuery(queryStr string) (readFilters, error) {
 // 	query := newReadFilters()
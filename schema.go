@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/brandonvfx/sg-restful/shotgun"
+)
+
+// schemaField is the part of a field's schema that is checked against.
+type schemaField struct {
+	DataType    string
+	Editable    bool
+	ValidTypes  []string
+	ValidValues []string
+}
+
+func newSchemaField(info shotgun.SchemaField) schemaField {
+	return schemaField{
+		DataType:    info.DataType.Value,
+		Editable:    info.Editable.Value,
+		ValidTypes:  info.Properties.ValidTypes.Value,
+		ValidValues: info.Properties.ValidValues.Value,
+	}
+}
+
+// readFieldSchema reads the schema of every field of an entity type.
+func readFieldSchema(sg Shotgun, entityType string) (map[string]schemaField, error) {
+	fields, err := sg.Client().SchemaFieldRead(sg.Context(), entityType)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := make(map[string]schemaField)
+	for name, info := range fields {
+		schema[name] = newSchemaField(info)
+	}
+	return schema, nil
+}
+
+// readSchema reads the fields of every entity type.
+func readSchema(sg Shotgun) (map[string]map[string]schemaField, error) {
+	entityTypes, err := sg.Client().SchemaRead(sg.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	schema := make(map[string]map[string]schemaField)
+	for entityType, fields := range entityTypes {
+		schema[entityType] = make(map[string]schemaField)
+		for name, info := range fields {
+			schema[entityType][name] = newSchemaField(info)
+		}
+	}
+	return schema, nil
+}
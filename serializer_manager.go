@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+/*
+The SerializerI type is an interface for response formats.
+
+The SerializerManager stores a map of named SerializerI pointers, one per format supported by sg-restful.
+
+To add a new format, one must implement the interface and register an instance with the SerializerManager.
+
+func init() {
+   manager := GetSerializerManager()
+   manager.AddSerializer("myformat", &MyFormat{})
+}
+
+A format is picked per request with the 'format' param, ie: 'format=csv', or the Accept header. Without either
+the response is json.
+*/
+
+// SerializerI interface must be satisfied to add a response format.
+type SerializerI interface {
+	// Media types the format is served as, the first is the Content-Type.
+	MediaTypes() []string
+	// Serialize a list of entities or rows. Formats with columns put the
+	// columns first, the rest follow sorted.
+	Serialize(entities []map[string]interface{}, columns []string) ([]byte, error)
+	// Serialize a single entity.
+	SerializeOne(entity map[string]interface{}, columns []string) ([]byte, error)
+}
+
+// StreamSerializerI is for formats that can write entities as they're read,
+// big reads are streamed with them.
+type StreamSerializerI interface {
+	SerializerI
+	// StreamEntities writes the entities next returns until it returns nil.
+	StreamEntities(w io.Writer, next func() (json.RawMessage, error)) error
+}
+
+// SerializerManager keeps track of response formats.
+type SerializerManager struct {
+	serializers map[string]SerializerI
+}
+
+// AddSerializer accepts a pointer to an object which implements the
+// SerializerI interface and adds it to the internal map of formats.
+func (sm *SerializerManager) AddSerializer(name string, serializer SerializerI) {
+	if sm.serializers == nil {
+		sm.serializers = make(map[string]SerializerI)
+	}
+	sm.serializers[name] = serializer
+}
+
+// GetSerializer returns the format with the name.
+func (sm *SerializerManager) GetSerializer(name string) (SerializerI, bool) {
+	serializer, ok := sm.serializers[name]
+	return serializer, ok
+}
+
+// GetSerializerNames returns the sorted names of the formats.
+func (sm *SerializerManager) GetSerializerNames() []string {
+	names := make([]string, 0, len(sm.serializers))
+	for name := range sm.serializers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// forMediaType finds the format for a media type from an Accept header.
+func (sm *SerializerManager) forMediaType(mediaType string) (string, bool) {
+	if mediaType == "*/*" || mediaType == "application/*" {
+		return "json", true
+	}
+	for _, name := range sm.GetSerializerNames() {
+		for _, candidate := range sm.serializers[name].MediaTypes() {
+			if candidate == mediaType {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Negotiate picks the format for a request, 'format' wins over Accept. The
+// status to respond with is returned when there isn't one.
+func (sm *SerializerManager) Negotiate(req *http.Request) (string, SerializerI, int) {
+	// Not FormValue, that would read a form encoded body.
+	if format := req.URL.Query().Get("format"); format != "" {
+		serializer, ok := sm.GetSerializer(format)
+		if !ok {
+			return "", nil, http.StatusBadRequest
+		}
+		return format, serializer, http.StatusOK
+	}
+
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		serializer, _ := sm.GetSerializer("json")
+		return "json", serializer, http.StatusOK
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(mediaRange))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if qStr, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(qStr, 64); err != nil {
+				continue
+			}
+		}
+		name, ok := sm.forMediaType(mediaType)
+		if ok && q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	if best == "" {
+		return "", nil, http.StatusNotAcceptable
+	}
+	serializer, _ := sm.GetSerializer(best)
+	return best, serializer, http.StatusOK
+}
+
+var serializerManagerPtr *SerializerManager
+
+// GetSerializerManager returns a pointer to the SerializerManager, which is
+// responsible for keeping track of response formats.
+func GetSerializerManager() *SerializerManager {
+	if serializerManagerPtr == nil {
+		serializerManagerPtr = &SerializerManager{}
+	}
+	log.Debug("GetSerializerManager() returning", serializerManagerPtr)
+	return serializerManagerPtr
+}
+
+// negotiateFormat picks the format for a request, writing the error when
+// there isn't one.
+func negotiateFormat(rw http.ResponseWriter, req *http.Request) (string, SerializerI, bool) {
+	manager := GetSerializerManager()
+	name, serializer, status := manager.Negotiate(req)
+	rw.Header().Add("Vary", "Accept")
+	if status != http.StatusOK {
+		rw.WriteHeader(status)
+		rw.Write([]byte("Formats: " + strings.Join(manager.GetSerializerNames(), ", ") + "\n"))
+		return "", nil, false
+	}
+	return name, serializer, true
+}
@@ -0,0 +1,453 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const xlsxMediaType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// Cell styles, indexes into cellXfs in xlsxStyles.
+const (
+	xlsxStyleNone = iota
+	xlsxStyleBold
+	xlsxStyleDate
+	xlsxStyleDateTime
+)
+
+// summarySerializer is implemented by formats that render summaries
+// themselves rather than as the rows from flattenSummary.
+type summarySerializer interface {
+	SerializeSummary(title string, groupings []grouping, results summaryResponse) ([]byte, error)
+}
+
+// XLSXSerializer writes an Excel workbook with a sheet per query. Only what
+// a sheet of results needs is written so it isn't worth a dependency.
+type XLSXSerializer struct{}
+
+// MediaTypes of xlsx.
+func (s *XLSXSerializer) MediaTypes() []string {
+	return []string{xlsxMediaType}
+}
+
+// Serialize entities as a sheet named for their type with a header row.
+func (s *XLSXSerializer) Serialize(entities []map[string]interface{}, columns []string) ([]byte, error) {
+	title := "Results"
+	rows := make([]map[string]interface{}, len(entities))
+	for i, entity := range entities {
+		if entityType, ok := entity["type"].(string); ok && i == 0 {
+			title = entityType
+		}
+		rows[i] = xlsxEntity(entity)
+	}
+	header := rowColumns(rows, columns)
+
+	sheet := newXLSXSheet(title, header)
+	for _, row := range rows {
+		cells := make([]interface{}, len(header))
+		for i, column := range header {
+			cells[i] = row[column]
+		}
+		sheet.addRow(cells, 0, false)
+	}
+	return sheet.workbook()
+}
+
+// SerializeOne entity as a sheet with a single row.
+func (s *XLSXSerializer) SerializeOne(entity map[string]interface{}, columns []string) ([]byte, error) {
+	return s.Serialize([]map[string]interface{}{entity}, columns)
+}
+
+// SerializeSummary writes a row per group with its subtotals, the rows of
+// nested groups are outlined under it and the totals come last.
+func (s *XLSXSerializer) SerializeSummary(title string, groupings []grouping, results summaryResponse) ([]byte, error) {
+	summaryFields := summaryColumns(results)
+	header := []string{}
+	for _, group := range groupings {
+		header = append(header, group.Field)
+	}
+	header = append(header, summaryFields...)
+
+	sheet := newXLSXSheet(title, header)
+	var walk func(groups []groupResponse, depth int)
+	walk = func(groups []groupResponse, depth int) {
+		for _, group := range groups {
+			cells := make([]interface{}, len(header))
+			if depth < len(groupings) {
+				cells[depth] = group.GroupName
+			}
+			for i, field := range summaryFields {
+				cells[len(groupings)+i] = xlsxValue(group.Summaries[field])
+			}
+			// Groups with groups under them are subtotals.
+			sheet.addRow(cells, depth, len(group.Groups) > 0)
+			walk(group.Groups, depth+1)
+		}
+	}
+	walk(results.Groups, 0)
+
+	totals := make([]interface{}, len(header))
+	if len(groupings) > 0 {
+		totals[0] = "Total"
+	}
+	for i, field := range summaryFields {
+		totals[len(groupings)+i] = xlsxValue(results.Summaries[field])
+	}
+	sheet.addRow(totals, 0, true)
+	return sheet.workbook()
+}
+
+// summaryColumns lists the summarized fields, sorted.
+func summaryColumns(results summaryResponse) []string {
+	seen := make(map[string]bool)
+	var add func(summaries map[string]interface{}, groups []groupResponse)
+	add = func(summaries map[string]interface{}, groups []groupResponse) {
+		for field := range summaries {
+			seen[field] = true
+		}
+		for _, group := range groups {
+			add(group.Summaries, group.Groups)
+		}
+	}
+	add(results.Summaries, results.Groups)
+
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// xlsxEntity turns links into their names so cells read like the Shotgun UI.
+func xlsxEntity(entity map[string]interface{}) map[string]interface{} {
+	row := make(map[string]interface{})
+	for key, value := range entity {
+		row[key] = xlsxValue(value)
+	}
+	return row
+}
+
+// xlsxValue is the cell value for a field value.
+func xlsxValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if text, ok := linkText(value); ok {
+			return text
+		}
+		return cellString(value)
+	case []interface{}:
+		texts := make([]string, len(value))
+		for i, item := range value {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				if text, ok := linkText(itemMap); ok {
+					texts[i] = text
+					continue
+				}
+			}
+			texts[i] = cellString(item)
+		}
+		return strings.Join(texts, ", ")
+	}
+	return value
+}
+
+// linkText is the name of a linked entity, or its type and id when it
+// doesn't have one.
+func linkText(entity map[string]interface{}) (string, bool) {
+	entityType, typeOK := entity["type"].(string)
+	id, idOK := entity["id"].(float64)
+	if !typeOK || !idOK {
+		return "", false
+	}
+	if name, ok := entity["name"].(string); ok && name != "" {
+		return name, true
+	}
+	if code, ok := entity["code"].(string); ok && code != "" {
+		return code, true
+	}
+	return fmt.Sprintf("%s %d", entityType, int(id)), true
+}
+
+// xlsxSheet builds the xml of a single worksheet.
+type xlsxSheet struct {
+	title    string
+	header   []string
+	rows     bytes.Buffer
+	rowCount int
+	maxDepth int
+	// Distinct values of status list columns, for their drop downs.
+	statuses map[int]map[string]bool
+}
+
+func newXLSXSheet(title string, header []string) *xlsxSheet {
+	sheet := &xlsxSheet{title: title, header: header, statuses: make(map[int]map[string]bool)}
+	cells := make([]interface{}, len(header))
+	for i, column := range header {
+		cells[i] = column
+		if strings.HasSuffix(column, "status_list") {
+			sheet.statuses[i] = make(map[string]bool)
+		}
+	}
+	sheet.addRow(cells, 0, true)
+	return sheet
+}
+
+// addRow writes a row of cells, depth is its outline level.
+func (sheet *xlsxSheet) addRow(cells []interface{}, depth int, bold bool) {
+	sheet.rowCount++
+	if depth > sheet.maxDepth {
+		sheet.maxDepth = depth
+	}
+
+	fmt.Fprintf(&sheet.rows, `<row r="%d"`, sheet.rowCount)
+	if depth > 0 {
+		fmt.Fprintf(&sheet.rows, ` outlineLevel="%d"`, depth)
+	}
+	sheet.rows.WriteString(">")
+
+	for i, value := range cells {
+		ref := xlsxColumn(i) + strconv.Itoa(sheet.rowCount)
+		style := xlsxStyleNone
+		if bold {
+			style = xlsxStyleBold
+		}
+		if statuses, ok := sheet.statuses[i]; ok && sheet.rowCount > 1 {
+			if status, isString := value.(string); isString && status != "" {
+				statuses[status] = true
+			}
+		}
+
+		switch value := value.(type) {
+		case nil:
+			continue
+		case float64:
+			fmt.Fprintf(&sheet.rows, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, strconv.FormatFloat(value, 'f', -1, 64))
+		case bool:
+			boolValue := 0
+			if value {
+				boolValue = 1
+			}
+			fmt.Fprintf(&sheet.rows, `<c r="%s" s="%d" t="b"><v>%d</v></c>`, ref, style, boolValue)
+		case string:
+			if value == "" {
+				continue
+			}
+			if serial, dateStyle, ok := xlsxDate(value); ok && sheet.rowCount > 1 {
+				fmt.Fprintf(&sheet.rows, `<c r="%s" s="%d"><v>%s</v></c>`, ref, dateStyle, strconv.FormatFloat(serial, 'f', -1, 64))
+				continue
+			}
+			fmt.Fprintf(&sheet.rows, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xmlEscape(value))
+		default:
+			fmt.Fprintf(&sheet.rows, `<c r="%s" s="%d" t="inlineStr"><is><t>%s</t></is></c>`, ref, style, xmlEscape(cellString(value)))
+		}
+	}
+	sheet.rows.WriteString("</row>")
+}
+
+// worksheet is the xml of the sheet.
+func (sheet *xlsxSheet) worksheet() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	// Subtotals are above the rows they summarize.
+	buf.WriteString(`<sheetPr><outlinePr summaryBelow="0"/></sheetPr>`)
+	buf.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	fmt.Fprintf(&buf, `<sheetFormatPr defaultRowHeight="15" outlineLevelRow="%d"/>`, sheet.maxDepth)
+	buf.WriteString("<sheetData>")
+	buf.Write(sheet.rows.Bytes())
+	buf.WriteString("</sheetData>")
+
+	if lists := sheet.lists(); len(lists) > 0 {
+		fmt.Fprintf(&buf, `<dataValidations count="%d">`, len(lists))
+		for i, list := range lists {
+			column := xlsxColumn(list.column)
+			listColumn := xlsxColumn(i)
+			fmt.Fprintf(&buf, `<dataValidation type="list" allowBlank="1" sqref="%s2:%s%d"><formula1>'%s'!$%s$1:$%s$%d</formula1></dataValidation>`,
+				column, column, sheet.rowCount, xlsxListsSheet, listColumn, listColumn, len(list.values))
+		}
+		buf.WriteString("</dataValidations>")
+	}
+
+	buf.WriteString("</worksheet>")
+	return buf.Bytes()
+}
+
+// xlsxListsSheet is the hidden sheet holding the values of the drop downs.
+// Inline lists are limited to 255 characters and can't hold commas.
+const xlsxListsSheet = "_lists"
+
+// xlsxList is the values of a status list column's drop down.
+type xlsxList struct {
+	column int
+	values []string
+}
+
+// lists are the drop downs of the status list columns with values, in
+// column order.
+func (sheet *xlsxSheet) lists() []xlsxList {
+	if sheet.rowCount <= 1 {
+		return nil
+	}
+	lists := make([]xlsxList, 0, len(sheet.statuses))
+	for i, statuses := range sheet.statuses {
+		if len(statuses) == 0 {
+			continue
+		}
+		list := xlsxList{column: i, values: make([]string, 0, len(statuses))}
+		for value := range statuses {
+			list.values = append(list.values, value)
+		}
+		sort.Strings(list.values)
+		lists = append(lists, list)
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].column < lists[j].column })
+	return lists
+}
+
+// listsWorksheet is the xml of the hidden sheet with a column per list.
+func listsWorksheet(lists []xlsxList) []byte {
+	rows := 0
+	for _, list := range lists {
+		if len(list.values) > rows {
+			rows = len(list.values)
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	buf.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for row := 0; row < rows; row++ {
+		fmt.Fprintf(&buf, `<row r="%d">`, row+1)
+		for i, list := range lists {
+			if row < len(list.values) {
+				fmt.Fprintf(&buf, `<c r="%s%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`,
+					xlsxColumn(i), row+1, xmlEscape(list.values[row]))
+			}
+		}
+		buf.WriteString("</row>")
+	}
+	buf.WriteString("</sheetData></worksheet>")
+	return buf.Bytes()
+}
+
+// workbook zips the sheet into a workbook, with the hidden lists sheet when
+// it has drop downs.
+func (sheet *xlsxSheet) workbook() ([]byte, error) {
+	type part struct {
+		name string
+		body []byte
+	}
+	contentTypes, sheets, rels := "", "", ""
+	var extra []part
+	if lists := sheet.lists(); len(lists) > 0 {
+		contentTypes = xlsxListsContentType
+		sheets = fmt.Sprintf(xlsxListsSheetEntry, xlsxListsSheet)
+		rels = xlsxListsRel
+		extra = append(extra, part{"xl/worksheets/sheet2.xml", listsWorksheet(lists)})
+	}
+
+	parts := []part{
+		{"[Content_Types].xml", []byte(fmt.Sprintf(xlsxContentTypes, contentTypes))},
+		{"_rels/.rels", []byte(xlsxRels)},
+		{"xl/workbook.xml", []byte(fmt.Sprintf(xlsxWorkbook, xmlEscape(xlsxSheetName(sheet.title)), sheets))},
+		{"xl/_rels/workbook.xml.rels", []byte(fmt.Sprintf(xlsxWorkbookRels, rels))},
+		{"xl/styles.xml", []byte(xlsxStyles)},
+		{"xl/worksheets/sheet1.xml", sheet.worksheet()},
+	}
+	parts = append(parts, extra...)
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	for _, part := range parts {
+		w, err := writer.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// xlsxColumn is the letters of the column at index, ie: 0 is A, 26 is AA.
+func xlsxColumn(index int) string {
+	letters := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		letters = string(rune('A'+(index-1)%26)) + letters
+	}
+	return letters
+}
+
+// xlsxEpoch is day 0 of Excel's dates.
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxDate converts Shotgun dates and date times to Excel's serial dates.
+func xlsxDate(value string) (float64, int, bool) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		return date.Sub(xlsxEpoch).Hours() / 24, xlsxStyleDate, true
+	}
+	if dateTime, err := time.Parse(time.RFC3339, value); err == nil {
+		return dateTime.UTC().Sub(xlsxEpoch).Seconds() / 86400, xlsxStyleDateTime, true
+	}
+	return 0, 0, false
+}
+
+// xlsxSheetName makes title a valid sheet name.
+func xlsxSheetName(title string) string {
+	title = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, title)
+	if runes := []rune(title); len(runes) > 31 {
+		title = string(runes[:31])
+	}
+	if title == "" || title == xlsxListsSheet {
+		title = "Results"
+	}
+	return title
+}
+
+func xmlEscape(value string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(value))
+	return buf.String()
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/><Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>%s</Types>`
+
+const xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+const xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/>%s</sheets></workbook>`
+
+const xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/><Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>%s</Relationships>`
+
+const xlsxListsContentType = `<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`
+
+const xlsxListsSheetEntry = `<sheet name="%s" sheetId="2" state="hidden" r:id="rId3"/>`
+
+const xlsxListsRel = `<Relationship Id="rId3" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>`
+
+// xlsxStyles has the cell styles in the order of the xlsxStyle constants.
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts><fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts><fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills><borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders><cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs><cellXfs count="4"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/><xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs></styleSheet>`
+
+func init() {
+	GetSerializerManager().AddSerializer("xlsx", &XLSXSerializer{})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// xlsxPart reads a part of a workbook.
+func xlsxPart(t *testing.T, body []byte, name string) string {
+	reader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if !assert.NoError(t, err) {
+		return ""
+	}
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
+		}
+		part, err := file.Open()
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer part.Close()
+		data, _ := ioutil.ReadAll(part)
+		return string(data)
+	}
+	t.Errorf("Missing part: %s", name)
+	return ""
+}
+
+func TestFormatXLSX(t *testing.T) {
+	req := getRequest("/Shot?fields=code,project,tasks,sg_status_list,created_at,due_date")
+	req.Header.Set("Accept", xlsxMediaType)
+	w := serveFormat(req, "read",
+		`{"results":{"entities":[{"type":"Shot","id":1,"code":"sh010","project":{"type":"Project","id":65,"name":"Alpha"},"tasks":[{"type":"Task","id":1,"name":"comp"},{"type":"Task","id":2}],"sg_status_list":"ip","created_at":"2017-05-04T12:00:00Z","due_date":"2017-05-04"},{"type":"Shot","id":2,"code":"a<b","project":null,"tasks":[],"sg_status_list":"fin","created_at":null,"due_date":null}],"paging_info":{"current_page":1,"page_count":1,"entity_count":2,"entities_per_page":500}}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, xlsxMediaType, w.Header().Get("Content-Type"))
+
+	body := w.Body.Bytes()
+	assert.Contains(t, xlsxPart(t, body, "xl/workbook.xml"), `<sheet name="Shot"`)
+	sheet := xlsxPart(t, body, "xl/worksheets/sheet1.xml")
+	// Header
+	assert.Contains(t, sheet, `<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">type</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="C1" s="1" t="inlineStr"><is><t xml:space="preserve">code</t></is></c>`)
+	// Numbers, links, dates
+	assert.Contains(t, sheet, `<c r="B2" s="0"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<c r="D2" s="0" t="inlineStr"><is><t xml:space="preserve">Alpha</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="E2" s="0" t="inlineStr"><is><t xml:space="preserve">comp, Task 2</t></is></c>`)
+	assert.Contains(t, sheet, `<c r="G2" s="3"><v>42859.5</v></c>`)
+	assert.Contains(t, sheet, `<c r="H2" s="2"><v>42859</v></c>`)
+	assert.Contains(t, sheet, `a&lt;b`)
+	// Status lists
+	assert.Contains(t, sheet, `<dataValidation type="list" allowBlank="1" sqref="F2:F3"><formula1>'_lists'!$A$1:$A$2</formula1></dataValidation>`)
+	assert.Contains(t, xlsxPart(t, body, "xl/workbook.xml"), `<sheet name="_lists" sheetId="2" state="hidden" r:id="rId3"/>`)
+	lists := xlsxPart(t, body, "xl/worksheets/sheet2.xml")
+	assert.Contains(t, lists, `<c r="A1" t="inlineStr"><is><t xml:space="preserve">fin</t></is></c>`)
+	assert.Contains(t, lists, `<c r="A2" t="inlineStr"><is><t xml:space="preserve">ip</t></is></c>`)
+}
+
+func TestFormatXLSXLongLists(t *testing.T) {
+	var entities bytes.Buffer
+	for i := 0; i < 100; i++ {
+		if i > 0 {
+			entities.WriteString(",")
+		}
+		fmt.Fprintf(&entities, `{"type":"Shot","id":%d,"sg_status_list":"status %03d, pending","sg_other_status_list":"x"}`, i+1, i)
+	}
+	req := getRequest("/Shot?format=xlsx&fields=sg_status_list,sg_other_status_list")
+	w := serveFormat(req, "read", `{"results":{"entities":[`+entities.String()+`],"paging_info":{"entity_count":100}}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.Bytes()
+	sheet := xlsxPart(t, body, "xl/worksheets/sheet1.xml")
+	assert.Contains(t, sheet, `<dataValidations count="2">`)
+	assert.Contains(t, sheet, `sqref="C2:C101"><formula1>'_lists'!$A$1:$A$100</formula1>`)
+	assert.Contains(t, sheet, `sqref="D2:D101"><formula1>'_lists'!$B$1:$B$1</formula1>`)
+	lists := xlsxPart(t, body, "xl/worksheets/sheet2.xml")
+	assert.Contains(t, lists, `<c r="A100" t="inlineStr"><is><t xml:space="preserve">status 099, pending</t></is></c>`)
+}
+
+func TestFormatXLSXWithoutLists(t *testing.T) {
+	w := serveFormat(getRequest("/Shot?format=xlsx&fields=code"), "read", serializerShots)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, xlsxPart(t, w.Body.Bytes(), "xl/workbook.xml"), "_lists")
+	reader, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	assert.Nil(t, err)
+	assert.Len(t, reader.File, 6)
+}
+
+func TestXLSXSheetName(t *testing.T) {
+	assert.Equal(t, "Shot", xlsxSheetName("Shot"))
+	assert.Equal(t, "a_b_c", xlsxSheetName("a/b:c"))
+	assert.Equal(t, "Results", xlsxSheetName(""))
+	assert.Equal(t, "Results", xlsxSheetName("_lists"))
+	// 31 characters, not bytes.
+	assert.Equal(t, strings.Repeat("é", 31), xlsxSheetName(strings.Repeat("é", 40)))
+}
+
+func TestFormatXLSXSummarize(t *testing.T) {
+	query := url.Values{}
+	query.Set("format", "xlsx")
+	query.Set("summaries", `[{"field":"id","type":"count"}]`)
+	query.Set("grouping", `[{"field":"sg_status_list","type":"exact","direction":"asc"},{"field":"sg_sequence","type":"exact","direction":"asc"}]`)
+	w := serveFormat(getRequest("/Shot/summarize?"+query.Encode()), "summarize",
+		`{"results":{"summaries":{"id":3},"groups":[{"group_value":"ip","group_name":"In Progress","summaries":{"id":3},"groups":[{"group_value":"a","group_name":"seq_a","summaries":{"id":1}},{"group_value":"b","group_name":"seq_b","summaries":{"id":2}}]}]}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, xlsxMediaType, w.Header().Get("Content-Type"))
+
+	sheet := xlsxPart(t, w.Body.Bytes(), "xl/worksheets/sheet1.xml")
+	assert.Contains(t, sheet, `outlineLevelRow="1"`)
+	// Subtotal
+	assert.Contains(t, sheet, `<row r="2"><c r="A2" s="1" t="inlineStr"><is><t xml:space="preserve">In Progress</t></is></c><c r="C2" s="1"><v>3</v></c></row>`)
+	// Nested groups
+	assert.Contains(t, sheet, `<row r="4" outlineLevel="1"><c r="B4" s="0" t="inlineStr"><is><t xml:space="preserve">seq_b</t></is></c><c r="C4" s="0"><v>2</v></c></row>`)
+	// Totals
+	assert.Contains(t, sheet, `<row r="5"><c r="A5" s="1" t="inlineStr"><is><t xml:space="preserve">Total</t></is></c><c r="C5" s="1"><v>3</v></c></row>`)
+}
+
+func TestXLSXColumn(t *testing.T) {
+	assert.Equal(t, "A", xlsxColumn(0))
+	assert.Equal(t, "Z", xlsxColumn(25))
+	assert.Equal(t, "AA", xlsxColumn(26))
+	assert.Equal(t, "AZ", xlsxColumn(51))
+	assert.Equal(t, "BA", xlsxColumn(52))
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// flattenEntity flattens linked entities and other objects into
+// 'field.key' columns, ie: 'project.type', 'project.id' and 'project.name'.
+// The values of multi-entity fields are joined with ', '.
+func flattenEntity(entity map[string]interface{}) map[string]interface{} {
+	row := make(map[string]interface{})
+	for key, value := range entity {
+		switch value := value.(type) {
+		case map[string]interface{}:
+			for subKey, subValue := range value {
+				row[key+"."+subKey] = flatValue(subValue)
+			}
+		case []interface{}:
+			// Every item has a value in every sub column, empty when it
+			// doesn't have the key, so the values line up.
+			subKeys := make(map[string]bool)
+			for _, item := range value {
+				if itemMap, ok := item.(map[string]interface{}); ok {
+					for subKey := range itemMap {
+						subKeys[subKey] = true
+					}
+				}
+			}
+			joined := make(map[string][]string)
+			for _, item := range value {
+				if itemMap, ok := item.(map[string]interface{}); ok {
+					for subKey := range subKeys {
+						joined[key+"."+subKey] = append(joined[key+"."+subKey], cellString(itemMap[subKey]))
+					}
+				} else {
+					joined[key] = append(joined[key], cellString(item))
+				}
+			}
+			if len(value) == 0 {
+				row[key] = ""
+			}
+			for column, values := range joined {
+				row[column] = strings.Join(values, ", ")
+			}
+		default:
+			row[key] = value
+		}
+	}
+	return row
+}
+
+// flatValue leaves scalars alone and turns anything else into json.
+func flatValue(value interface{}) interface{} {
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return cellString(value)
+	}
+	return value
+}
+
+// cellString formats a flattened value for a text cell.
+func cellString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(jsonValue)
+}
+
+// columnRank orders the columns of a linked entity.
+var columnRank = map[string]int{"type": 0, "id": 1, "name": 2}
+
+// rowColumns lists every column in rows. The leading columns go first, along
+// with the 'column.*' columns flattened from them, then the rest sorted.
+// Columns are never both bare and flattened.
+func rowColumns(rows []map[string]interface{}, leading []string) []string {
+	all := make(map[string]bool)
+	for _, row := range rows {
+		for column := range row {
+			all[column] = true
+		}
+	}
+	// An empty link in one row leaves a bare column next to the flattened
+	// ones from the other rows.
+	for column := range all {
+		if i := strings.Index(column, "."); i > 0 {
+			delete(all, column[:i])
+		}
+	}
+
+	columns := make([]string, 0, len(all))
+	used := make(map[string]bool)
+	for _, lead := range leading {
+		if all[lead] && !used[lead] {
+			columns = append(columns, lead)
+			used[lead] = true
+		}
+		sub := []string{}
+		for column := range all {
+			if !used[column] && strings.HasPrefix(column, lead+".") {
+				sub = append(sub, column)
+			}
+		}
+		sort.Slice(sub, func(i, j int) bool {
+			ri, iOK := columnRank[strings.TrimPrefix(sub[i], lead+".")]
+			rj, jOK := columnRank[strings.TrimPrefix(sub[j], lead+".")]
+			if iOK && jOK {
+				return ri < rj
+			} else if iOK != jOK {
+				return iOK
+			}
+			return sub[i] < sub[j]
+		})
+		for _, column := range sub {
+			columns = append(columns, column)
+			used[column] = true
+		}
+	}
+
+	rest := []string{}
+	for column := range all {
+		if !used[column] {
+			rest = append(rest, column)
+		}
+	}
+	sort.Strings(rest)
+	return append(columns, rest...)
+}
+
+// flattenSummary turns summarize results into rows, one per innermost group
+// with a column per grouping field and summary, then a row of the totals.
+func flattenSummary(groupings []grouping, results summaryResponse) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0)
+	var walk func(groups []groupResponse, depth int, parents map[string]interface{})
+	walk = func(groups []groupResponse, depth int, parents map[string]interface{}) {
+		for _, group := range groups {
+			row := make(map[string]interface{})
+			for key, value := range parents {
+				row[key] = value
+			}
+			if depth < len(groupings) {
+				row[groupings[depth].Field] = group.GroupName
+			}
+			if len(group.Groups) > 0 {
+				walk(group.Groups, depth+1, row)
+				continue
+			}
+			for key, value := range group.Summaries {
+				row[key] = flatValue(value)
+			}
+			rows = append(rows, row)
+		}
+	}
+	walk(results.Groups, 0, map[string]interface{}{})
+
+	totals := make(map[string]interface{})
+	for key, value := range results.Summaries {
+		totals[key] = flatValue(value)
+	}
+	return append(rows, totals)
+}
+
+// JSONSerializer is the default format.
+type JSONSerializer struct{}
+
+// MediaTypes of json.
+func (s *JSONSerializer) MediaTypes() []string {
+	return []string{"application/json"}
+}
+
+// Serialize entities as a json array.
+func (s *JSONSerializer) Serialize(entities []map[string]interface{}, columns []string) ([]byte, error) {
+	return json.Marshal(entities)
+}
+
+// SerializeOne entity as a json object.
+func (s *JSONSerializer) SerializeOne(entity map[string]interface{}, columns []string) ([]byte, error) {
+	return json.Marshal(entity)
+}
+
+// StreamEntities as a json array.
+func (s *JSONSerializer) StreamEntities(w io.Writer, next func() (json.RawMessage, error)) error {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; ; i++ {
+		entity, err := next()
+		if err != nil {
+			return err
+		}
+		if entity == nil {
+			break
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := json.Compact(&buf, entity); err != nil {
+			return err
+		}
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		buf.Reset()
+	}
+	buf.WriteByte(']')
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// CSVSerializer writes flattened entities with a header row.
+type CSVSerializer struct{}
+
+// csvCell formats a cell, text that a spreadsheet would run as a formula is
+// prefixed with a quote so it's shown as text.
+func csvCell(value interface{}) string {
+	cell := cellString(value)
+	if _, ok := value.(string); ok && cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// MediaTypes of csv.
+func (s *CSVSerializer) MediaTypes() []string {
+	return []string{"text/csv"}
+}
+
+// Serialize entities as rows.
+func (s *CSVSerializer) Serialize(entities []map[string]interface{}, columns []string) ([]byte, error) {
+	rows := make([]map[string]interface{}, len(entities))
+	for i, entity := range entities {
+		rows[i] = flattenEntity(entity)
+	}
+	header := rowColumns(rows, columns)
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	writer.Write(header)
+	for _, row := range rows {
+		record := make([]string, len(header))
+		for i, column := range header {
+			record[i] = csvCell(row[column])
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+// SerializeOne entity as a single row.
+func (s *CSVSerializer) SerializeOne(entity map[string]interface{}, columns []string) ([]byte, error) {
+	return s.Serialize([]map[string]interface{}{entity}, columns)
+}
+
+// NDJSONSerializer writes one json object per line.
+type NDJSONSerializer struct{}
+
+// MediaTypes of ndjson.
+func (s *NDJSONSerializer) MediaTypes() []string {
+	return []string{"application/x-ndjson", "application/ndjson"}
+}
+
+// Serialize entities a line each.
+func (s *NDJSONSerializer) Serialize(entities []map[string]interface{}, columns []string) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, entity := range entities {
+		if err := encoder.Encode(entity); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// SerializeOne entity as a single line.
+func (s *NDJSONSerializer) SerializeOne(entity map[string]interface{}, columns []string) ([]byte, error) {
+	return s.Serialize([]map[string]interface{}{entity}, columns)
+}
+
+// StreamEntities a line each.
+func (s *NDJSONSerializer) StreamEntities(w io.Writer, next func() (json.RawMessage, error)) error {
+	var buf bytes.Buffer
+	for {
+		entity, err := next()
+		if err != nil || entity == nil {
+			return err
+		}
+		if err := json.Compact(&buf, entity); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+		if _, err := w.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		buf.Reset()
+	}
+}
+
+// YAMLSerializer writes yaml.
+type YAMLSerializer struct{}
+
+// MediaTypes of yaml.
+func (s *YAMLSerializer) MediaTypes() []string {
+	return []string{"application/x-yaml", "application/yaml", "text/yaml"}
+}
+
+// Serialize entities as a yaml sequence.
+func (s *YAMLSerializer) Serialize(entities []map[string]interface{}, columns []string) ([]byte, error) {
+	return marshalYAML(entities)
+}
+
+// SerializeOne entity as a yaml mapping.
+func (s *YAMLSerializer) SerializeOne(entity map[string]interface{}, columns []string) ([]byte, error) {
+	return marshalYAML(entity)
+}
+
+// marshalYAML writes value in block style indented by two spaces.
+func marshalYAML(value interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Register the formats with the manager
+func init() {
+	manager := GetSerializerManager()
+	manager.AddSerializer("json", &JSONSerializer{})
+	manager.AddSerializer("csv", &CSVSerializer{})
+	manager.AddSerializer("ndjson", &NDJSONSerializer{})
+	manager.AddSerializer("yaml", &YAMLSerializer{})
+}
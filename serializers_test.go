@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yaml.in/yaml/v3"
+)
+
+const serializerShots = `{"results":{"entities":[{"type":"Shot","id":1,"code":"sh010","project":{"type":"Project","id":65,"name":"Alpha"},"tasks":[{"type":"Task","id":1,"name":"comp"},{"type":"Task","id":2,"name":"roto"}]},{"type":"Shot","id":2,"code":"sh020","project":null,"tasks":[]}],"paging_info":{"current_page":1,"page_count":1,"entity_count":2,"entities_per_page":500}}}`
+
+func serveFormat(req *http.Request, method, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	server, client, config, _ := mockShotgunMethods(map[string]string{method: body})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	return w
+}
+
+func TestFormatCSV(t *testing.T) {
+	w := serveFormat(getRequest("/Shot?format=csv&fields=code,project,tasks"), "read", serializerShots)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Equal(t, []string{
+		"type,id,code,project.type,project.id,project.name,tasks.type,tasks.id,tasks.name",
+		`Shot,1,sh010,Project,65,Alpha,"Task, Task","1, 2","comp, roto"`,
+		"Shot,2,sh020,,,,,,",
+	}, lines)
+}
+
+func TestFormatNDJSON(t *testing.T) {
+	req := getRequest("/Shot?fields=code")
+	req.Header.Set("Accept", "application/x-ndjson")
+	w := serveFormat(req, "read", serializerShots)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "{"))
+	assert.Contains(t, lines[1], `"code":"sh020"`)
+}
+
+func TestFormatYAMLOne(t *testing.T) {
+	req := getRequest("/Shot/1?fields=code,project,tasks")
+	req.Header.Set("Accept", "text/html")
+	w := serveFormat(req, "read", serializerShots)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+
+	req = getRequest("/Shot/1?fields=code,project,tasks")
+	req.Header.Set("Accept", "application/json;q=0.5, application/yaml")
+	w = serveFormat(req, "read", serializerShots)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-yaml", w.Header().Get("Content-Type"))
+	assert.Equal(t, `code: sh010
+id: 1
+project:
+  id: 65
+  name: Alpha
+  type: Project
+tasks:
+  - id: 1
+    name: comp
+    type: Task
+  - id: 2
+    name: roto
+    type: Task
+type: Shot
+`, w.Body.String())
+}
+
+func TestFormatUnknown(t *testing.T) {
+	w := serveFormat(getRequest("/Shot?format=xml"), "read", serializerShots)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Formats: csv, json, ndjson, xlsx, yaml")
+
+	req := getRequest("/Shot")
+	req.Header.Set("Accept", "*/*")
+	w = serveFormat(req, "read", serializerShots)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
+
+func TestFormatSummarizeCSV(t *testing.T) {
+	query := url.Values{}
+	query.Set("format", "csv")
+	query.Set("summaries", `[{"field":"id","type":"count"}]`)
+	query.Set("grouping", `[{"field":"sg_status_list","type":"exact","direction":"asc"}]`)
+	w := serveFormat(getRequest("/Shot/summarize?"+query.Encode()), "summarize",
+		`{"results":{"summaries":{"id":3},"groups":[{"group_value":"ip","group_name":"In Progress","summaries":{"id":2}},{"group_value":"fin","group_name":"Final","summaries":{"id":1}}]}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+	assert.Equal(t, "sg_status_list,id\nIn Progress,2\nFinal,1\n,3\n", w.Body.String())
+}
+
+func TestFormatYAMLQuoting(t *testing.T) {
+	w := serveFormat(getRequest("/Shot/1?format=yaml&fields=code,description,sg_cut_in"), "read",
+		`{"results":{"entities":[{"type":"Shot","id":1,"code":"yes","description":"a: b","sg_cut_in":"10"}],"paging_info":{"entity_count":1}}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var entity map[string]interface{}
+	assert.Nil(t, yaml.Unmarshal(w.Body.Bytes(), &entity))
+	assert.Equal(t, map[string]interface{}{"type": "Shot", "id": 1, "code": "yes", "description": "a: b", "sg_cut_in": "10"}, entity)
+}
+
+func TestFormatCSVFormulas(t *testing.T) {
+	w := serveFormat(getRequest("/Shot?format=csv&fields=code,description,sg_cut_in"), "read",
+		`{"results":{"entities":[{"type":"Shot","id":1,"code":"=HYPERLINK(\"http://example.com\")","description":"@SUM(A1)","sg_cut_in":-5},{"type":"Shot","id":2,"code":"+1","description":"-1","sg_cut_in":5},{"type":"Shot","id":3,"code":"\t=1+1","description":"\r=1+1","sg_cut_in":1}],"paging_info":{"entity_count":3}}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Equal(t, []string{
+		"type,id,code,description,sg_cut_in",
+		`Shot,1,"'=HYPERLINK(""http://example.com"")",'@SUM(A1),-5`,
+		"Shot,2,'+1,'-1,5",
+		"Shot,3,'\t=1+1,\"'\r=1+1\",1",
+	}, lines)
+}
+
+func TestFlattenEntityMissingKeys(t *testing.T) {
+	row := flattenEntity(map[string]interface{}{
+		"tasks": []interface{}{
+			map[string]interface{}{"type": "Task", "id": 1.0},
+			map[string]interface{}{"type": "Task", "id": 2.0, "name": "roto"},
+		},
+	})
+	assert.Equal(t, "Task, Task", row["tasks.type"])
+	assert.Equal(t, "1, 2", row["tasks.id"])
+	assert.Equal(t, ", roto", row["tasks.name"])
+}
@@ -1,40 +1,80 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"net/http"
-	"net/url"
-	"strings"
+	"time"
 
+	"github.com/brandonvfx/sg-restful/shotgun"
 	"github.com/sirupsen/logrus"
 	log "github.com/sirupsen/logrus"
 )
 
-const apiPath = "/api3/json"
-
 type Shotgun struct {
 	ServerURL    string
 	ScriptName   string
 	ScriptKey    string
 	UserLogin    string
 	UserPassword string
-	client       http.Client
+	// Timeout and MethodTimeouts limit calls, see shotgun.Client.
+	Timeout        time.Duration
+	MethodTimeouts map[string]time.Duration
+	// Retry and Breaker guard calls against Shotgun being flaky, see
+	// shotgun.Client.
+	Retry   shotgun.RetryPolicy
+	Breaker *shotgun.Breaker
+	// Coalescer shares identical reads made at the same time.
+	Coalescer *shotgun.Coalescer
+	// Cache, CacheTTL and CacheTTLs cache reads, see shotgun.Client.
+	Cache     shotgun.Cache
+	CacheTTL  time.Duration
+	CacheTTLs map[string]time.Duration
+	client    *http.Client
+	ctx       context.Context
 }
 
-func getFullURL(host string) string {
-	if !strings.HasPrefix(host, "http") {
-		log.Errorf("Host must start with http:// or https://")
-		return ""
+// statusClientClosedRequest is the status logged for requests the client
+// went away from before they were done, as nginx does.
+const statusClientClosedRequest = 499
+
+// shotgunErrorStatus is the status for an error calling Shotgun, 499 when
+// the request was canceled, 504 when it timed out, 503 when the breaker is
+// open and status otherwise.
+func shotgunErrorStatus(err error, status int) int {
+	if shotgun.IsCircuitOpen(err) {
+		return http.StatusServiceUnavailable
 	}
+	if shotgun.IsCanceled(err) {
+		return statusClientClosedRequest
+	}
+	if shotgun.IsTimeout(err) {
+		return http.StatusGatewayTimeout
+	}
+	return status
+}
 
-	fullURL, err := url.Parse(host)
+// writeShotgunError writes the status for an error calling Shotgun, with a
+// Retry-After when the breaker is open.
+func writeShotgunError(rw http.ResponseWriter, err error, status int) {
+	shotgunRetryAfter(rw, err)
+	rw.WriteHeader(shotgunErrorStatus(err, status))
+}
+
+// shotgunRetryAfter sets Retry-After when err is the breaker being open, for
+// responses that write their own status.
+func shotgunRetryAfter(rw http.ResponseWriter, err error) {
+	if retryAfter, ok := shotgun.CircuitRetryAfter(err); ok {
+		setRetryAfter(rw, retryAfter)
+	}
+}
+
+func getFullURL(host string) string {
+	fullURL, err := shotgun.URL(host)
 	if err != nil {
 		log.Error(err)
 		return ""
 	}
-	fullURL.Path = apiPath
-	return fullURL.String()
+	return fullURL
 }
 
 func (sg *Shotgun) Log() {
@@ -50,7 +90,7 @@ func NewShotgun(host, scriptName, scriptKey string) Shotgun {
 		ServerURL:  getFullURL(host),
 		ScriptName: scriptName,
 		ScriptKey:  scriptKey,
-		client:     http.Client{},
+		client:     shotgunHTTPClient,
 	}
 }
 
@@ -59,7 +99,7 @@ func NewUserShotgun(host, login, password string) Shotgun {
 		ServerURL:    getFullURL(host),
 		UserLogin:    login,
 		UserPassword: password,
-		client:       http.Client{},
+		client:       shotgunHTTPClient,
 	}
 }
 
@@ -82,26 +122,53 @@ func (sg *Shotgun) Creds() map[string]string {
 	}
 }
 
-func (sg *Shotgun) Request(method_name string, query interface{}) (*http.Response, error) {
-	requestData := make(map[string]interface{})
-	requestData["method_name"] = method_name
-	requestData["params"] = []interface{}{sg.Creds(), query}
+// WithContext is the connection with calls made in ctx, ie: the context of
+// the request being handled so calls stop when it does.
+func (sg *Shotgun) WithContext(ctx context.Context) Shotgun {
+	conn := *sg
+	conn.ctx = ctx
+	return conn
+}
+
+// Context is what calls are made in, context.Background by default.
+func (sg *Shotgun) Context() context.Context {
+	if sg.ctx != nil {
+		return sg.ctx
+	}
+	return context.Background()
+}
+
+// Client is the typed client for the connection.
+func (sg *Shotgun) Client() *shotgun.Client {
+	return &shotgun.Client{
+		ServerURL:      sg.ServerURL,
+		ScriptName:     sg.ScriptName,
+		ScriptKey:      sg.ScriptKey,
+		UserLogin:      sg.UserLogin,
+		UserPassword:   sg.UserPassword,
+		HTTPClient:     sg.client,
+		Timeout:        sg.Timeout,
+		MethodTimeouts: sg.MethodTimeouts,
+		Retry:          sg.Retry,
+		Breaker:        sg.Breaker,
+		Coalescer:      sg.Coalescer,
+		Cache:          sg.Cache,
+		CacheTTL:       sg.CacheTTL,
+		CacheTTLs:      sg.CacheTTLs,
+	}
+}
 
-	bodyJson, err := json.Marshal(requestData)
+func (sg *Shotgun) Request(method_name string, query interface{}) (*http.Response, error) {
 	log.WithFields(logrus.Fields{
 		"method": method_name,
 		"query":  StructToString(query),
 	}).Debug("Request")
-	if err != nil {
-		log.Error("Shotugn.Request Marshal Error: ", err)
-		return &http.Response{}, err
-	}
 
 	log.Debugf("Send Request to: %v", sg.ServerURL)
-	req, err := http.NewRequest("POST", sg.ServerURL, bytes.NewReader(bodyJson))
+	resp, err := sg.Client().Post(sg.Context(), method_name, query)
 	if err != nil {
-		log.Error("Shotugn.Request Http Request Error: ", err)
+		log.Error("Shotugn.Request Error: ", err)
 		return &http.Response{}, err
 	}
-	return sg.client.Do(req)
+	return resp, nil
 }
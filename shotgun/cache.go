@@ -0,0 +1,254 @@
+package shotgun
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SchemaCacheType is the entity type schema calls are cached under, their
+// ttl is set with it, ie: CacheTTLs{"schema": 10 * time.Minute}.
+const SchemaCacheType = "schema"
+
+// Cache stores responses for Client.Cache, ie: a MemoryCache. Responses are
+// kept by entity type so writes can drop them. A cache that can't be reached
+// should act empty.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(entityType, key string, value []byte, ttl time.Duration)
+	// Invalidate drops every response of the entity type.
+	Invalidate(entityType string)
+}
+
+// Cacheable is whether a method's responses can be cached.
+func Cacheable(method string) bool {
+	switch method {
+	case "read", "summarize", "schema_read", "schema_field_read", "schema_entity_read":
+		return true
+	}
+	return false
+}
+
+// TypeCacheTTL is how long responses of an entity type are cached, 0 is
+// not at all.
+func (c *Client) TypeCacheTTL(entityType string) time.Duration {
+	if ttl, ok := c.CacheTTLs[entityType]; ok {
+		return ttl
+	}
+	return c.CacheTTL
+}
+
+// normalize round trips params through json so maps and structs of the
+// same query match.
+func normalize(params interface{}) (interface{}, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var normalized interface{}
+	err = decoder.Decode(&normalized)
+	return normalized, err
+}
+
+// cacheType is the entity type a call's response is cached under.
+func cacheType(method string, params interface{}) string {
+	if strings.HasPrefix(method, "schema_") {
+		return SchemaCacheType
+	}
+	if params, ok := params.(map[string]interface{}); ok {
+		entityType, _ := params["type"].(string)
+		return entityType
+	}
+	return ""
+}
+
+// mutatedTypes are the entity types a call writes to. Cached reads of other
+// types that return their fields through dotted link or reverse fields are
+// not dropped, their ttl bounds how stale those get.
+func mutatedTypes(method string, params interface{}) []string {
+	switch method {
+	case "create", "update", "delete", "revive":
+		if entityType := cacheType(method, params); entityType != "" {
+			return []string{entityType}
+		}
+	case "batch":
+		requests, _ := params.([]interface{})
+		entityTypes := make([]string, 0, len(requests))
+		for _, request := range requests {
+			if request, ok := request.(map[string]interface{}); ok {
+				if entityType, ok := request["type"].(string); ok {
+					entityTypes = append(entityTypes, entityType)
+				}
+			}
+		}
+		return entityTypes
+	}
+	if strings.HasPrefix(method, "schema_") && !Cacheable(method) {
+		return []string{SchemaCacheType}
+	}
+	return nil
+}
+
+// cachedPost answers cacheable calls from the cache, and drops what writes
+// change. A read racing a write can still cache what it read before the
+// write, the ttl bounds how long for.
+func (c *Client) cachedPost(ctx context.Context, method string, params interface{}) (*http.Response, error) {
+	normalized, err := normalize(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if !Cacheable(method) {
+		resp, err := c.coalescedPost(ctx, method, params)
+		// A write that failed may still have been made, ie: it timed out.
+		for _, entityType := range mutatedTypes(method, normalized) {
+			c.Cache.Invalidate(entityType)
+		}
+		return resp, err
+	}
+
+	entityType := cacheType(method, normalized)
+	ttl := c.TypeCacheTTL(entityType)
+	if ttl <= 0 {
+		return c.coalescedPost(ctx, method, params)
+	}
+	key, err := coalesceKey(c.Credentials(), method, normalized)
+	if err != nil {
+		return nil, err
+	}
+	if body, ok := c.Cache.Get(key); ok {
+		return cachedResponse(body), nil
+	}
+
+	resp, err := c.coalescedPost(ctx, method, params)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var env envelope
+	if resp.StatusCode == http.StatusOK && json.Unmarshal(body, &env) == nil && !env.Exception {
+		c.Cache.Set(entityType, key, body, ttl)
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	return resp, nil
+}
+
+// cachedResponse is a response from the cache.
+func cachedResponse(body []byte) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"application/json"}},
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+}
+
+// MemoryCache is an in memory Cache that drops the least recently used
+// response past its size.
+type MemoryCache struct {
+	size int
+
+	lock    sync.Mutex
+	entries *list.List
+	keys    map[string]*list.Element
+	types   map[string]map[string]*list.Element
+}
+
+type memoryEntry struct {
+	entityType string
+	key        string
+	value      []byte
+	expires    time.Time
+}
+
+// NewMemoryCache makes a cache of up to size responses.
+func NewMemoryCache(size int) *MemoryCache {
+	return &MemoryCache{
+		size:    size,
+		entries: list.New(),
+		keys:    make(map[string]*list.Element),
+		types:   make(map[string]map[string]*list.Element),
+	}
+}
+
+// Len is the number of responses cached.
+func (mc *MemoryCache) Len() int {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	return mc.entries.Len()
+}
+
+// Get a response that hasn't expired.
+func (mc *MemoryCache) Get(key string) ([]byte, bool) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	elem, ok := mc.keys[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*memoryEntry)
+	if time.Now().After(entry.expires) {
+		mc.remove(elem)
+		return nil, false
+	}
+	mc.entries.MoveToFront(elem)
+	return entry.value, true
+}
+
+// Set a response, dropping the least recently used past the size.
+func (mc *MemoryCache) Set(entityType, key string, value []byte, ttl time.Duration) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	if elem, ok := mc.keys[key]; ok {
+		mc.remove(elem)
+	}
+	elem := mc.entries.PushFront(&memoryEntry{
+		entityType: entityType,
+		key:        key,
+		value:      value,
+		expires:    time.Now().Add(ttl),
+	})
+	mc.keys[key] = elem
+	if mc.types[entityType] == nil {
+		mc.types[entityType] = make(map[string]*list.Element)
+	}
+	mc.types[entityType][key] = elem
+	for mc.size > 0 && mc.entries.Len() > mc.size {
+		mc.remove(mc.entries.Back())
+	}
+}
+
+// Invalidate drops every response of the entity type.
+func (mc *MemoryCache) Invalidate(entityType string) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+	for _, elem := range mc.types[entityType] {
+		mc.remove(elem)
+	}
+}
+
+func (mc *MemoryCache) remove(elem *list.Element) {
+	entry := mc.entries.Remove(elem).(*memoryEntry)
+	delete(mc.keys, entry.key)
+	delete(mc.types[entry.entityType], entry.key)
+	if len(mc.types[entry.entityType]) == 0 {
+		delete(mc.types, entry.entityType)
+	}
+}
@@ -0,0 +1,133 @@
+package shotgun
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache(2)
+	cache.Set("Shot", "a", []byte("a"), time.Minute)
+	cache.Set("Shot", "b", []byte("b"), time.Minute)
+	value, ok := cache.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "a", string(value))
+
+	// b is the least recently used.
+	cache.Set("Asset", "c", []byte("c"), time.Minute)
+	_, ok = cache.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, cache.Len())
+
+	cache.Invalidate("Shot")
+	_, ok = cache.Get("a")
+	assert.False(t, ok)
+	_, ok = cache.Get("c")
+	assert.True(t, ok)
+
+	cache.Set("Shot", "d", []byte("d"), -time.Second)
+	_, ok = cache.Get("d")
+	assert.False(t, ok)
+	assert.Equal(t, 1, cache.Len())
+}
+
+func TestMutatedTypes(t *testing.T) {
+	params, _ := normalize(map[string]interface{}{"type": "Shot", "id": 1})
+	assert.Equal(t, []string{"Shot"}, mutatedTypes("update", params))
+	assert.Nil(t, mutatedTypes("read", params))
+
+	params, _ = normalize([]BatchRequest{
+		{RequestType: "create", Type: "Shot"},
+		{RequestType: "delete", Type: "Asset"},
+	})
+	assert.Equal(t, []string{"Shot", "Asset"}, mutatedTypes("batch", params))
+
+	assert.Equal(t, []string{SchemaCacheType}, mutatedTypes("schema_field_update", params))
+	assert.Nil(t, mutatedTypes("schema_field_read", params))
+}
+
+func TestCacheable(t *testing.T) {
+	for _, method := range []string{"read", "summarize", "schema_read", "schema_field_read", "schema_entity_read"} {
+		assert.True(t, Cacheable(method), method)
+	}
+	for _, method := range []string{"info", "create", "batch", "schema_field_create", "schema_field_update", "schema_field_delete"} {
+		assert.False(t, Cacheable(method), method)
+	}
+}
+
+func TestCache(t *testing.T) {
+	server, sg, calls := mockServer(func(c call) (int, string) {
+		switch c.Method {
+		case "read":
+			if c.Params.(map[string]interface{})["type"] == "Bad" {
+				return http.StatusOK, `{"exception":true,"message":"API read() invalid entity type","error_code":103}`
+			}
+			return http.StatusOK, `{"results":{"entities":[{"type":"Shot","id":1}],"paging_info":{"entity_count":1}}}`
+		case "schema_field_read":
+			return http.StatusOK, `{"results":{"code":{"data_type":{"value":"text"}}}}`
+		case "update":
+			return http.StatusBadGateway, ""
+		}
+		return http.StatusOK, `{"results":{"type":"Shot","id":2}}`
+	})
+	defer server.Close()
+	cache := NewMemoryCache(100)
+	sg.Cache = cache
+	sg.CacheTTL = time.Minute
+	sg.CacheTTLs = map[string]time.Duration{"Asset": 0}
+	ctx := context.Background()
+
+	count := func(method string) int {
+		n := 0
+		for _, c := range *calls {
+			if c.Method == method {
+				n++
+			}
+		}
+		return n
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := sg.Find(ctx, NewReadQuery("Shot", "code"))
+		assert.Nil(t, err)
+		assert.Len(t, result.Entities, 1)
+	}
+	assert.Equal(t, 1, count("read"))
+
+	// Another user doesn't get the script's responses.
+	user, _ := NewUser(server.URL, "login", "pass")
+	user.Cache = cache
+	user.CacheTTL = time.Minute
+	user.Find(ctx, NewReadQuery("Shot", "code"))
+	assert.Equal(t, 2, count("read"))
+
+	// Writes drop the type.
+	_, err := sg.Create(ctx, "Shot", []FieldValue{{FieldName: "code", Value: "sh020"}})
+	assert.Nil(t, err)
+	sg.Find(ctx, NewReadQuery("Shot", "code"))
+	assert.Equal(t, 3, count("read"))
+
+	// So do writes that fail, they may have been made.
+	_, err = sg.Update(ctx, "Shot", 1, []FieldValue{{FieldName: "code", Value: "sh030"}})
+	assert.NotNil(t, err)
+	sg.Find(ctx, NewReadQuery("Shot", "code"))
+	assert.Equal(t, 4, count("read"))
+
+	// A ttl of 0 isn't cached and neither are exceptions.
+	sg.Find(ctx, NewReadQuery("Asset"))
+	sg.Find(ctx, NewReadQuery("Asset"))
+	sg.Find(ctx, NewReadQuery("Bad"))
+	_, err = sg.Find(ctx, NewReadQuery("Bad"))
+	assert.IsType(t, &Error{}, err)
+	assert.Equal(t, 8, count("read"))
+
+	for i := 0; i < 2; i++ {
+		_, err = sg.SchemaFieldRead(ctx, "Shot")
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, 1, count("schema_field_read"))
+}
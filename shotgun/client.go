@@ -0,0 +1,285 @@
+// Package shotgun is a typed client for Shotgun's json api.
+//
+//	sg, err := shotgun.New("https://example.shotgunstudio.com", "script", "key")
+//	query := shotgun.NewReadQuery("Shot", "code", "sg_status_list")
+//	query.Filters.Add(shotgun.NewCondition("code", "is", "sh010"))
+//	result, err := sg.Find(ctx, query)
+//
+// Exceptions Shotgun returns are *Error, responses that aren't Shotgun's
+// json are *ResponseError.
+package shotgun
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// APIPath is where the json api lives on a Shotgun host.
+const APIPath = "/api3/json"
+
+// Client calls Shotgun's api as a script or a user.
+type Client struct {
+	// ServerURL is the api url, ie: https://example.shotgunstudio.com/api3/json
+	ServerURL    string
+	ScriptName   string
+	ScriptKey    string
+	UserLogin    string
+	UserPassword string
+	// HTTPClient is http.DefaultClient when nil.
+	HTTPClient *http.Client
+	// Timeout limits each call, including reading the response. 0 is no
+	// limit.
+	Timeout time.Duration
+	// MethodTimeouts are timeouts for single methods, ie: {"summarize": 2 * time.Minute}.
+	MethodTimeouts map[string]time.Duration
+	// Retry is how idempotent calls are retried, see Idempotent.
+	Retry RetryPolicy
+	// Breaker fails calls fast while Shotgun is unhealthy, nil never does.
+	Breaker *Breaker
+	// Coalescer shares identical idempotent calls, nil doesn't.
+	Coalescer *Coalescer
+	// Cache answers reads, summaries and schema calls when set, for
+	// CacheTTL or the entity type's CacheTTLs, ie: {"Version": time.Minute}.
+	Cache     Cache
+	CacheTTL  time.Duration
+	CacheTTLs map[string]time.Duration
+}
+
+// URL is the api url of a host.
+func URL(host string) (string, error) {
+	if !strings.HasPrefix(host, "http") {
+		return "", errors.New("Host must start with http:// or https://")
+	}
+
+	fullURL, err := url.Parse(host)
+	if err != nil {
+		return "", err
+	}
+	fullURL.Path = APIPath
+	return fullURL.String(), nil
+}
+
+// New makes a client with script credentials.
+func New(host, scriptName, scriptKey string) (*Client, error) {
+	serverURL, err := URL(host)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{ServerURL: serverURL, ScriptName: scriptName, ScriptKey: scriptKey}, nil
+}
+
+// NewUser makes a client with user credentials.
+func NewUser(host, login, password string) (*Client, error) {
+	serverURL, err := URL(host)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{ServerURL: serverURL, UserLogin: login, UserPassword: password}, nil
+}
+
+// Credentials are the auth params sent with every call, the user's if
+// there is one.
+func (c *Client) Credentials() map[string]string {
+	if c.UserLogin != "" {
+		return map[string]string{
+			"user_login":    c.UserLogin,
+			"user_password": c.UserPassword,
+		}
+	}
+	return map[string]string{
+		"script_name": c.ScriptName,
+		"script_key":  c.ScriptKey,
+	}
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// MethodTimeout is the timeout of a method, 0 is no limit.
+func (c *Client) MethodTimeout(method string) time.Duration {
+	if timeout, ok := c.MethodTimeouts[method]; ok {
+		return timeout
+	}
+	return c.Timeout
+}
+
+// Post sends a call and returns the response as is. The caller closes the
+// body. The method's timeout runs until the body is read or closed and
+// covers every retry.
+func (c *Client) Post(ctx context.Context, method string, params interface{}) (*http.Response, error) {
+	if c.Cache != nil {
+		return c.cachedPost(ctx, method, params)
+	}
+	return c.coalescedPost(ctx, method, params)
+}
+
+func (c *Client) coalescedPost(ctx context.Context, method string, params interface{}) (*http.Response, error) {
+	if c.Coalescer == nil || !Idempotent(method) {
+		return c.post(ctx, method, params)
+	}
+	key, err := coalesceKey(c.Credentials(), method, params)
+	if err != nil {
+		return nil, err
+	}
+	return c.Coalescer.do(ctx, key, func(ctx context.Context) (*http.Response, error) {
+		return c.post(ctx, method, params)
+	})
+}
+
+func (c *Client) post(ctx context.Context, method string, params interface{}) (*http.Response, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"method_name": method,
+		"params":      []interface{}{c.Credentials(), params},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	parent := ctx
+	cancel := context.CancelFunc(func() {})
+	if timeout := c.MethodTimeout(method); timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	retries := 0
+	if Idempotent(method) {
+		retries = c.Retry.Retries
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest("POST", c.ServerURL, bytes.NewReader(body))
+		if err != nil {
+			cancel()
+			c.Breaker.release()
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := c.httpClient().Do(req.WithContext(ctx))
+		if err != nil && parent.Err() != nil {
+			// The caller gave up, that says nothing about Shotgun.
+			cancel()
+			c.Breaker.release()
+			return nil, err
+		}
+		c.Breaker.record(err != nil || resp.StatusCode >= 500)
+
+		retry := attempt < retries && ctx.Err() == nil &&
+			(err != nil || retryStatus(resp.StatusCode)) &&
+			c.Breaker.RetryAfter() == 0
+		if !retry {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		wait := c.Retry.wait(attempt, resp)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			cancel()
+			return nil, &url.Error{Op: "Post", URL: c.ServerURL, Err: ctx.Err()}
+		case <-timer.C:
+		}
+		// The retry is a trial again if the breaker has half opened.
+		if err := c.Breaker.allow(); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+}
+
+// cancelBody releases a call's timeout once its body is done with.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.cancel()
+	}
+	return n, err
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// envelope is how every response is wrapped.
+type envelope struct {
+	Results   json.RawMessage `json:"results"`
+	Exception bool            `json:"exception"`
+	Message   string          `json:"message"`
+	ErrorCode int             `json:"error_code"`
+}
+
+// call sends a call and returns the body and its envelope.
+func (c *Client) call(ctx context.Context, method string, params interface{}) ([]byte, envelope, error) {
+	var env envelope
+	resp, err := c.Post(ctx, method, params)
+	if err != nil {
+		return nil, env, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, env, &ResponseError{Method: method, StatusCode: resp.StatusCode, Err: err}
+	}
+	if err := json.Unmarshal(body, &env); err != nil {
+		if resp.StatusCode >= 400 {
+			err = fmt.Errorf("%s", http.StatusText(resp.StatusCode))
+		}
+		return nil, env, &ResponseError{Method: method, StatusCode: resp.StatusCode, Err: err}
+	}
+	if env.Exception {
+		return nil, env, &Error{Method: method, Code: env.ErrorCode, Message: env.Message}
+	}
+	if resp.StatusCode >= 400 {
+		return nil, env, &ResponseError{Method: method, StatusCode: resp.StatusCode, Err: errors.New(http.StatusText(resp.StatusCode))}
+	}
+	return body, env, nil
+}
+
+// Call sends a call and decodes its results into results, which can be nil.
+func (c *Client) Call(ctx context.Context, method string, params interface{}, results interface{}) error {
+	_, env, err := c.call(ctx, method, params)
+	if err != nil {
+		return err
+	}
+	if results == nil || len(env.Results) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(env.Results, results); err != nil {
+		return &ResponseError{Method: method, StatusCode: http.StatusOK, Err: err}
+	}
+	return nil
+}
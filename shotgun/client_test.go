@@ -0,0 +1,149 @@
+package shotgun
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// call is a call received by a mock server.
+type call struct {
+	Method string
+	Creds  map[string]interface{}
+	Params interface{}
+}
+
+// mockServer answers every call with respond and records them.
+func mockServer(respond func(c call) (int, string)) (*httptest.Server, *Client, *[]call) {
+	calls := &[]call{}
+	var lock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var request struct {
+			MethodName string        `json:"method_name"`
+			Params     []interface{} `json:"params"`
+		}
+		json.Unmarshal(body, &request)
+		c := call{Method: request.MethodName, Creds: request.Params[0].(map[string]interface{}), Params: request.Params[1]}
+		lock.Lock()
+		*calls = append(*calls, c)
+		lock.Unlock()
+
+		status, respBody := respond(c)
+		w.WriteHeader(status)
+		fmt.Fprint(w, respBody)
+	}))
+
+	client, _ := New(server.URL, "fake-script", "fake-key")
+	return server, client, calls
+}
+
+func TestURL(t *testing.T) {
+	fullURL, err := URL("https://example.shotgunstudio.com")
+	assert.Nil(t, err)
+	assert.Equal(t, "https://example.shotgunstudio.com/api3/json", fullURL)
+
+	_, err = URL("example.shotgunstudio.com")
+	assert.NotNil(t, err)
+
+	_, err = New("example.shotgunstudio.com", "script", "key")
+	assert.NotNil(t, err)
+}
+
+func TestCredentials(t *testing.T) {
+	sg, _ := New("http://localhost", "script", "key")
+	assert.Equal(t, map[string]string{"script_name": "script", "script_key": "key"}, sg.Credentials())
+
+	sg, _ = NewUser("http://localhost", "login", "pass")
+	assert.Equal(t, map[string]string{"user_login": "login", "user_password": "pass"}, sg.Credentials())
+}
+
+func TestCall(t *testing.T) {
+	server, sg, calls := mockServer(func(c call) (int, string) {
+		return http.StatusOK, `{"results":{"id":1}}`
+	})
+	defer server.Close()
+
+	var results map[string]interface{}
+	err := sg.Call(context.Background(), "create", map[string]interface{}{"type": "Shot"}, &results)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"id": float64(1)}, results)
+	if assert.Len(t, *calls, 1) {
+		assert.Equal(t, "create", (*calls)[0].Method)
+		assert.Equal(t, map[string]interface{}{"script_name": "fake-script", "script_key": "fake-key"}, (*calls)[0].Creds)
+		assert.Equal(t, map[string]interface{}{"type": "Shot"}, (*calls)[0].Params)
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	server, sg, _ := mockServer(func(c call) (int, string) {
+		switch c.Method {
+		case "read":
+			return http.StatusOK, `{"exception":true,"message":"Can't authenticate script 'fake-script'","error_code":102}`
+		case "update":
+			return http.StatusBadGateway, `<html>Bad Gateway</html>`
+		}
+		return http.StatusServiceUnavailable, `{}`
+	})
+	defer server.Close()
+
+	err := sg.Call(context.Background(), "read", nil, nil)
+	assert.Equal(t, &Error{Method: "read", Code: 102, Message: "Can't authenticate script 'fake-script'"}, err)
+	assert.Equal(t, "Can't authenticate script 'fake-script'", err.Error())
+	assert.True(t, IsAuthentication(err))
+
+	err = sg.Call(context.Background(), "update", nil, nil)
+	if assert.IsType(t, &ResponseError{}, err) {
+		assert.Equal(t, http.StatusBadGateway, err.(*ResponseError).StatusCode)
+		assert.Equal(t, "shotgun update: bad response (502): Bad Gateway", err.Error())
+	}
+
+	err = sg.Call(context.Background(), "delete", nil, nil)
+	if assert.IsType(t, &ResponseError{}, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, err.(*ResponseError).StatusCode)
+	}
+	assert.False(t, IsAuthentication(err))
+}
+
+func TestCallCanceled(t *testing.T) {
+	server, sg, calls := mockServer(func(c call) (int, string) {
+		return http.StatusOK, `{"results":true}`
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := sg.Delete(ctx, "Shot", 1)
+	assert.True(t, IsCanceled(err))
+	assert.False(t, IsTimeout(err))
+	assert.Len(t, *calls, 0)
+}
+
+func TestCallTimeout(t *testing.T) {
+	server, sg, _ := mockServer(func(c call) (int, string) {
+		time.Sleep(100 * time.Millisecond)
+		return http.StatusOK, `{"results":true}`
+	})
+	defer server.Close()
+
+	sg.Timeout = time.Minute
+	sg.MethodTimeouts = map[string]time.Duration{"delete": 10 * time.Millisecond}
+	assert.Equal(t, 10*time.Millisecond, sg.MethodTimeout("delete"))
+	assert.Equal(t, time.Minute, sg.MethodTimeout("read"))
+
+	_, err := sg.Delete(context.Background(), "Shot", 1)
+	assert.True(t, IsTimeout(err))
+	assert.False(t, IsCanceled(err))
+
+	revived, err := sg.Revive(context.Background(), "Shot", 1)
+	assert.Nil(t, err)
+	assert.True(t, revived)
+}
@@ -0,0 +1,159 @@
+package shotgun
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// Coalescer shares one call between identical idempotent calls made at the
+// same time, ie: fifty clients opening the same page. Calls are identical
+// when their credentials, method and params, entity type included, are. A
+// Coalescer is shared by every client of a host.
+type Coalescer struct {
+	lock    sync.Mutex
+	flights map[string]*flight
+
+	calls     int64
+	coalesced int64
+}
+
+// NewCoalescer makes a coalescer.
+func NewCoalescer() *Coalescer {
+	return &Coalescer{flights: make(map[string]*flight)}
+}
+
+// CoalescerStats count the calls made to Shotgun and the calls that shared
+// one instead.
+type CoalescerStats struct {
+	Calls     int64 `json:"calls"`
+	Coalesced int64 `json:"coalesced"`
+	// Rate is the share of calls that were coalesced.
+	Rate float64 `json:"rate"`
+}
+
+// Stats of the calls so far.
+func (g *Coalescer) Stats() CoalescerStats {
+	stats := CoalescerStats{
+		Calls:     atomic.LoadInt64(&g.calls),
+		Coalesced: atomic.LoadInt64(&g.coalesced),
+	}
+	if total := stats.Calls + stats.Coalesced; total > 0 {
+		stats.Rate = float64(stats.Coalesced) / float64(total)
+	}
+	return stats
+}
+
+// flight is a call being made for whoever is waiting on it.
+type flight struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+// response is a copy of the shared response with its own body.
+func (f *flight) response() *http.Response {
+	resp := *f.resp
+	resp.Header = make(http.Header, len(f.resp.Header))
+	for key, values := range f.resp.Header {
+		resp.Header[key] = values
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(f.body))
+	resp.ContentLength = int64(len(f.body))
+	return &resp
+}
+
+// coalesceKey identifies a call by its credentials, method and normalized
+// params.
+func coalesceKey(credentials map[string]string, method string, params interface{}) (string, error) {
+	normalized, err := normalize(params)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(normalized)
+	if err != nil {
+		return "", err
+	}
+	creds, err := json.Marshal(credentials)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(creds)
+	return hex.EncodeToString(sum[:]) + " " + method + " " + string(data), nil
+}
+
+// do makes call, or waits on the identical one being made. The call isn't
+// tied to any one caller's ctx, each stops waiting when its own is done and
+// the call is canceled once no one is waiting.
+func (g *Coalescer) do(ctx context.Context, key string, call func(ctx context.Context) (*http.Response, error)) (*http.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	g.lock.Lock()
+	f, ok := g.flights[key]
+	if ok {
+		f.waiters++
+		atomic.AddInt64(&g.coalesced, 1)
+	} else {
+		callCtx, cancel := context.WithCancel(context.Background())
+		f = &flight{done: make(chan struct{}), cancel: cancel, waiters: 1}
+		g.flights[key] = f
+		atomic.AddInt64(&g.calls, 1)
+		go g.run(callCtx, key, f, call)
+	}
+	g.lock.Unlock()
+
+	select {
+	case <-f.done:
+		if f.err != nil {
+			return nil, f.err
+		}
+		return f.response(), nil
+	case <-ctx.Done():
+		g.leave(key, f)
+		return nil, ctx.Err()
+	}
+}
+
+func (g *Coalescer) run(ctx context.Context, key string, f *flight, call func(ctx context.Context) (*http.Response, error)) {
+	resp, err := call(ctx)
+	if err == nil {
+		f.body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		f.resp = resp
+	}
+	f.err = err
+
+	g.lock.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.lock.Unlock()
+	close(f.done)
+	f.cancel()
+}
+
+// leave stops waiting on a flight, the last to leave cancels it.
+func (g *Coalescer) leave(key string, f *flight) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	f.cancel()
+}
@@ -0,0 +1,132 @@
+package shotgun
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// slowServer answers reads after release is closed.
+func slowServer(release chan struct{}) func(c call) (int, string) {
+	return func(c call) (int, string) {
+		<-release
+		return http.StatusOK, `{"results":{"entities":[{"type":"Shot","id":1}],"paging_info":{"entity_count":1}}}`
+	}
+}
+
+func TestCoalesceKey(t *testing.T) {
+	creds := map[string]string{"script_name": "script", "script_key": "key"}
+	query := NewReadQuery("Shot", "code")
+	key, err := coalesceKey(creds, "read", query)
+	assert.Nil(t, err)
+
+	// The same query as a map.
+	var asMap map[string]interface{}
+	data, _ := json.Marshal(query)
+	json.Unmarshal(data, &asMap)
+	mapKey, _ := coalesceKey(creds, "read", asMap)
+	assert.Equal(t, key, mapKey)
+
+	other, _ := coalesceKey(map[string]string{"user_login": "login", "user_password": "pass"}, "read", query)
+	assert.NotEqual(t, key, other)
+	other, _ = coalesceKey(creds, "summarize", query)
+	assert.NotEqual(t, key, other)
+	other, _ = coalesceKey(creds, "read", NewReadQuery("Asset", "code"))
+	assert.NotEqual(t, key, other)
+}
+
+func TestCoalesce(t *testing.T) {
+	release := make(chan struct{})
+	server, sg, calls := mockServer(slowServer(release))
+	defer server.Close()
+	sg.Coalescer = NewCoalescer()
+
+	const readers = 20
+	var wg sync.WaitGroup
+	results := make(chan int, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := sg.Find(context.Background(), NewReadQuery("Shot", "code"))
+			if err == nil {
+				results <- len(result.Entities)
+			}
+		}()
+	}
+	// Wait for every reader to be waiting on the call.
+	for sg.Coalescer.Stats().Coalesced < readers-1 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(results)
+
+	assert.Len(t, results, readers)
+	for n := range results {
+		assert.Equal(t, 1, n)
+	}
+	assert.Len(t, *calls, 1)
+	assert.Equal(t, CoalescerStats{Calls: 1, Coalesced: readers - 1, Rate: float64(readers-1) / readers}, sg.Coalescer.Stats())
+
+	// Once done the next read makes its own call.
+	_, err := sg.Find(context.Background(), NewReadQuery("Shot", "code"))
+	assert.Nil(t, err)
+	assert.Len(t, *calls, 2)
+}
+
+func TestCoalesceOnlyIdempotent(t *testing.T) {
+	server, sg, calls := mockServer(func(c call) (int, string) {
+		return http.StatusOK, `{"results":true}`
+	})
+	defer server.Close()
+	sg.Coalescer = NewCoalescer()
+
+	sg.Delete(context.Background(), "Shot", 1)
+	sg.Delete(context.Background(), "Shot", 1)
+	assert.Len(t, *calls, 2)
+	assert.Equal(t, int64(0), sg.Coalescer.Stats().Calls)
+}
+
+func TestCoalesceCanceled(t *testing.T) {
+	release := make(chan struct{})
+	server, sg, _ := mockServer(slowServer(release))
+	defer server.Close()
+	// Let the handler finish so the server can close.
+	defer close(release)
+	sg.Coalescer = NewCoalescer()
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	go func() {
+		_, err := sg.Find(first, NewReadQuery("Shot"))
+		errs <- err
+	}()
+	go func() {
+		_, err := sg.Find(second, NewReadQuery("Shot"))
+		errs <- err
+	}()
+	for sg.Coalescer.Stats().Coalesced < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// One leaving doesn't cancel the call for the other.
+	cancelFirst()
+	assert.True(t, IsCanceled(<-errs))
+	sg.Coalescer.lock.Lock()
+	assert.Len(t, sg.Coalescer.flights, 1)
+	sg.Coalescer.lock.Unlock()
+
+	// The last leaving does.
+	cancelSecond()
+	assert.True(t, IsCanceled(<-errs))
+	sg.Coalescer.lock.Lock()
+	assert.Len(t, sg.Coalescer.flights, 0)
+	sg.Coalescer.lock.Unlock()
+}
@@ -0,0 +1,87 @@
+package shotgun
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+)
+
+// ErrorCodeAuthentication is the code of exceptions for bad credentials.
+const ErrorCodeAuthentication = 102
+
+// Error is an exception Shotgun returned.
+type Error struct {
+	Method  string
+	Code    int
+	Message string
+}
+
+// Error is Shotgun's message as is, callers match on it.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ResponseError is a response that isn't Shotgun's json, ie: an error page
+// from a proxy in front of it.
+type ResponseError struct {
+	Method     string
+	StatusCode int
+	Err        error
+}
+
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("shotgun %s: bad response (%d): %v", e.Method, e.StatusCode, e.Err)
+}
+
+// NotFoundError is returned by FindOne when there is no such entity.
+type NotFoundError struct {
+	Type string
+	ID   int
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %d not found", e.Type, e.ID)
+}
+
+// IsNotFound is whether err is a NotFoundError.
+func IsNotFound(err error) bool {
+	_, ok := err.(*NotFoundError)
+	return ok
+}
+
+// IsAuthentication is whether Shotgun rejected the credentials.
+func IsAuthentication(err error) bool {
+	sgErr, ok := err.(*Error)
+	return ok && sgErr.Code == ErrorCodeAuthentication
+}
+
+// cause is the error under the ones the client wraps errors in.
+func cause(err error) error {
+	for {
+		switch wrapped := err.(type) {
+		case *url.Error:
+			err = wrapped.Err
+		case *ResponseError:
+			err = wrapped.Err
+		default:
+			return err
+		}
+	}
+}
+
+// IsCanceled is whether a call stopped because its context was canceled.
+func IsCanceled(err error) bool {
+	return cause(err) == context.Canceled
+}
+
+// IsTimeout is whether a call ran out of time, its own timeout or its
+// context's deadline.
+func IsTimeout(err error) bool {
+	err = cause(err)
+	if err == context.DeadlineExceeded {
+		return true
+	}
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
@@ -0,0 +1,188 @@
+package shotgun
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// PagingInfo is returned with reads that ask for it.
+type PagingInfo struct {
+	EntityCount     int `json:"entity_count"`
+	CurrentPage     int `json:"current_page"`
+	EntitiesPerPage int `json:"entities_per_page"`
+	PageCount       int `json:"page_count"`
+}
+
+// FindResult is a page of entities.
+type FindResult struct {
+	Entities   []map[string]interface{} `json:"entities"`
+	PagingInfo PagingInfo               `json:"paging_info"`
+}
+
+// SummarizeResult is the summaries of every entity matched and of each group.
+type SummarizeResult struct {
+	Summaries map[string]interface{} `json:"summaries"`
+	Groups    []SummaryGroup         `json:"groups"`
+}
+
+// SummaryGroup is a group of a summarize. GroupValue is the raw value, ie:
+// an entity for link fields, GroupName is how Shotgun displays it.
+type SummaryGroup struct {
+	GroupValue interface{}            `json:"group_value"`
+	GroupName  string                 `json:"group_name"`
+	Summaries  map[string]interface{} `json:"summaries"`
+	Groups     []SummaryGroup         `json:"groups,omitempty"`
+}
+
+// SchemaField is a field as schema_read and schema_field_read return it.
+type SchemaField struct {
+	Name struct {
+		Value string `json:"value"`
+	} `json:"name"`
+	DataType struct {
+		Value string `json:"value"`
+	} `json:"data_type"`
+	Editable struct {
+		Value bool `json:"value"`
+	} `json:"editable"`
+	Mandatory struct {
+		Value bool `json:"value"`
+	} `json:"mandatory"`
+	Properties struct {
+		DefaultValue struct {
+			Value interface{} `json:"value"`
+		} `json:"default_value"`
+		ValidTypes struct {
+			Value []string `json:"value"`
+		} `json:"valid_types"`
+		ValidValues struct {
+			Value []string `json:"value"`
+		} `json:"valid_values"`
+	} `json:"properties"`
+}
+
+// Find reads a page of entities. query is usually a ReadQuery, anything
+// that marshals to a read's params works.
+func (c *Client) Find(ctx context.Context, query interface{}) (*FindResult, error) {
+	var result FindResult
+	if err := c.Call(ctx, "read", query, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// FindOne reads an entity by id, a NotFoundError if there isn't one.
+func (c *Client) FindOne(ctx context.Context, entityType string, id int, fields ...string) (map[string]interface{}, error) {
+	query := NewReadQuery(entityType, fields...)
+	query.Paging["entities_per_page"] = 1
+	query.Filters.Add(NewCondition("id", "is", id))
+
+	result, err := c.Find(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Entities) == 0 {
+		return nil, &NotFoundError{Type: entityType, ID: id}
+	}
+	return result.Entities[0], nil
+}
+
+// Create makes an entity and returns it with the id and returnFields.
+func (c *Client) Create(ctx context.Context, entityType string, fields []FieldValue, returnFields ...string) (map[string]interface{}, error) {
+	var entity map[string]interface{}
+	params := map[string]interface{}{
+		"type":          entityType,
+		"fields":        fields,
+		"return_fields": append([]string{"id"}, returnFields...),
+	}
+	if err := c.Call(ctx, "create", params, &entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// Update writes fields of an entity and returns the ones written.
+func (c *Client) Update(ctx context.Context, entityType string, id int, fields []FieldValue) (map[string]interface{}, error) {
+	var entity map[string]interface{}
+	params := map[string]interface{}{
+		"type":   entityType,
+		"id":     id,
+		"fields": fields,
+	}
+	if err := c.Call(ctx, "update", params, &entity); err != nil {
+		return nil, err
+	}
+	return entity, nil
+}
+
+// Delete retires an entity, false if it was already retired.
+func (c *Client) Delete(ctx context.Context, entityType string, id int) (bool, error) {
+	var results bool
+	err := c.Call(ctx, "delete", map[string]interface{}{"type": entityType, "id": id}, &results)
+	return results, err
+}
+
+// Revive brings back a retired entity, false if it wasn't retired.
+func (c *Client) Revive(ctx context.Context, entityType string, id int) (bool, error) {
+	var results bool
+	err := c.Call(ctx, "revive", map[string]interface{}{"type": entityType, "id": id}, &results)
+	return results, err
+}
+
+// Summarize runs summaries over matching entities. query is usually a
+// SummarizeQuery.
+func (c *Client) Summarize(ctx context.Context, query interface{}) (*SummarizeResult, error) {
+	var result SummarizeResult
+	if err := c.Call(ctx, "summarize", query, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Batch runs requests in one transaction, the results are in the same
+// order: an entity for creates and updates, a bool for deletes.
+func (c *Client) Batch(ctx context.Context, requests []BatchRequest) ([]interface{}, error) {
+	var results []interface{}
+	if err := c.Call(ctx, "batch", requests, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SchemaRead reads the fields of every entity type.
+func (c *Client) SchemaRead(ctx context.Context) (map[string]map[string]SchemaField, error) {
+	var schema map[string]map[string]SchemaField
+	if err := c.Call(ctx, "schema_read", map[string]interface{}{}, &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// SchemaFieldRead reads the fields of an entity type.
+func (c *Client) SchemaFieldRead(ctx context.Context, entityType string) (map[string]SchemaField, error) {
+	var schema map[string]SchemaField
+	if err := c.Call(ctx, "schema_field_read", map[string]interface{}{"type": entityType}, &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// Info is the server's info, ie: 'version'. It isn't wrapped in 'results'
+// by every version of Shotgun so both are handled.
+func (c *Client) Info(ctx context.Context) (map[string]interface{}, error) {
+	body, env, err := c.call(ctx, "info", map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]interface{})
+	raw := json.RawMessage(body)
+	if len(env.Results) > 0 {
+		raw = env.Results
+	}
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, &ResponseError{Method: "info", StatusCode: http.StatusOK, Err: err}
+	}
+	return info, nil
+}
@@ -0,0 +1,169 @@
+package shotgun
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// asJSON is v as the mock server decodes it.
+func asJSON(v interface{}) interface{} {
+	var out interface{}
+	body, _ := json.Marshal(v)
+	json.Unmarshal(body, &out)
+	return out
+}
+
+func TestFind(t *testing.T) {
+	server, sg, calls := mockServer(func(c call) (int, string) {
+		return http.StatusOK, `{"results":{"entities":[{"type":"Shot","id":1,"code":"sh010"}],"paging_info":{"entity_count":1,"current_page":1,"entities_per_page":500,"page_count":1}}}`
+	})
+	defer server.Close()
+
+	query := NewReadQuery("Shot", "code")
+	query.Filters.Add(NewCondition("code", "in", "sh010", "sh020"))
+	query.Filters.Add(NewFilters("or", NewCondition("sg_status_list", "is", "ip")))
+	query.Sorts = []Sort{{FieldName: "code", Direction: "desc"}}
+
+	result, err := sg.Find(context.Background(), query)
+	assert.Nil(t, err)
+	assert.Equal(t, []map[string]interface{}{{"type": "Shot", "id": float64(1), "code": "sh010"}}, result.Entities)
+	assert.Equal(t, PagingInfo{EntityCount: 1, CurrentPage: 1, EntitiesPerPage: 500, PageCount: 1}, result.PagingInfo)
+
+	assert.Equal(t, asJSON(map[string]interface{}{
+		"type":          "Shot",
+		"return_fields": []string{"id", "code"},
+		"filters": map[string]interface{}{
+			"logical_operator": "and",
+			"conditions": []interface{}{
+				map[string]interface{}{"path": "code", "relation": "in", "values": []string{"sh010", "sh020"}},
+				map[string]interface{}{"logical_operator": "or", "conditions": []interface{}{
+					map[string]interface{}{"path": "sg_status_list", "relation": "is", "values": []string{"ip"}},
+				}},
+			},
+		},
+		"sorts":                 []interface{}{map[string]interface{}{"field_name": "code", "direction": "desc"}},
+		"paging":                map[string]interface{}{"current_page": 1, "entities_per_page": 500},
+		"return_paging_info":    true,
+		"api_return_image_urls": true,
+		"return_only":           "active",
+	}), (*calls)[0].Params)
+}
+
+func TestFindOne(t *testing.T) {
+	server, sg, calls := mockServer(func(c call) (int, string) {
+		return http.StatusOK, `{"results":{"entities":[],"paging_info":{"entity_count":0}}}`
+	})
+	defer server.Close()
+
+	_, err := sg.FindOne(context.Background(), "Shot", 5, "code")
+	assert.Equal(t, &NotFoundError{Type: "Shot", ID: 5}, err)
+	assert.True(t, IsNotFound(err))
+	assert.Equal(t, "Shot 5 not found", err.Error())
+
+	params := (*calls)[0].Params.(map[string]interface{})
+	assert.Equal(t, float64(1), params["paging"].(map[string]interface{})["entities_per_page"])
+	assert.Equal(t, []interface{}{"id", "code"}, params["return_fields"])
+}
+
+func TestWrites(t *testing.T) {
+	server, sg, calls := mockServer(func(c call) (int, string) {
+		switch c.Method {
+		case "create", "update":
+			return http.StatusOK, `{"results":{"type":"Shot","id":1,"code":"sh010"}}`
+		case "batch":
+			return http.StatusOK, `{"results":[{"type":"Shot","id":2},true]}`
+		}
+		return http.StatusOK, `{"results":true}`
+	})
+	defer server.Close()
+	ctx := context.Background()
+
+	entity, err := sg.Create(ctx, "Shot", Fields(map[string]interface{}{"code": "sh010", "cut_in": 1001}), "code")
+	assert.Nil(t, err)
+	assert.Equal(t, "sh010", entity["code"])
+	assert.Equal(t, asJSON(map[string]interface{}{
+		"type":          "Shot",
+		"fields":        []FieldValue{{FieldName: "code", Value: "sh010"}, {FieldName: "cut_in", Value: 1001}},
+		"return_fields": []string{"id", "code"},
+	}), (*calls)[0].Params)
+
+	_, err = sg.Update(ctx, "Shot", 1, []FieldValue{{FieldName: "assets", Value: []interface{}{}, MultiEntityUpdateMode: "add"}})
+	assert.Nil(t, err)
+	assert.Equal(t, asJSON(map[string]interface{}{
+		"type":   "Shot",
+		"id":     1,
+		"fields": []interface{}{map[string]interface{}{"field_name": "assets", "value": []interface{}{}, "multi_entity_update_mode": "add"}},
+	}), (*calls)[1].Params)
+
+	deleted, err := sg.Delete(ctx, "Shot", 1)
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	revived, err := sg.Revive(ctx, "Shot", 1)
+	assert.Nil(t, err)
+	assert.True(t, revived)
+	assert.Equal(t, "revive", (*calls)[3].Method)
+
+	results, err := sg.Batch(ctx, []BatchRequest{
+		{RequestType: "create", Type: "Shot", Fields: Fields(map[string]interface{}{"code": "sh020"})},
+		{RequestType: "delete", Type: "Shot", ID: 1},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"type": "Shot", "id": float64(2)}, true}, results)
+	assert.Equal(t, asJSON([]interface{}{
+		map[string]interface{}{"request_type": "create", "type": "Shot", "fields": []interface{}{map[string]interface{}{"field_name": "code", "value": "sh020"}}},
+		map[string]interface{}{"request_type": "delete", "type": "Shot", "id": 1},
+	}), (*calls)[4].Params)
+}
+
+func TestSummarize(t *testing.T) {
+	server, sg, _ := mockServer(func(c call) (int, string) {
+		return http.StatusOK, `{"results":{"summaries":{"id":2},"groups":[{"group_name":"sq010","group_value":{"type":"Sequence","id":3},"summaries":{"id":2}}]}}`
+	})
+	defer server.Close()
+
+	result, err := sg.Summarize(context.Background(), SummarizeQuery{
+		Type:      "Shot",
+		Filters:   NewFilters("and"),
+		Summaries: []Summary{{Field: "id", Type: "count"}},
+		Grouping:  []Grouping{{Field: "sg_sequence", Type: "exact", Direction: "asc"}},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"id": float64(2)}, result.Summaries)
+	if assert.Len(t, result.Groups, 1) {
+		assert.Equal(t, "sq010", result.Groups[0].GroupName)
+		assert.Equal(t, map[string]interface{}{"type": "Sequence", "id": float64(3)}, result.Groups[0].GroupValue)
+	}
+}
+
+func TestSchemaAndInfo(t *testing.T) {
+	server, sg, _ := mockServer(func(c call) (int, string) {
+		switch c.Method {
+		case "schema_read":
+			return http.StatusOK, `{"results":{"Shot":{"code":{"name":{"value":"Shot Code"},"data_type":{"value":"text"},"editable":{"value":true},"properties":{}}}}}`
+		case "schema_field_read":
+			return http.StatusOK, `{"results":{"sg_status_list":{"data_type":{"value":"status_list"},"properties":{"valid_values":{"value":["ip","fin"]},"default_value":{"value":"ip"}}}}}`
+		}
+		return http.StatusOK, `{"version":[7,0,1],"s3_uploads_enabled":true}`
+	})
+	defer server.Close()
+	ctx := context.Background()
+
+	schema, err := sg.SchemaRead(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, "Shot Code", schema["Shot"]["code"].Name.Value)
+	assert.Equal(t, "text", schema["Shot"]["code"].DataType.Value)
+	assert.True(t, schema["Shot"]["code"].Editable.Value)
+
+	fields, err := sg.SchemaFieldRead(ctx, "Shot")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ip", "fin"}, fields["sg_status_list"].Properties.ValidValues.Value)
+	assert.Equal(t, "ip", fields["sg_status_list"].Properties.DefaultValue.Value)
+
+	info, err := sg.Info(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{float64(7), float64(0), float64(1)}, info["version"])
+}
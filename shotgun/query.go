@@ -0,0 +1,121 @@
+package shotgun
+
+import (
+	"sort"
+)
+
+// ReadQuery is the params of a 'read'.
+type ReadQuery struct {
+	Type               string         `json:"type"`
+	ReturnFields       []string       `json:"return_fields"`
+	Filters            *Filters       `json:"filters"`
+	Sorts              []Sort         `json:"sorts,omitempty"`
+	Paging             map[string]int `json:"paging"`
+	ReturnPagingInfo   bool           `json:"return_paging_info"`
+	APIReturnImageUrls bool           `json:"api_return_image_urls"`
+	ReturnOnly         string         `json:"return_only"`
+}
+
+// NewReadQuery reads the first 500 active entities, with the id and fields.
+func NewReadQuery(entityType string, fields ...string) ReadQuery {
+	return ReadQuery{
+		Type:               entityType,
+		ReturnFields:       append([]string{"id"}, fields...),
+		Filters:            NewFilters("and"),
+		ReturnPagingInfo:   true,
+		APIReturnImageUrls: true,
+		ReturnOnly:         "active",
+		Paging: map[string]int{
+			"current_page":      1,
+			"entities_per_page": 500,
+		},
+	}
+}
+
+// Sort orders a read, Direction is 'asc' or 'desc'.
+type Sort struct {
+	FieldName string `json:"field_name"`
+	Direction string `json:"direction"`
+}
+
+// Filters is a group of conditions, which can be other groups.
+type Filters struct {
+	LogicalOperator string        `json:"logical_operator"`
+	Conditions      []interface{} `json:"conditions"`
+}
+
+// NewFilters makes a group, operator is 'and' or 'or'.
+func NewFilters(operator string, conditions ...interface{}) *Filters {
+	return &Filters{LogicalOperator: operator, Conditions: append([]interface{}{}, conditions...)}
+}
+
+// Add adds a Condition or *Filters.
+func (f *Filters) Add(condition interface{}) {
+	f.Conditions = append(f.Conditions, condition)
+}
+
+// Condition matches a field, ie: NewCondition("code", "in", "sh010", "sh020").
+type Condition struct {
+	Path     string        `json:"path"`
+	Relation string        `json:"relation"`
+	Values   []interface{} `json:"values"`
+}
+
+// NewCondition makes a condition.
+func NewCondition(path, relation string, values ...interface{}) Condition {
+	return Condition{Path: path, Relation: relation, Values: append([]interface{}{}, values...)}
+}
+
+// FieldValue is a field written by create, update and batch.
+type FieldValue struct {
+	FieldName string      `json:"field_name"`
+	Value     interface{} `json:"value"`
+	// MultiEntityUpdateMode is 'add', 'remove' or 'set', set when empty.
+	MultiEntityUpdateMode string `json:"multi_entity_update_mode,omitempty"`
+}
+
+// Fields makes the field values of data, sorted by name.
+func Fields(data map[string]interface{}) []FieldValue {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]FieldValue, 0, len(data))
+	for _, name := range names {
+		fields = append(fields, FieldValue{FieldName: name, Value: data[name]})
+	}
+	return fields
+}
+
+// SummarizeQuery is the params of a 'summarize'.
+type SummarizeQuery struct {
+	Type      string     `json:"type"`
+	Filters   *Filters   `json:"filters"`
+	Summaries []Summary  `json:"summaries,omitempty"`
+	Grouping  []Grouping `json:"grouping,omitempty"`
+}
+
+// Summary is a field and the summary of it, ie: 'count' or 'sum'.
+type Summary struct {
+	Field string `json:"field"`
+	Type  string `json:"type"`
+}
+
+// Grouping groups a summary by a field, Type is ie: 'exact' or 'day'.
+type Grouping struct {
+	Field     string `json:"field"`
+	Type      string `json:"type"`
+	Direction string `json:"direction"`
+}
+
+// BatchRequest is one of the requests of a 'batch'. RequestType is
+// 'create', 'update' or 'delete'.
+type BatchRequest struct {
+	RequestType  string       `json:"request_type"`
+	Type         string       `json:"type"`
+	ID           int          `json:"id,omitempty"`
+	Fields       []FieldValue `json:"fields,omitempty"`
+	ReturnFields []string     `json:"return_fields,omitempty"`
+}
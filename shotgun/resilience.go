@@ -0,0 +1,186 @@
+package shotgun
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Idempotent is whether a method only reads so it can be sent again.
+func Idempotent(method string) bool {
+	switch method {
+	case "read", "summarize", "info", "schema_read", "schema_field_read", "schema_entity_read":
+		return true
+	}
+	return false
+}
+
+// RetryPolicy is how idempotent calls are retried when Shotgun can't be
+// reached or answers 502, 503 or 504. The zero value doesn't retry.
+type RetryPolicy struct {
+	// Retries is how many times a call is sent again.
+	Retries int
+	// Backoff is the wait before the first retry, it doubles after each.
+	Backoff time.Duration
+	// MaxBackoff caps the wait, 0 is no cap.
+	MaxBackoff time.Duration
+}
+
+// wait is how long to wait before retry n, from 0, with jitter so clients
+// retrying together spread out. A Retry-After from Shotgun is honored up to
+// MaxBackoff.
+func (p RetryPolicy) wait(n int, resp *http.Response) time.Duration {
+	wait := p.Backoff << uint(n)
+	if p.MaxBackoff > 0 && (wait > p.MaxBackoff || wait <= 0) {
+		wait = p.MaxBackoff
+	}
+	if wait > 0 {
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+	}
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			retryAfter := time.Duration(seconds) * time.Second
+			if p.MaxBackoff > 0 && retryAfter > p.MaxBackoff {
+				retryAfter = p.MaxBackoff
+			}
+			if retryAfter > wait {
+				wait = retryAfter
+			}
+		}
+	}
+	return wait
+}
+
+// retryStatus is whether a response status is worth retrying.
+func retryStatus(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
+
+// CircuitOpenError is returned without calling Shotgun while its breaker is
+// open.
+type CircuitOpenError struct {
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("Shotgun is unavailable, retry after %v", e.RetryAfter)
+}
+
+// IsCircuitOpen is whether a call failed fast because of the breaker.
+func IsCircuitOpen(err error) bool {
+	_, ok := cause(err).(*CircuitOpenError)
+	return ok
+}
+
+// CircuitRetryAfter is how long to wait before retrying a call that failed
+// fast because of the breaker.
+func CircuitRetryAfter(err error) (time.Duration, bool) {
+	if open, ok := cause(err).(*CircuitOpenError); ok {
+		return open.RetryAfter, true
+	}
+	return 0, false
+}
+
+// Breaker stops calls to Shotgun after Threshold failures in a row, ie: it
+// can't be reached or answers 5xx. Calls fail fast for Cooldown, then one is
+// let through to see if it has recovered. A Breaker is shared by every
+// client of a host.
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	lock     sync.Mutex
+	failures int
+	openedAt time.Time
+	trial    bool
+	// now is time.Now when nil, tests replace it.
+	now func() time.Time
+}
+
+// NewBreaker makes a breaker, a threshold of 0 never opens.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{Threshold: threshold, Cooldown: cooldown}
+}
+
+func (b *Breaker) time() time.Time {
+	if b.now != nil {
+		return b.now()
+	}
+	return time.Now()
+}
+
+func (b *Breaker) open() bool {
+	return b.Threshold > 0 && b.failures >= b.Threshold
+}
+
+// RetryAfter is how long until calls are let through again, 0 when they
+// are.
+func (b *Breaker) RetryAfter() time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.open() {
+		return 0
+	}
+	if wait := b.openedAt.Add(b.Cooldown).Sub(b.time()); wait > 0 {
+		return wait
+	}
+	if b.trial {
+		return b.Cooldown
+	}
+	return 0
+}
+
+// allow is whether a call can be made, once the cooldown is over the first
+// call is the trial.
+func (b *Breaker) allow() error {
+	if b == nil {
+		return nil
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if !b.open() {
+		return nil
+	}
+	if wait := b.openedAt.Add(b.Cooldown).Sub(b.time()); wait > 0 {
+		return &CircuitOpenError{RetryAfter: wait}
+	}
+	if b.trial {
+		return &CircuitOpenError{RetryAfter: b.Cooldown}
+	}
+	b.trial = true
+	return nil
+}
+
+// release ends a call that says nothing about Shotgun's health.
+func (b *Breaker) release() {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	b.trial = false
+	b.lock.Unlock()
+}
+
+// record counts the outcome of a call.
+func (b *Breaker) record(failed bool) {
+	if b == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.trial = false
+	if !failed {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.open() {
+		b.openedAt = b.time()
+	}
+}
@@ -0,0 +1,177 @@
+package shotgun
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyServer fails the first failures calls, by resetting the connection
+// when reset is true or answering 503 otherwise, then answers ok.
+func flakyServer(failures int, reset bool) (*httptest.Server, *Client, func() int) {
+	var lock sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		calls++
+		n := calls
+		lock.Unlock()
+		if n <= failures {
+			if reset {
+				conn, _, _ := w.(http.Hijacker).Hijack()
+				conn.Close()
+				return
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprint(w, `<html>Service Unavailable</html>`)
+			return
+		}
+		fmt.Fprint(w, `{"results":{"entities":[{"type":"Shot","id":1}],"paging_info":{"entity_count":1}}}`)
+	}))
+
+	client, _ := New(server.URL, "fake-script", "fake-key")
+	client.Retry = RetryPolicy{Retries: 3, Backoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+	return server, client, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return calls
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	for _, method := range []string{"read", "summarize", "info", "schema_read", "schema_field_read", "schema_entity_read"} {
+		assert.True(t, Idempotent(method), method)
+	}
+	for _, method := range []string{"create", "update", "delete", "revive", "batch", "schema_field_create", "schema_field_update", "schema_field_delete"} {
+		assert.False(t, Idempotent(method), method)
+	}
+}
+
+func TestRetryWait(t *testing.T) {
+	policy := RetryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for n, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		wait := policy.wait(n, nil)
+		assert.True(t, wait >= max*time.Millisecond/2 && wait <= max*time.Millisecond, "retry %d waited %v", n, wait)
+	}
+
+	resp := &http.Response{Header: http.Header{"Retry-After": {"30"}}}
+	assert.Equal(t, time.Second, policy.wait(0, resp))
+}
+
+func TestRetry(t *testing.T) {
+	server, sg, calls := flakyServer(2, false)
+	defer server.Close()
+
+	result, err := sg.Find(context.Background(), NewReadQuery("Shot"))
+	assert.Nil(t, err)
+	assert.Len(t, result.Entities, 1)
+	assert.Equal(t, 3, calls())
+}
+
+func TestRetryReset(t *testing.T) {
+	server, sg, calls := flakyServer(1, true)
+	defer server.Close()
+
+	result, err := sg.Find(context.Background(), NewReadQuery("Shot"))
+	assert.Nil(t, err)
+	assert.Len(t, result.Entities, 1)
+	assert.Equal(t, 2, calls())
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	server, sg, calls := flakyServer(10, false)
+	defer server.Close()
+
+	_, err := sg.Find(context.Background(), NewReadQuery("Shot"))
+	if assert.IsType(t, &ResponseError{}, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, err.(*ResponseError).StatusCode)
+	}
+	assert.Equal(t, 4, calls())
+}
+
+func TestRetryOnlyIdempotent(t *testing.T) {
+	server, sg, calls := flakyServer(1, false)
+	defer server.Close()
+
+	_, err := sg.Delete(context.Background(), "Shot", 1)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, calls())
+}
+
+func TestRetryTimeout(t *testing.T) {
+	server, sg, calls := flakyServer(10, false)
+	defer server.Close()
+
+	sg.Timeout = 20 * time.Millisecond
+	sg.Retry = RetryPolicy{Retries: 10, Backoff: time.Second}
+	_, err := sg.Find(context.Background(), NewReadQuery("Shot"))
+	assert.True(t, IsTimeout(err))
+	assert.Equal(t, 1, calls())
+}
+
+func TestBreaker(t *testing.T) {
+	server, sg, calls := flakyServer(3, false)
+	defer server.Close()
+
+	now := time.Now()
+	sg.Retry = RetryPolicy{}
+	sg.Breaker = NewBreaker(3, time.Minute)
+	sg.Breaker.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		_, err := sg.Find(context.Background(), NewReadQuery("Shot"))
+		assert.IsType(t, &ResponseError{}, err)
+	}
+	assert.Equal(t, time.Minute, sg.Breaker.RetryAfter())
+
+	// Open, calls fail fast.
+	_, err := sg.Find(context.Background(), NewReadQuery("Shot"))
+	assert.True(t, IsCircuitOpen(err))
+	assert.Equal(t, time.Minute, err.(*CircuitOpenError).RetryAfter)
+	assert.Equal(t, 3, calls())
+
+	// Half open, one trial call goes through and closes it.
+	now = now.Add(time.Minute)
+	assert.Equal(t, time.Duration(0), sg.Breaker.RetryAfter())
+	_, err = sg.Find(context.Background(), NewReadQuery("Shot"))
+	assert.Nil(t, err)
+	assert.Equal(t, 4, calls())
+	assert.Equal(t, time.Duration(0), sg.Breaker.RetryAfter())
+}
+
+func TestBreakerTrial(t *testing.T) {
+	now := time.Now()
+	breaker := NewBreaker(1, time.Second)
+	breaker.now = func() time.Time { return now }
+
+	breaker.record(true)
+	assert.True(t, IsCircuitOpen(breaker.allow()))
+
+	now = now.Add(time.Second)
+	assert.Nil(t, breaker.allow())
+	// Only one trial at a time.
+	assert.True(t, IsCircuitOpen(breaker.allow()))
+	assert.Equal(t, time.Second, breaker.RetryAfter())
+
+	// A failed trial opens it again.
+	breaker.record(true)
+	assert.Equal(t, time.Second, breaker.RetryAfter())
+
+	// A canceled trial lets the next call try.
+	now = now.Add(time.Second)
+	assert.Nil(t, breaker.allow())
+	breaker.release()
+	assert.Nil(t, breaker.allow())
+
+	// A nil breaker never opens.
+	var none *Breaker
+	assert.Nil(t, none.allow())
+	none.record(true)
+	assert.Equal(t, time.Duration(0), none.RetryAfter())
+}
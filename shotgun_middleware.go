@@ -6,70 +6,119 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 var connectionCache map[string]Shotgun
+var connectionCacheLock sync.Mutex
 
 func init() {
 	connectionCache = make(map[string]Shotgun)
 }
 
-func ShotgunAuthMiddleware(config clientConfig) func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+// connectionKey identifies a Shotgun connection by its host and credentials.
+func connectionKey(host string, isUser bool, name, key string) string {
+	hasher := sha1.New()
+	return hex.EncodeToString(hasher.Sum([]byte(fmt.Sprintf("%s%v%s%s", host, isUser, name, key))))
+}
 
-	return func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
-		s := strings.SplitN(req.Header.Get("Authorization"), " ", 2)
-		if len(s) != 2 {
-			rw.Header().Set("WWW-Authenticate", `Basic realm="shotgun-restful"`)
-			rw.WriteHeader(http.StatusUnauthorized)
-			rw.Write([]byte("401 Unauthorized\n"))
-			return
+// shotgunConnection resolves the credentials in an Authorization header to
+// a cached connection and its key. The status is for when it can't.
+func shotgunConnection(config clientConfig, authorization string) (Shotgun, string, int) {
+	var conn Shotgun
+	s := strings.SplitN(authorization, " ", 2)
+	if len(s) != 2 || !strings.HasPrefix(s[0], "Basic") {
+		return conn, "", http.StatusUnauthorized
+	}
+
+	var isUser bool
+	if s[0] == "Basic-User" {
+		isUser = true
+	}
+
+	b, err := base64.StdEncoding.DecodeString(s[1])
+	if err != nil {
+		return conn, "", http.StatusInternalServerError
+	}
+
+	pair := strings.SplitN(string(b), ":", 2)
+	if len(pair) != 2 {
+		return conn, "", http.StatusForbidden
+	}
+
+	name := pair[0]
+	key := pair[1]
+
+	hash := connectionKey(config.shotgunHost, isUser, name, key)
+
+	connectionCacheLock.Lock()
+	conn, ok := connectionCache[hash]
+	if !ok {
+		if isUser {
+			conn = NewUserShotgun(config.shotgunHost, name, key)
+		} else {
+			conn = NewShotgun(config.shotgunHost, name, key)
 		}
+		conn.Timeout = config.shotgunTimeout
+		conn.MethodTimeouts = config.shotgunMethodTimeouts
+		conn.Retry = config.shotgunRetry
+		conn.Breaker = config.shotgunBreaker
+		conn.Coalescer = config.shotgunCoalescer
+		conn.Cache = config.shotgunCache
+		conn.CacheTTL = config.shotgunCacheTTL
+		conn.CacheTTLs = config.shotgunCacheTTLs
 
-		if !strings.HasPrefix(s[0], "Basic") {
+	}
+	connectionCache[hash] = conn
+	connectionCacheLock.Unlock()
+	conn.Log()
+	return conn, hash, http.StatusOK
+}
+
+// writeServiceUnavailable tells the client Shotgun is down and when to try
+// again.
+func writeServiceUnavailable(rw http.ResponseWriter, retryAfter time.Duration) {
+	setRetryAfter(rw, retryAfter)
+	rw.WriteHeader(http.StatusServiceUnavailable)
+	rw.Write([]byte("503 Shotgun Unavailable\n"))
+}
+
+// setRetryAfter sets Retry-After in whole seconds, rounded up.
+func setRetryAfter(rw http.ResponseWriter, retryAfter time.Duration) {
+	rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+}
+
+func ShotgunAuthMiddleware(config clientConfig) func(rw http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+
+	return func(rw http.ResponseWriter, req *http.Request, next http.HandlerFunc) {
+		conn, hash, status := shotgunConnection(config, req.Header.Get("Authorization"))
+		if status == http.StatusUnauthorized {
 			rw.Header().Set("WWW-Authenticate", `Basic realm="shotgun-restful"`)
 			rw.WriteHeader(http.StatusUnauthorized)
 			rw.Write([]byte("401 Unauthorized\n"))
 			return
-		}
-
-		var isUser bool
-		if s[0] == "Basic-User" {
-			isUser = true
-		}
-
-		b, err := base64.StdEncoding.DecodeString(s[1])
-		if err != nil {
-			rw.WriteHeader(http.StatusInternalServerError)
+		} else if status != http.StatusOK {
+			rw.WriteHeader(status)
 			return
 		}
 
-		pair := strings.SplitN(string(b), ":", 2)
-		if len(pair) != 2 {
-			rw.WriteHeader(http.StatusForbidden)
+		// Don't wait on Shotgun while it's down.
+		if retryAfter := config.shotgunBreaker.RetryAfter(); retryAfter > 0 {
+			writeServiceUnavailable(rw, retryAfter)
 			return
 		}
 
-		name := pair[0]
-		key := pair[1]
-
-		hasher := sha1.New()
-		hash := hex.EncodeToString(hasher.Sum([]byte(fmt.Sprintf("%s%v%s%s", config.shotgunHost, isUser, name, key))))
-
-		conn, ok := connectionCache[hash]
-		if !ok {
-			if isUser {
-				conn = NewUserShotgun(config.shotgunHost, name, key)
-			} else {
-				conn = NewShotgun(config.shotgunHost, name, key)
-			}
-
-		}
-		connectionCache[hash] = conn
-		conn.Log()
+		// Calls stop when the request does.
 		ctx := req.Context()
-		ctx = context.WithValue(ctx, "sgConn", conn)
+		ctx = context.WithValue(ctx, "sgConn", conn.WithContext(ctx))
+		// The hash identifies the connection for anything shared between
+		// requests made with the same credentials. ie: event pollers.
+		ctx = context.WithValue(ctx, "sgConnKey", hash)
 		next(rw, req.WithContext(ctx))
 	}
 }
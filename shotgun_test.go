@@ -1,8 +1,18 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/brandonvfx/sg-restful/shotgun"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,3 +55,166 @@ func TestShotgunGetFullUrl(t *testing.T) {
 	fullURL := getFullURL("http://localhost")
 	assert.Equal(t, "http://localhost/api3/json", fullURL)
 }
+
+func TestShotgunTimeoutStatus(t *testing.T) {
+	server, _, config, _ := mockShotgunFunc(func(call shotgunCall) string {
+		time.Sleep(200 * time.Millisecond)
+		return `{"results":{"entities":[],"paging_info":{"entity_count":0}}}`
+	})
+	defer server.Close()
+	config.shotgunTimeout = time.Minute
+	config.shotgunMethodTimeouts = map[string]time.Duration{"read": 20 * time.Millisecond}
+
+	w := httptest.NewRecorder()
+	router(config).ServeHTTP(w, getRequest("/Shot/1"))
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
+
+func TestShotgunCanceledStatus(t *testing.T) {
+	server, _, config, calls := mockShotgunFunc(func(call shotgunCall) string {
+		time.Sleep(200 * time.Millisecond)
+		return `{"results":{"entities":[],"paging_info":{"entity_count":0}}}`
+	})
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	w := httptest.NewRecorder()
+	router(config).ServeHTTP(w, getRequest("/Shot").WithContext(ctx))
+	assert.Equal(t, statusClientClosedRequest, w.Code)
+	assert.Len(t, calls.Method("read"), 1)
+}
+
+func TestShotgunErrorStatus(t *testing.T) {
+	assert.Equal(t, statusClientClosedRequest, shotgunErrorStatus(&url.Error{Op: "Post", Err: context.Canceled}, 500))
+	assert.Equal(t, http.StatusGatewayTimeout, shotgunErrorStatus(&url.Error{Op: "Post", Err: context.DeadlineExceeded}, 500))
+	assert.Equal(t, http.StatusBadGateway, shotgunErrorStatus(errors.New("bad"), http.StatusBadGateway))
+	assert.Equal(t, http.StatusServiceUnavailable, shotgunErrorStatus(&shotgun.CircuitOpenError{RetryAfter: time.Second}, 500))
+}
+
+func TestWriteShotgunError(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeShotgunError(w, &url.Error{Op: "Post", Err: &shotgun.CircuitOpenError{RetryAfter: 1500 * time.Millisecond}}, http.StatusBadGateway)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	w = httptest.NewRecorder()
+	writeShotgunError(w, errors.New("bad"), http.StatusBadGateway)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Equal(t, "", w.Header().Get("Retry-After"))
+}
+
+// flakyShotgun answers 503 to the first failures calls then a read of one
+// shot.
+func flakyShotgun(failures int) (*httptest.Server, clientConfig, func() int) {
+	var lock sync.Mutex
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		calls++
+		n := calls
+		lock.Unlock()
+		if n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"results":{"entities":[{"type":"Shot","id":1}],"paging_info":{"entity_count":1}}}`)
+	}))
+
+	config := newClientConfig("0.0.0-test.1", server.URL)
+	config.shotgunRetry.Backoff = time.Millisecond
+	return server, config, func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return calls
+	}
+}
+
+func TestShotgunRetry(t *testing.T) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	server, config, calls := flakyShotgun(2)
+	defer server.Close()
+
+	w := httptest.NewRecorder()
+	router(config).ServeHTTP(w, getRequest("/Shot"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 3, calls())
+}
+
+func TestShotgunBreaker(t *testing.T) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	server, config, calls := flakyShotgun(100)
+	defer server.Close()
+	config.shotgunRetry.Retries = 0
+	config.shotgunBreaker = shotgun.NewBreaker(2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router(config).ServeHTTP(w, getRequest("/Shot"))
+		assert.Equal(t, http.StatusBadGateway, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	router(config).ServeHTTP(w, getRequest("/Shot"))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, 2, calls())
+}
+
+func TestParseDurations(t *testing.T) {
+	timeouts, err := parseDurations("read=30s, summarize=2m")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]time.Duration{"read": 30 * time.Second, "summarize": 2 * time.Minute}, timeouts)
+
+	_, err = parseDurations("read")
+	assert.NotNil(t, err)
+	_, err = parseDurations("read=soon")
+	assert.NotNil(t, err)
+}
+
+func TestShotgunCoalescing(t *testing.T) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	release := make(chan struct{})
+	server, _, config, calls := mockShotgunFunc(func(call shotgunCall) string {
+		<-release
+		return `{"results":{"entities":[{"type":"Version","id":1}],"paging_info":{"entity_count":1}}}`
+	})
+	defer server.Close()
+	defer close(release)
+	// Streamed reads aren't coalesced.
+	config.streamPageSize = 0
+
+	const clients = 10
+	handler := router(config)
+	codes := make(chan int, clients)
+	for i := 0; i < clients; i++ {
+		go func() {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, getRequest(`/Version?q=[["sg_status_list","is","rev"]]`))
+			codes <- w.Code
+		}()
+	}
+	for config.shotgunCoalescer.Stats().Coalesced < clients-1 {
+		time.Sleep(time.Millisecond)
+	}
+	release <- struct{}{}
+	for i := 0; i < clients; i++ {
+		assert.Equal(t, http.StatusOK, <-codes)
+	}
+	assert.Len(t, calls.Method("read"), 1)
+
+	publishCoalescing(config.shotgunCoalescer)
+	w := httptest.NewRecorder()
+	router(config).ServeHTTP(w, getRequest("/debug/vars"))
+	var vars map[string]json.RawMessage
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &vars))
+	assert.Len(t, vars, 1)
+	var coalescing shotgun.CoalescerStats
+	assert.Nil(t, json.Unmarshal(vars["shotgun_coalescing"], &coalescing))
+	assert.Equal(t, int64(clients-1), coalescing.Coalesced)
+
+	// Without credentials there's nothing, cmdline would show the script key.
+	w = httptest.NewRecorder()
+	router(config).ServeHTTP(w, httptest.NewRequest("GET", "/debug/vars", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -4,10 +4,13 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"sync"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -40,7 +43,7 @@ func mockShotgun(code int, body string) (*httptest.Server, *Shotgun, clientConfi
 		ServerURL:  server.URL,
 		ScriptName: "fake-script",
 		ScriptKey:  "fake-key",
-		client:     *httpClient,
+		client:     httpClient,
 	}
 
 	config := newClientConfig("0.0.0-test.1", server.URL)
@@ -48,6 +51,89 @@ func mockShotgun(code int, body string) (*httptest.Server, *Shotgun, clientConfi
 	return server, client, config
 }
 
+// shotgunCall is a single rpc call received by a mock server.
+type shotgunCall struct {
+	Method string
+	Query  map[string]interface{}
+	Params []interface{}
+}
+
+// shotgunCalls records the rpc calls received by a mock server.
+type shotgunCalls struct {
+	sync.Mutex
+	calls []shotgunCall
+}
+
+func (sc *shotgunCalls) add(call shotgunCall) {
+	sc.Lock()
+	defer sc.Unlock()
+	sc.calls = append(sc.calls, call)
+}
+
+// All returns a copy of the recorded calls.
+func (sc *shotgunCalls) All() []shotgunCall {
+	sc.Lock()
+	defer sc.Unlock()
+	return append([]shotgunCall{}, sc.calls...)
+}
+
+// Method returns the recorded calls for a method.
+func (sc *shotgunCalls) Method(method string) []shotgunCall {
+	calls := []shotgunCall{}
+	for _, call := range sc.All() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// mockShotgunMethods is like mockShotgun but responds per rpc method and
+// records every call it gets. Methods without a response get an exception.
+func mockShotgunMethods(responses map[string]string) (*httptest.Server, *Shotgun, clientConfig, *shotgunCalls) {
+	return mockShotgunFunc(func(call shotgunCall) string {
+		respBody, ok := responses[call.Method]
+		if !ok {
+			respBody = fmt.Sprintf(`{"exception":true,"message":"unexpected method %s","error_code":100}`, call.Method)
+		}
+		return respBody
+	})
+}
+
+// mockShotgunFunc is like mockShotgunMethods but the response to each call
+// comes from respond.
+func mockShotgunFunc(respond func(call shotgunCall) string) (*httptest.Server, *Shotgun, clientConfig, *shotgunCalls) {
+	calls := &shotgunCalls{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var request struct {
+			MethodName string        `json:"method_name"`
+			Params     []interface{} `json:"params"`
+		}
+		json.Unmarshal(body, &request)
+
+		call := shotgunCall{Method: request.MethodName, Params: request.Params}
+		if len(request.Params) > 1 {
+			call.Query, _ = request.Params[1].(map[string]interface{})
+		}
+		calls.add(call)
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, respond(call))
+	}))
+
+	client := &Shotgun{
+		ServerURL:  server.URL,
+		ScriptName: "fake-script",
+		ScriptKey:  "fake-key",
+		client:     shotgunHTTPClient,
+	}
+
+	config := newClientConfig("0.0.0-test.1", server.URL)
+
+	return server, client, config, calls
+}
+
 func getRequest(path string) *http.Request {
 	req, _ := http.NewRequest("GET", path, nil)
 	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", fakeAuthB64))
@@ -71,3 +157,9 @@ func patchRequest(path, body string) *http.Request {
 	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", fakeAuthB64))
 	return req
 }
+
+func putRequest(path, body string) *http.Request {
+	req, _ := http.NewRequest("PUT", path, bytes.NewReader([]byte(body)))
+	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", fakeAuthB64))
+	return req
+}
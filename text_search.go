@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Response Structs
+type textSearchResults struct {
+	Matches []map[string]interface{} `json:"matches"`
+	Terms   []string                 `json:"terms"`
+}
+
+type textSearchResponse struct {
+	Results   textSearchResults `json:"results"`
+	Exception bool              `json:"exception,omitempty"`
+	Message   string            `json:"message,omitempty"`
+	ErrorCode int               `json:"error_code,omitempty"`
+}
+
+// Query Structs
+type textSearchQuery struct {
+	Text        string                 `json:"text"`
+	EntityTypes map[string]readFilters `json:"entity_types"`
+	ProjectIDs  []int                  `json:"project_ids"`
+	MaxResults  int                    `json:"max_results"`
+}
+
+func newTextSearchQuery(text string) textSearchQuery {
+	return textSearchQuery{
+		Text:        text,
+		EntityTypes: make(map[string]readFilters),
+		ProjectIDs:  make([]int, 0),
+		MaxResults:  50,
+	}
+}
+
+// Handlers
+
+// textSearchHandler searches across entity types. Shotgun exposes this as
+// 'query_display_name_cache', which is what the python api's text_search uses.
+func textSearchHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling textSearchHandler")
+
+		req.ParseForm()
+
+		text := req.FormValue("text")
+		if text == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, "text missing")
+			return
+		}
+
+		entityTypes := splitList(req.FormValue("types"))
+		if len(entityTypes) == 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, "types missing")
+			return
+		}
+
+		page := 1
+		if value := req.FormValue("page"); value != "" {
+			var err error
+			page, err = strconv.Atoi(value)
+			if err != nil || page < 1 {
+				log.Errorf("Could not convert page '%v' to int", value)
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(rw, "Could not convert page '%v' to int", value)
+				return
+			}
+		}
+
+		query := newTextSearchQuery(text)
+		limit := query.MaxResults
+		if value := req.FormValue("limit"); value != "" {
+			var err error
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 {
+				log.Errorf("Could not convert limit '%v' to int", value)
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(rw, "Could not convert limit '%v' to int", value)
+				return
+			}
+		}
+		// Shotgun has no paging for text searches so ask for everything up to
+		// the end of the requested page and slice it here.
+		query.MaxResults = limit * page
+
+		for _, value := range splitList(req.FormValue("project_ids")) {
+			projectID, err := strconv.Atoi(value)
+			if err != nil {
+				log.Errorf("Could not convert project id '%v' to int", value)
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(rw, "Could not convert project id '%v' to int", value)
+				return
+			}
+			query.ProjectIDs = append(query.ProjectIDs, projectID)
+		}
+
+		// 'q' filters every type, 'q[<type>]' overrides it for a single type.
+		typeFilters, err := parseTypeQueries(req, entityTypes)
+		if err != nil {
+			qpeError := err.(queryParseError)
+			log.Error("Request Error: ", qpeError)
+			rw.WriteHeader(qpeError.StatusCode)
+			return
+		}
+		for _, entityType := range entityTypes {
+			queryFilters, ok := typeFilters[entityType]
+			if !ok {
+				queryFilters = newReadFilters()
+			}
+			query.EntityTypes[entityType] = queryFilters
+		}
+
+		log.Debugf("Query: %v", StructToString(query))
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+
+		sgReq, err := sg.Request("query_display_name_cache", query)
+		if err != nil {
+			log.Error("Request Error: ", err)
+			writeShotgunError(rw, err, http.StatusInternalServerError)
+			return
+		}
+		defer sgReq.Body.Close()
+
+		var searchResp textSearchResponse
+		respBody, err := ioutil.ReadAll(sgReq.Body)
+		if err != nil {
+			log.Error(err)
+			writeShotgunError(rw, err, http.StatusBadGateway)
+			return
+		}
+		err = json.Unmarshal(respBody, &searchResp)
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		log.Debugf("Response: %v", searchResp)
+
+		if searchResp.Exception {
+			rw.WriteHeader(http.StatusInternalServerError)
+			rw.Write([]byte(searchResp.Message))
+			return
+		}
+
+		matches := searchResp.Results.Matches
+		start := (page - 1) * limit
+		if start >= len(matches) {
+			rw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		end := start + limit
+		if end > len(matches) {
+			end = len(matches)
+		}
+
+		grouped := make(map[string][]map[string]interface{})
+		for _, match := range matches[start:end] {
+			entityType, _ := match["type"].(string)
+			grouped[entityType] = append(grouped[entityType], match)
+		}
+
+		jsonResp, err := json.Marshal(grouped)
+		if err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Content-Type", "application/json")
+		rw.WriteHeader(http.StatusOK)
+		rw.Write(jsonResp)
+	}
+}
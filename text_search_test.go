@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type TextSearchTestSuite struct {
+	suite.Suite
+}
+
+func (suite *TextSearchTestSuite) SetupSuite() {
+	manager := GetQPManager()
+	log.Info(" -- TextSearch Test Suite --\n")
+	manager.SetActiveParsers("format1", "format2", "format3")
+}
+
+func TestTextSearchTestSuite(t *testing.T) {
+	suite.Run(t, new(TextSearchTestSuite))
+}
+
+const textSearchBody = `{"results":{"matches":[
+	{"type":"Shot","id":1,"name":"bunny_010_0010"},
+	{"type":"Asset","id":2,"name":"bunny"},
+	{"type":"Shot","id":3,"name":"bunny_010_0020"}],"terms":["bunny"]}}`
+
+func (suite *TextSearchTestSuite) TestSearchGrouped() {
+	req := getRequest("/_search?text=bunny&types=Shot,Asset")
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"query_display_name_cache": textSearchBody,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+
+	suite.Equal(http.StatusOK, w.Code)
+
+	var jsonResp map[string][]map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &jsonResp)
+	suite.Nil(err)
+	suite.Len(jsonResp["Shot"], 2)
+	suite.Len(jsonResp["Asset"], 1)
+
+	sent := calls.Method("query_display_name_cache")
+	suite.Len(sent, 1)
+	suite.Equal("bunny", sent[0].Query["text"])
+	suite.Contains(sent[0].Query["entity_types"], "Shot")
+	suite.Contains(sent[0].Query["entity_types"], "Asset")
+}
+
+func (suite *TextSearchTestSuite) TestSearchTypeFilters() {
+	req := getRequest(`/_search?text=bunny&types=Shot,Asset&q=[["sg_status_list","is","ip"]]&q[Asset]=[["code","is","bunny"]]`)
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"query_display_name_cache": textSearchBody,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+
+	suite.Equal(http.StatusOK, w.Code)
+
+	sent := calls.Method("query_display_name_cache")
+	suite.Len(sent, 1)
+	entityTypes := sent[0].Query["entity_types"].(map[string]interface{})
+
+	shotCond := entityTypes["Shot"].(map[string]interface{})["conditions"].([]interface{})[0]
+	suite.Equal("sg_status_list", shotCond.(map[string]interface{})["path"])
+
+	assetCond := entityTypes["Asset"].(map[string]interface{})["conditions"].([]interface{})[0]
+	suite.Equal("code", assetCond.(map[string]interface{})["path"])
+}
+
+func (suite *TextSearchTestSuite) TestSearchPaging() {
+	req := getRequest("/_search?text=bunny&types=Shot,Asset&limit=2&page=2")
+	w := httptest.NewRecorder()
+
+	server, client, config, calls := mockShotgunMethods(map[string]string{
+		"query_display_name_cache": textSearchBody,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+
+	suite.Equal(http.StatusOK, w.Code)
+
+	var jsonResp map[string][]map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &jsonResp)
+	suite.Nil(err)
+	suite.Len(jsonResp, 1)
+	suite.Equal(float64(3), jsonResp["Shot"][0]["id"])
+
+	sent := calls.Method("query_display_name_cache")
+	suite.Equal(float64(4), sent[0].Query["max_results"])
+}
+
+func (suite *TextSearchTestSuite) TestSearchPastLastPage() {
+	req := getRequest("/_search?text=bunny&types=Shot&limit=10&page=3")
+	w := httptest.NewRecorder()
+
+	server, client, config, _ := mockShotgunMethods(map[string]string{
+		"query_display_name_cache": textSearchBody,
+	})
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+
+	suite.Equal(http.StatusNoContent, w.Code)
+}
+
+func (suite *TextSearchTestSuite) TestSearchMissingText() {
+	req := getRequest("/_search?types=Shot")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200, textSearchBody)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+
+	suite.Equal(http.StatusBadRequest, w.Code)
+}
+
+func (suite *TextSearchTestSuite) TestSearchMissingTypes() {
+	req := getRequest("/_search?text=bunny")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200, textSearchBody)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+
+	suite.Equal(http.StatusBadRequest, w.Code)
+}
+
+func (suite *TextSearchTestSuite) TestSearchBadQuery() {
+	req := getRequest("/_search?text=bunny&types=Shot&q=foo")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200, textSearchBody)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+
+	suite.Equal(http.StatusBadRequest, w.Code)
+}
+
+func (suite *TextSearchTestSuite) TestSearchException() {
+	req := getRequest("/_search?text=bunny&types=Shot")
+	w := httptest.NewRecorder()
+
+	server, client, config := mockShotgun(200,
+		`{"exception":true,"message":"API query_display_name_cache() failed","error_code":100}`)
+	defer server.Close()
+
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+
+	suite.Equal(http.StatusInternalServerError, w.Code)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/http2"
+)
+
+// transportConfig is how connections to Shotgun are made.
+type transportConfig struct {
+	MaxIdleConnsPerHost int
+	IdleConnTimeout     time.Duration
+	// KeepAlive is the tcp keep-alive period, 0 is off.
+	KeepAlive time.Duration
+	HTTP2     bool
+	// Proxy is the proxy url, empty uses HTTP_PROXY, HTTPS_PROXY and
+	// NO_PROXY.
+	Proxy string
+	// CAFile is a PEM bundle trusted along with the system's.
+	CAFile string
+	// CertFile and KeyFile are a client certificate for Shotgun.
+	CertFile string
+	KeyFile  string
+}
+
+func defaultTransportConfig() transportConfig {
+	return transportConfig{
+		MaxIdleConnsPerHost: 32,
+		IdleConnTimeout:     90 * time.Second,
+		KeepAlive:           30 * time.Second,
+		HTTP2:               true,
+	}
+}
+
+// newTransport makes a transport from its config.
+func newTransport(tc transportConfig) (*http.Transport, error) {
+	proxy := http.ProxyFromEnvironment
+	if tc.Proxy != "" {
+		proxyURL, err := url.Parse(tc.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("Bad proxy '%s': %v", tc.Proxy, err)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	tlsConfig := &tls.Config{}
+	if tc.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		pem, err := ioutil.ReadFile(tc.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates in CA bundle '%s'", tc.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if tc.CertFile != "" || tc.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(tc.CertFile, tc.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: tc.KeepAlive,
+		}).DialContext,
+		MaxIdleConnsPerHost:   tc.MaxIdleConnsPerHost,
+		IdleConnTimeout:       tc.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       tlsConfig,
+	}
+	if tc.HTTP2 {
+		// A transport with its own tls config only speaks HTTP/2 when told.
+		if err := http2.ConfigureTransport(transport); err != nil {
+			return nil, err
+		}
+	} else {
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return transport, nil
+}
+
+// shotgunHTTPClient is shared by every connection so they pool their
+// connections to Shotgun. main replaces it with one made from the flags.
+var shotgunHTTPClient = newShotgunHTTPClient(defaultTransportConfig())
+
+func newShotgunHTTPClient(tc transportConfig) *http.Client {
+	transport, err := newTransport(tc)
+	if err != nil {
+		log.Error("Could not make transport: ", err)
+		return &http.Client{}
+	}
+	return &http.Client{Transport: transport}
+}
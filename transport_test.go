@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTransport(t *testing.T) {
+	transport, err := newTransport(defaultTransportConfig())
+	assert.Nil(t, err)
+	assert.Equal(t, 32, transport.MaxIdleConnsPerHost)
+	assert.Contains(t, transport.TLSNextProto, "h2")
+
+	tc := defaultTransportConfig()
+	tc.HTTP2 = false
+	tc.Proxy = "http://proxy.example.com:3128"
+	transport, err = newTransport(tc)
+	assert.Nil(t, err)
+	assert.NotContains(t, transport.TLSNextProto, "h2")
+	req, _ := http.NewRequest("POST", "https://example.shotgunstudio.com/api3/json", nil)
+	proxyURL, err := transport.Proxy(req)
+	assert.Nil(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", proxyURL.String())
+
+	tc = defaultTransportConfig()
+	tc.CAFile = "missing.pem"
+	_, err = newTransport(tc)
+	assert.NotNil(t, err)
+
+	tc = defaultTransportConfig()
+	tc.CertFile = "missing.crt"
+	tc.KeyFile = "missing.key"
+	_, err = newTransport(tc)
+	assert.NotNil(t, err)
+}
+
+func TestTransportCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"results":{}}`)
+	}))
+	defer server.Close()
+
+	caFile, _ := ioutil.TempFile("", "ca")
+	defer os.Remove(caFile.Name())
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: server.TLS.Certificates[0].Certificate[0]})
+	caFile.Close()
+
+	tc := defaultTransportConfig()
+	_, err := (&http.Client{Transport: mustTransport(t, tc)}).Get(server.URL)
+	assert.NotNil(t, err)
+
+	tc.CAFile = caFile.Name()
+	resp, err := (&http.Client{Transport: mustTransport(t, tc)}).Get(server.URL)
+	if assert.Nil(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func mustTransport(t *testing.T, tc transportConfig) *http.Transport {
+	transport, err := newTransport(tc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transport
+}
+
+// TestTransportReuse loads the router and checks Shotgun connections are
+// reused rather than opened per call.
+func TestTransportReuse(t *testing.T) {
+	GetQPManager().SetActiveParsers("format1", "format2", "format3")
+	var lock sync.Mutex
+	opened := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		fmt.Fprint(w, `{"results":{"entities":[{"type":"Shot","id":1}],"paging_info":{"entity_count":1}}}`)
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			lock.Lock()
+			opened++
+			lock.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	config := newClientConfig("0.0.0-test.1", server.URL)
+	handler := router(config)
+	const workers = 8
+	const requests = 50
+	var wg sync.WaitGroup
+	failed := make(chan int, workers*requests)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < requests; i++ {
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, getRequest("/Shot"))
+				if rec.Code != http.StatusOK {
+					failed <- rec.Code
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(failed)
+
+	assert.Len(t, failed, 0)
+	lock.Lock()
+	defer lock.Unlock()
+	// A worker can dial while another frees a connection, so allow for a few
+	// spares.
+	assert.True(t, opened <= 2*workers, "%d connections for %d calls", opened, workers*requests)
+}
@@ -1,6 +1,10 @@
 package main
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+)
 
 func StructToString(s interface{}) string {
 	j, err := json.Marshal(s)
@@ -9,3 +13,31 @@ func StructToString(s interface{}) string {
 	}
 	return string(j)
 }
+
+// bracketParams collects query string values keyed like 'name[key]=value'
+// into a map of key to value. ie: 'q[Shot]=...&q[Asset]=...'
+func bracketParams(form url.Values, name string) map[string]string {
+	params := make(map[string]string)
+	prefix := name + "["
+	for k := range form {
+		if strings.HasPrefix(k, prefix) && strings.HasSuffix(k, "]") {
+			key := k[len(prefix) : len(k)-1]
+			if key != "" {
+				params[key] = form.Get(k)
+			}
+		}
+	}
+	return params
+}
+
+// splitList splits a comma separated query string value, dropping empty items.
+func splitList(value string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	log "github.com/sirupsen/logrus"
+)
+
+// webhookHistorySize is the number of recent deliveries kept per webhook.
+const webhookHistorySize = 100
+
+// webhookWorkers is the number of deliveries sent at once.
+const webhookWorkers = 4
+
+// webhook is a registration to POST events to a url.
+type webhook struct {
+	ID          string    `json:"id"`
+	EntityTypes []string  `json:"entity_types"`
+	EventTypes  []string  `json:"event_types,omitempty"`
+	Query       string    `json:"q,omitempty"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"secret,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Owner is the webhookOwner of the script that registered it, only it
+	// can see and change it.
+	Owner string `json:"owner,omitempty"`
+}
+
+// webhookOwner identifies a connection by its script name or login, so a
+// new key or password keeps its webhooks.
+func webhookOwner(sg Shotgun) string {
+	if sg.UserLogin != "" {
+		return "user:" + sg.UserLogin
+	}
+	return "script:" + sg.ScriptName
+}
+
+// wants checks the entity and event type, the query is checked separately.
+func (wh webhook) wants(event changeEvent) bool {
+	typeOK := false
+	for _, entityType := range wh.EntityTypes {
+		if entityType == event.EntityType {
+			typeOK = true
+		}
+	}
+	if !typeOK {
+		return false
+	}
+	if len(wh.EventTypes) == 0 {
+		return true
+	}
+	for _, eventType := range wh.EventTypes {
+		if eventType == event.Action {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookDelivery is one event sent to one webhook.
+type webhookDelivery struct {
+	ID         string      `json:"id"`
+	WebhookID  string      `json:"webhook_id"`
+	Event      changeEvent `json:"event"`
+	Status     string      `json:"status"`
+	Attempts   int         `json:"attempts"`
+	StatusCode int         `json:"status_code,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// Delivery statuses
+const (
+	deliveryPending   = "pending"
+	deliveryDelivered = "delivered"
+	deliveryRetrying  = "retrying"
+	deliveryDead      = "dead"
+)
+
+// webhookPayload is the body POSTed to webhooks.
+type webhookPayload struct {
+	WebhookID  string      `json:"webhook_id"`
+	DeliveryID string      `json:"delivery_id"`
+	Event      changeEvent `json:"event"`
+}
+
+func newWebhookID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// webhookSignature is the hex HMAC-SHA256 of the body using the secret.
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDispatcher follows the event log with the shared poller and sends
+// matching events to the registered webhooks.
+type webhookDispatcher struct {
+	sg        Shotgun
+	sgConnKey string
+	store     *webhookStore
+	interval  time.Duration
+	client    *http.Client
+
+	// MaxAttempts is how many times a delivery is tried before it becomes
+	// a dead letter. RetryBase is the wait before the first retry, doubling
+	// each time up to RetryMax.
+	MaxAttempts int
+	RetryBase   time.Duration
+	RetryMax    time.Duration
+
+	queue   chan *webhookDelivery
+	changed chan struct{}
+	stop    chan struct{}
+
+	historyLock sync.Mutex
+	history     map[string][]*webhookDelivery
+}
+
+func newWebhookDispatcher(sg Shotgun, sgConnKey string, store *webhookStore, interval time.Duration) *webhookDispatcher {
+	return &webhookDispatcher{
+		sg:          sg,
+		sgConnKey:   sgConnKey,
+		store:       store,
+		interval:    interval,
+		client:      &http.Client{Timeout: 30 * time.Second},
+		MaxAttempts: 5,
+		RetryBase:   time.Second,
+		RetryMax:    5 * time.Minute,
+		queue:       make(chan *webhookDelivery, 1000),
+		changed:     make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+		history:     make(map[string][]*webhookDelivery),
+	}
+}
+
+// Start runs the event log follower and the delivery workers, sending the
+// deliveries left pending by the last run first.
+func (wd *webhookDispatcher) Start() {
+	for i := 0; i < webhookWorkers; i++ {
+		go wd.worker()
+	}
+	go func() {
+		for _, delivery := range wd.store.Pending() {
+			delivery := delivery
+			wd.enqueue(&delivery)
+		}
+		wd.run()
+	}()
+}
+
+// Stop stops following the event log. Deliveries in flight stay pending in
+// the store for the next Start.
+func (wd *webhookDispatcher) Stop() {
+	close(wd.stop)
+}
+
+// Register stores the webhook and starts sending it events.
+func (wd *webhookDispatcher) Register(hook webhook) error {
+	if err := wd.store.AddWebhook(hook); err != nil {
+		return err
+	}
+	wd.notify()
+	return nil
+}
+
+// Unregister removes the webhook, returning false if it didn't exist.
+func (wd *webhookDispatcher) Unregister(id string) (bool, error) {
+	ok, err := wd.store.DeleteWebhook(id)
+	if ok {
+		wd.historyLock.Lock()
+		delete(wd.history, id)
+		wd.historyLock.Unlock()
+		wd.notify()
+	}
+	return ok, err
+}
+
+// History returns the recent deliveries for a webhook, newest first.
+func (wd *webhookDispatcher) History(id string) []webhookDelivery {
+	wd.historyLock.Lock()
+	defer wd.historyLock.Unlock()
+	deliveries := make([]webhookDelivery, 0, len(wd.history[id]))
+	for i := len(wd.history[id]) - 1; i >= 0; i-- {
+		deliveries = append(deliveries, *wd.history[id][i])
+	}
+	return deliveries
+}
+
+// Redeliver takes a dead letter and tries it again from the start.
+func (wd *webhookDispatcher) Redeliver(id string) (bool, error) {
+	delivery, ok, err := wd.store.RequeueDeadLetter(id)
+	if !ok || err != nil {
+		return ok, err
+	}
+	wd.enqueue(&delivery)
+	return true, nil
+}
+
+func (wd *webhookDispatcher) notify() {
+	select {
+	case wd.changed <- struct{}{}:
+	default:
+	}
+}
+
+func (wd *webhookDispatcher) entityTypes() []string {
+	seen := make(map[string]bool)
+	entityTypes := make([]string, 0)
+	for _, hook := range wd.store.Webhooks() {
+		for _, entityType := range hook.EntityTypes {
+			if !seen[entityType] {
+				seen[entityType] = true
+				entityTypes = append(entityTypes, entityType)
+			}
+		}
+	}
+	return entityTypes
+}
+
+// run subscribes to the events for every registered type, subscribing again
+// whenever the registrations change.
+func (wd *webhookDispatcher) run() {
+	for {
+		entityTypes := wd.entityTypes()
+		if len(entityTypes) == 0 {
+			select {
+			case <-wd.stop:
+				return
+			case <-wd.changed:
+				continue
+			}
+		}
+
+		sub, err := subscribeEvents(wd.sgConnKey, wd.sg, wd.interval, entityTypes)
+		if err != nil {
+			log.Error("Webhooks: ", err)
+			select {
+			case <-wd.stop:
+				return
+			case <-time.After(wd.interval):
+				continue
+			}
+		}
+
+		if !wd.catchUp(entityTypes, sub.Since) {
+			sub.Close()
+			continue
+		}
+
+		resubscribe := false
+		for !resubscribe {
+			select {
+			case <-wd.stop:
+				sub.Close()
+				return
+			case <-wd.changed:
+				resubscribe = true
+			case events, ok := <-sub.Events:
+				if !ok {
+					resubscribe = true
+					continue
+				}
+				wd.dispatch(events)
+			}
+		}
+		sub.Close()
+	}
+}
+
+// catchUp dispatches the events between the stored cursor and the poller's
+// position. On first start there is no cursor and nothing is replayed.
+func (wd *webhookDispatcher) catchUp(entityTypes []string, until int) bool {
+	cursor := wd.store.Cursor()
+	if cursor == 0 {
+		wd.store.SetCursor(until)
+		return true
+	}
+	for cursor < until {
+		events, err := readEventLog(wd.sg, entityTypes, cursor, until)
+		if err != nil {
+			log.Error("Webhooks: ", err)
+			return false
+		}
+		if len(events) == 0 {
+			break
+		}
+		wd.dispatch(events)
+		cursor = events[len(events)-1].ID
+		if len(events) < eventLogPageSize {
+			break
+		}
+	}
+	wd.store.SetCursor(until)
+	return true
+}
+
+// dispatch queues the deliveries of the events. They are kept in the store
+// with the cursor moved past the events before they are sent.
+func (wd *webhookDispatcher) dispatch(events []changeEvent) {
+	if len(events) == 0 {
+		return
+	}
+
+	deliveries := make([]webhookDelivery, 0)
+
+	for _, hook := range wd.store.Webhooks() {
+		wanted := make([]changeEvent, 0)
+		for _, event := range events {
+			if hook.wants(event) {
+				wanted = append(wanted, event)
+			}
+		}
+		if len(wanted) == 0 {
+			continue
+		}
+
+		if hook.Query != "" {
+			queryFilters, err := parseQuery(hook.Query)
+			if err != nil {
+				log.Errorf("Webhooks: %s bad query: %s", hook.ID, err)
+				continue
+			}
+			typeFilters := make(map[string]readFilters)
+			for _, entityType := range hook.EntityTypes {
+				typeFilters[entityType] = queryFilters
+			}
+			filter := eventFilter{sg: wd.sg, typeFilters: typeFilters}
+			wanted, err = filter.match(wanted)
+			if err != nil {
+				log.Errorf("Webhooks: %s query failed: %s", hook.ID, err)
+				continue
+			}
+		}
+
+		for _, event := range wanted {
+			now := time.Now().UTC()
+			deliveries = append(deliveries, webhookDelivery{
+				ID:        newWebhookID(),
+				WebhookID: hook.ID,
+				Event:     event,
+				Status:    deliveryPending,
+				CreatedAt: now,
+				UpdatedAt: now,
+			})
+		}
+	}
+
+	if err := wd.store.AddPending(deliveries, events[len(events)-1].ID); err != nil {
+		// Still sent, but lost if sg-restful stops before they are.
+		log.Error("Webhooks: ", err)
+	}
+	for i := range deliveries {
+		wd.enqueue(&deliveries[i])
+	}
+}
+
+func (wd *webhookDispatcher) enqueue(delivery *webhookDelivery) {
+	wd.historyLock.Lock()
+	history := wd.history[delivery.WebhookID]
+	found := false
+	for _, d := range history {
+		if d == delivery {
+			found = true
+		}
+	}
+	if !found {
+		history = append(history, delivery)
+		if len(history) > webhookHistorySize {
+			history = history[len(history)-webhookHistorySize:]
+		}
+		wd.history[delivery.WebhookID] = history
+	}
+	wd.historyLock.Unlock()
+
+	select {
+	case wd.queue <- delivery:
+	case <-wd.stop:
+	}
+}
+
+func (wd *webhookDispatcher) worker() {
+	for {
+		select {
+		case <-wd.stop:
+			return
+		case delivery := <-wd.queue:
+			wd.deliver(delivery)
+		}
+	}
+}
+
+// deliver sends one attempt of the delivery, scheduling a retry or moving it
+// to the dead letters when it fails.
+func (wd *webhookDispatcher) deliver(delivery *webhookDelivery) {
+	hook, ok := wd.store.Webhook(delivery.WebhookID)
+	if !ok {
+		// Unregistered since the event was dispatched.
+		if err := wd.store.RemovePending(delivery.ID); err != nil {
+			log.Error("Webhooks: ", err)
+		}
+		return
+	}
+
+	statusCode, err := wd.send(hook, delivery)
+
+	wd.historyLock.Lock()
+	delivery.Attempts++
+	delivery.StatusCode = statusCode
+	delivery.UpdatedAt = time.Now().UTC()
+	if err == nil {
+		delivery.Status = deliveryDelivered
+		delivery.Error = ""
+	} else {
+		delivery.Error = err.Error()
+		if delivery.Attempts >= wd.MaxAttempts {
+			delivery.Status = deliveryDead
+		} else {
+			delivery.Status = deliveryRetrying
+		}
+	}
+	snapshot := *delivery
+	wd.historyLock.Unlock()
+
+	log.WithFields(logrus.Fields{
+		"webhook":  hook.ID,
+		"delivery": delivery.ID,
+		"attempt":  snapshot.Attempts,
+		"status":   snapshot.Status,
+	}).Debug("Webhook delivery")
+
+	switch snapshot.Status {
+	case deliveryDelivered:
+		if err := wd.store.RemovePending(snapshot.ID); err != nil {
+			log.Error("Webhooks: ", err)
+		}
+	case deliveryDead:
+		if err := wd.store.AddDeadLetter(snapshot); err != nil {
+			log.Error("Webhooks: ", err)
+		}
+	case deliveryRetrying:
+		if err := wd.store.UpdatePending(snapshot); err != nil {
+			log.Error("Webhooks: ", err)
+		}
+		backoff := wd.RetryBase << uint(snapshot.Attempts-1)
+		if backoff > wd.RetryMax || backoff <= 0 {
+			backoff = wd.RetryMax
+		}
+		time.AfterFunc(backoff, func() {
+			wd.enqueue(delivery)
+		})
+	}
+}
+
+func (wd *webhookDispatcher) send(hook webhook, delivery *webhookDelivery) (int, error) {
+	body, err := json.Marshal(webhookPayload{
+		WebhookID:  hook.ID,
+		DeliveryID: delivery.ID,
+		Event:      delivery.Event,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sg-restful/"+Version)
+	req.Header.Set("X-SG-Restful-Event", delivery.Event.Action)
+	req.Header.Set("X-SG-Restful-Delivery", delivery.ID)
+	if hook.Secret != "" {
+		req.Header.Set("X-SG-Restful-Signature", "sha256="+webhookSignature(hook.Secret, body))
+	}
+
+	resp, err := wd.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
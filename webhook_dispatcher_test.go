@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stretchr/testify/suite"
+)
+
+// webhookTarget records the deliveries it gets, failing the first
+// failures of them.
+type webhookTarget struct {
+	sync.Mutex
+	failures   int
+	deliveries []*http.Request
+	bodies     [][]byte
+	received   chan struct{}
+}
+
+func newWebhookTarget(failures int) *webhookTarget {
+	return &webhookTarget{
+		failures: failures,
+		received: make(chan struct{}, 100),
+	}
+}
+
+func (wt *webhookTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	wt.Lock()
+	wt.deliveries = append(wt.deliveries, r)
+	wt.bodies = append(wt.bodies, body)
+	fail := len(wt.deliveries) <= wt.failures
+	wt.Unlock()
+
+	if fail {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	wt.received <- struct{}{}
+}
+
+func (wt *webhookTarget) wait(n int) bool {
+	for i := 0; i < n; i++ {
+		select {
+		case <-wt.received:
+		case <-time.After(2 * time.Second):
+			return false
+		}
+	}
+	return true
+}
+
+type WebhookDispatcherTestSuite struct {
+	suite.Suite
+	dir      string
+	eventLog *fakeEventLog
+	sgServer *httptest.Server
+}
+
+func (suite *WebhookDispatcherTestSuite) SetupSuite() {
+	manager := GetQPManager()
+	log.Info(" -- WebhookDispatcher Test Suite --\n")
+	manager.SetActiveParsers("format1", "format2", "format3")
+}
+
+func (suite *WebhookDispatcherTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "sg-restful-webhooks")
+	suite.Require().Nil(err)
+	suite.dir = dir
+
+	suite.eventLog = newFakeEventLog()
+	suite.eventLog.addEvent(1, "Version", "New", 1)
+	suite.sgServer = httptest.NewServer(suite.eventLog)
+}
+
+func (suite *WebhookDispatcherTestSuite) TearDownTest() {
+	suite.sgServer.Close()
+	os.RemoveAll(suite.dir)
+}
+
+func (suite *WebhookDispatcherTestSuite) dispatcher() *webhookDispatcher {
+	store, err := newWebhookStore(filepath.Join(suite.dir, "webhooks.json"))
+	suite.Require().Nil(err)
+	sg := NewShotgun(suite.sgServer.URL, "webhook-script", "webhook-key")
+	key := connectionKey(suite.sgServer.URL, false, "webhook-script", "webhook-key")
+	wd := newWebhookDispatcher(sg, key, store, 10*time.Millisecond)
+	wd.RetryBase = 5 * time.Millisecond
+	wd.MaxAttempts = 3
+	return wd
+}
+
+func TestWebhookDispatcherTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhookDispatcherTestSuite))
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDeliverSigned() {
+	target := newWebhookTarget(0)
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+
+	wd := suite.dispatcher()
+	wd.Start()
+	defer wd.Stop()
+
+	err := wd.Register(webhook{
+		ID:          "hook1",
+		EntityTypes: []string{"Version"},
+		EventTypes:  []string{"update"},
+		URL:         targetServer.URL,
+		Secret:      "shh",
+	})
+	suite.Nil(err)
+
+	// Give the dispatcher time to subscribe before anything happens.
+	time.Sleep(50 * time.Millisecond)
+	suite.eventLog.addEvent(2, "Version", "New", 2)
+	suite.eventLog.addEvent(3, "Version", "Change", 2)
+	suite.True(target.wait(1))
+
+	time.Sleep(20 * time.Millisecond)
+	target.Lock()
+	defer target.Unlock()
+	suite.Len(target.deliveries, 1)
+	req := target.deliveries[0]
+	suite.Equal("update", req.Header.Get("X-SG-Restful-Event"))
+	suite.Equal("sha256="+webhookSignature("shh", target.bodies[0]), req.Header.Get("X-SG-Restful-Signature"))
+
+	var payload webhookPayload
+	suite.Nil(json.Unmarshal(target.bodies[0], &payload))
+	suite.Equal("hook1", payload.WebhookID)
+	suite.Equal(3, payload.Event.ID)
+
+	history := wd.History("hook1")
+	suite.Len(history, 1)
+	suite.Equal(deliveryDelivered, history[0].Status)
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDeliverQuery() {
+	target := newWebhookTarget(0)
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+
+	suite.eventLog.addEntity("Version", map[string]interface{}{"type": "Version", "id": 5})
+
+	wd := suite.dispatcher()
+	wd.Start()
+	defer wd.Stop()
+
+	wd.Register(webhook{
+		ID:          "hook1",
+		EntityTypes: []string{"Version"},
+		Query:       `[["code","is","match"]]`,
+		URL:         targetServer.URL,
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	suite.eventLog.addEvent(2, "Version", "Change", 4)
+	suite.eventLog.addEvent(3, "Version", "Change", 5)
+	suite.True(target.wait(1))
+
+	target.Lock()
+	defer target.Unlock()
+	var payload webhookPayload
+	suite.Nil(json.Unmarshal(target.bodies[0], &payload))
+	suite.Equal(5, payload.Event.EntityID)
+	suite.Empty(target.deliveries[0].Header.Get("X-SG-Restful-Signature"))
+}
+
+func (suite *WebhookDispatcherTestSuite) TestRetryThenDeliver() {
+	target := newWebhookTarget(2)
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+
+	wd := suite.dispatcher()
+	wd.Start()
+	defer wd.Stop()
+
+	wd.Register(webhook{ID: "hook1", EntityTypes: []string{"Version"}, URL: targetServer.URL})
+
+	time.Sleep(50 * time.Millisecond)
+	suite.eventLog.addEvent(2, "Version", "Change", 1)
+	suite.True(target.wait(3))
+
+	time.Sleep(20 * time.Millisecond)
+	history := wd.History("hook1")
+	suite.Len(history, 1)
+	suite.Equal(deliveryDelivered, history[0].Status)
+	suite.Equal(3, history[0].Attempts)
+	suite.Empty(wd.store.DeadLetters())
+	suite.Empty(wd.store.Pending())
+}
+
+func (suite *WebhookDispatcherTestSuite) TestDeadLetter() {
+	target := newWebhookTarget(100)
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+
+	wd := suite.dispatcher()
+	wd.Start()
+	defer wd.Stop()
+
+	wd.Register(webhook{ID: "hook1", EntityTypes: []string{"Version"}, URL: targetServer.URL})
+
+	time.Sleep(50 * time.Millisecond)
+	suite.eventLog.addEvent(2, "Version", "Change", 1)
+	suite.True(target.wait(3))
+
+	time.Sleep(20 * time.Millisecond)
+	deadLetters := wd.store.DeadLetters()
+	suite.Require().Len(deadLetters, 1)
+	suite.Equal(deliveryDead, deadLetters[0].Status)
+	suite.Equal(http.StatusServiceUnavailable, deadLetters[0].StatusCode)
+	suite.Empty(wd.store.Pending())
+
+	// Redelivering takes it off the dead letters.
+	ok, err := wd.Redeliver(deadLetters[0].ID)
+	suite.True(ok)
+	suite.Nil(err)
+	suite.True(target.wait(1))
+}
+
+func (suite *WebhookDispatcherTestSuite) TestPersistAndResume() {
+	target := newWebhookTarget(0)
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+
+	wd := suite.dispatcher()
+	wd.Start()
+	wd.Register(webhook{ID: "hook1", EntityTypes: []string{"Version"}, URL: targetServer.URL})
+	time.Sleep(50 * time.Millisecond)
+	wd.Stop()
+	suite.Equal(1, wd.store.Cursor())
+
+	// Happens while sg-restful is down.
+	suite.eventLog.addEvent(2, "Version", "Change", 1)
+
+	wd = suite.dispatcher()
+	hooks := wd.store.Webhooks()
+	suite.Require().Len(hooks, 1)
+	suite.Equal("hook1", hooks[0].ID)
+
+	wd.Start()
+	defer wd.Stop()
+	suite.True(target.wait(1))
+
+	var payload webhookPayload
+	target.Lock()
+	suite.Nil(json.Unmarshal(target.bodies[0], &payload))
+	target.Unlock()
+	suite.Equal(2, payload.Event.ID)
+}
+
+func (suite *WebhookDispatcherTestSuite) TestPendingAcrossRestart() {
+	target := newWebhookTarget(1)
+	targetServer := httptest.NewServer(target)
+	defer targetServer.Close()
+
+	wd := suite.dispatcher()
+	wd.RetryBase = time.Minute
+	wd.Start()
+	wd.Register(webhook{ID: "hook1", EntityTypes: []string{"Version"}, URL: targetServer.URL})
+	time.Sleep(50 * time.Millisecond)
+	suite.eventLog.addEvent(2, "Version", "Change", 1)
+	suite.True(target.wait(1))
+	time.Sleep(20 * time.Millisecond)
+
+	// Stopped waiting to retry, the cursor is past the event but the
+	// delivery is kept.
+	wd.Stop()
+	suite.Equal(2, wd.store.Cursor())
+	pending := wd.store.Pending()
+	suite.Require().Len(pending, 1)
+	suite.Equal(1, pending[0].Attempts)
+
+	wd = suite.dispatcher()
+	wd.Start()
+	defer wd.Stop()
+	suite.True(target.wait(1))
+
+	var payload webhookPayload
+	target.Lock()
+	suite.Nil(json.Unmarshal(target.bodies[1], &payload))
+	target.Unlock()
+	suite.Equal(pending[0].ID, payload.DeliveryID)
+	time.Sleep(20 * time.Millisecond)
+	suite.Empty(wd.store.Pending())
+}
+
+func (suite *WebhookDispatcherTestSuite) TestUnregister() {
+	wd := suite.dispatcher()
+	wd.Register(webhook{ID: "hook1", EntityTypes: []string{"Version"}, URL: "http://localhost"})
+
+	ok, err := wd.Unregister("hook1")
+	suite.True(ok)
+	suite.Nil(err)
+	suite.Empty(wd.store.Webhooks())
+
+	ok, err = wd.Unregister("hook1")
+	suite.False(ok)
+	suite.Nil(err)
+}
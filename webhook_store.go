@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// webhookMaxDeadLetters is the most dead letters kept in the store.
+const webhookMaxDeadLetters = 1000
+
+// webhookStoreData is what is written to disk.
+type webhookStoreData struct {
+	// Cursor is the last EventLogEntry id that was dispatched so events
+	// aren't missed across restarts.
+	Cursor      int               `json:"cursor"`
+	Webhooks    []webhook         `json:"webhooks"`
+	DeadLetters []webhookDelivery `json:"dead_letters"`
+	// Pending deliveries are kept until they are delivered or dead so a
+	// restart sends them again.
+	Pending []webhookDelivery `json:"pending"`
+}
+
+// webhookStore keeps webhook registrations, pending deliveries, dead letters
+// and the event log cursor in a json file.
+type webhookStore struct {
+	path string
+	lock sync.Mutex
+	data webhookStoreData
+}
+
+// newWebhookStore loads the store at path. A missing file is an empty store.
+func newWebhookStore(path string) (*webhookStore, error) {
+	store := &webhookStore{
+		path: path,
+		data: webhookStoreData{
+			Webhooks:    make([]webhook, 0),
+			DeadLetters: make([]webhookDelivery, 0),
+			Pending:     make([]webhookDelivery, 0),
+		},
+	}
+
+	body, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, &store.data); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// save writes the store to a temp file and renames it over the old one so
+// a crash never leaves a half written store. The lock must be held.
+func (ws *webhookStore) save() error {
+	body, err := json.MarshalIndent(ws.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(ws.path), ".webhooks")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), ws.path)
+}
+
+func (ws *webhookStore) Cursor() int {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	return ws.data.Cursor
+}
+
+func (ws *webhookStore) SetCursor(cursor int) error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if cursor <= ws.data.Cursor {
+		return nil
+	}
+	ws.data.Cursor = cursor
+	return ws.save()
+}
+
+func (ws *webhookStore) Pending() []webhookDelivery {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	return append([]webhookDelivery{}, ws.data.Pending...)
+}
+
+// AddPending keeps the deliveries of the events up to cursor and moves the
+// cursor past them in one write, so the events are never skipped without
+// their deliveries being kept.
+func (ws *webhookStore) AddPending(deliveries []webhookDelivery, cursor int) error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if len(deliveries) == 0 && cursor <= ws.data.Cursor {
+		return nil
+	}
+	ws.data.Pending = append(ws.data.Pending, deliveries...)
+	if cursor > ws.data.Cursor {
+		ws.data.Cursor = cursor
+	}
+	return ws.save()
+}
+
+// UpdatePending saves a retried delivery's attempts.
+func (ws *webhookStore) UpdatePending(delivery webhookDelivery) error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if ws.removePending(delivery.ID) {
+		ws.data.Pending = append(ws.data.Pending, delivery)
+		return ws.save()
+	}
+	return nil
+}
+
+// RemovePending forgets a delivery that was delivered or is no longer wanted.
+func (ws *webhookStore) RemovePending(id string) error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	if ws.removePending(id) {
+		return ws.save()
+	}
+	return nil
+}
+
+// removePending removes a pending delivery, the lock must be held.
+func (ws *webhookStore) removePending(id string) bool {
+	for i, delivery := range ws.data.Pending {
+		if delivery.ID == id {
+			ws.data.Pending = append(ws.data.Pending[:i], ws.data.Pending[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (ws *webhookStore) Webhooks() []webhook {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	return append([]webhook{}, ws.data.Webhooks...)
+}
+
+func (ws *webhookStore) Webhook(id string) (webhook, bool) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	for _, hook := range ws.data.Webhooks {
+		if hook.ID == id {
+			return hook, true
+		}
+	}
+	return webhook{}, false
+}
+
+func (ws *webhookStore) AddWebhook(hook webhook) error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	ws.data.Webhooks = append(ws.data.Webhooks, hook)
+	return ws.save()
+}
+
+// DeleteWebhook removes the webhook, returning false if it didn't exist.
+func (ws *webhookStore) DeleteWebhook(id string) (bool, error) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	for i, hook := range ws.data.Webhooks {
+		if hook.ID == id {
+			ws.data.Webhooks = append(ws.data.Webhooks[:i], ws.data.Webhooks[i+1:]...)
+			return true, ws.save()
+		}
+	}
+	return false, nil
+}
+
+func (ws *webhookStore) DeadLetters() []webhookDelivery {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	return append([]webhookDelivery{}, ws.data.DeadLetters...)
+}
+
+// AddDeadLetter keeps a delivery that ran out of attempts instead of as
+// pending, dropping the oldest once there are too many.
+func (ws *webhookStore) AddDeadLetter(delivery webhookDelivery) error {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	ws.removePending(delivery.ID)
+	ws.data.DeadLetters = append(ws.data.DeadLetters, delivery)
+	if over := len(ws.data.DeadLetters) - webhookMaxDeadLetters; over > 0 {
+		ws.data.DeadLetters = ws.data.DeadLetters[over:]
+	}
+	return ws.save()
+}
+
+func (ws *webhookStore) DeadLetter(id string) (webhookDelivery, bool) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	for _, delivery := range ws.data.DeadLetters {
+		if delivery.ID == id {
+			return delivery, true
+		}
+	}
+	return webhookDelivery{}, false
+}
+
+// RequeueDeadLetter moves a dead letter back to pending with its attempts
+// reset and returns it.
+func (ws *webhookStore) RequeueDeadLetter(id string) (webhookDelivery, bool, error) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+	for i, delivery := range ws.data.DeadLetters {
+		if delivery.ID == id {
+			ws.data.DeadLetters = append(ws.data.DeadLetters[:i], ws.data.DeadLetters[i+1:]...)
+			delivery.Status = deliveryPending
+			delivery.Attempts = 0
+			delivery.Error = ""
+			ws.data.Pending = append(ws.data.Pending, delivery)
+			return delivery, true, ws.save()
+		}
+	}
+	return webhookDelivery{}, false, nil
+}
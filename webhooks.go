@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+var webhookEventTypes = map[string]bool{
+	"create": true,
+	"update": true,
+	"retire": true,
+	"revive": true,
+}
+
+// webhookResponse is a webhook without its secret.
+func webhookResponse(hook webhook) webhook {
+	hook.Secret = ""
+	hook.Owner = ""
+	return hook
+}
+
+// requestOwner is the webhookOwner of the request's credentials, empty
+// without any.
+func requestOwner(req *http.Request) string {
+	sg, ok := req.Context().Value("sgConn").(Shotgun)
+	if !ok {
+		return ""
+	}
+	return webhookOwner(sg)
+}
+
+// ownedWebhook gets a webhook registered by the caller. Other callers'
+// webhooks are not found, their deliveries were read with the dispatcher's
+// script and may hold what the caller can't read.
+func ownedWebhook(config clientConfig, req *http.Request, id string) (webhook, bool) {
+	owner := requestOwner(req)
+	hook, ok := config.webhooks.store.Webhook(id)
+	if !ok || owner == "" || hook.Owner != owner {
+		return webhook{}, false
+	}
+	return hook, true
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v interface{}) {
+	jsonResp, err := json.Marshal(v)
+	if err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	rw.Write(jsonResp)
+}
+
+// webhooksEnabled writes a 503 when the dispatcher isn't running. It needs
+// script credentials which are optional.
+func webhooksEnabled(config clientConfig, rw http.ResponseWriter) bool {
+	if config.webhooks == nil {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(rw, "Webhooks are not configured")
+		return false
+	}
+	return true
+}
+
+// Handlers
+
+func webhookCreateHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling webhookCreateHandler")
+		if !webhooksEnabled(config, rw) {
+			return
+		}
+
+		var hook webhook
+		postBody, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			log.Errorf("Bad Request Body: %v", err)
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, err)
+			return
+		}
+		err = json.Unmarshal(postBody, &hook)
+		if err != nil {
+			log.Errorf("Bad Json: %v", err)
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, err)
+			return
+		}
+
+		if len(hook.EntityTypes) == 0 {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintln(rw, "entity_types missing")
+			return
+		}
+		for _, eventType := range hook.EventTypes {
+			if !webhookEventTypes[eventType] {
+				rw.WriteHeader(http.StatusBadRequest)
+				fmt.Fprintf(rw, "Invalid event type: '%s'\n", eventType)
+				return
+			}
+		}
+		target, err := url.Parse(hook.URL)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			rw.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(rw, "Invalid url: '%s'\n", hook.URL)
+			return
+		}
+
+		var filters *readFilters
+		if hook.Query != "" {
+			queryFilters, err := parseQuery(hook.Query)
+			if err != nil {
+				qpeError := err.(queryParseError)
+				log.Error("Request Error: ", qpeError)
+				rw.WriteHeader(qpeError.StatusCode)
+				return
+			}
+			filters = &queryFilters
+		}
+
+		ctx := req.Context()
+		sgConn := ctx.Value("sgConn")
+		if sgConn == nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		sg := sgConn.(Shotgun)
+
+		// Deliveries are read with the dispatcher's script, which can't
+		// apply a user's row or field permissions. Scripts get the whole
+		// entity type so they're the only ones who can register.
+		if sg.UserLogin != "" {
+			rw.WriteHeader(http.StatusForbidden)
+			fmt.Fprintln(rw, "Webhooks can only be registered with script credentials")
+			return
+		}
+
+		// Make sure the script can read what it is asking for.
+		for _, entityType := range hook.EntityTypes {
+			query := newReadQuery(entityType)
+			query.Paging["entities_per_page"] = 1
+			if filters != nil {
+				query.Filters = *filters
+			}
+			if _, err := readEntities(sg, query); err != nil {
+				log.Error("Request Error: ", err)
+				if strings.Contains(err.Error(), "Permission") {
+					rw.WriteHeader(http.StatusForbidden)
+				} else {
+					writeShotgunError(rw, err, http.StatusBadRequest)
+				}
+				fmt.Fprintln(rw, err)
+				return
+			}
+		}
+
+		hook.ID = newWebhookID()
+		hook.CreatedAt = time.Now().UTC()
+		hook.Owner = requestOwner(req)
+		if err := config.webhooks.Register(hook); err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		rw.Header().Set("Location", "/_webhooks/"+hook.ID)
+		writeJSON(rw, http.StatusCreated, webhookResponse(hook))
+	}
+}
+
+func webhookListHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling webhookListHandler")
+		if !webhooksEnabled(config, rw) {
+			return
+		}
+
+		owner := requestOwner(req)
+		hooks := make([]webhook, 0)
+		for _, hook := range config.webhooks.store.Webhooks() {
+			if owner != "" && hook.Owner == owner {
+				hooks = append(hooks, webhookResponse(hook))
+			}
+		}
+		writeJSON(rw, http.StatusOK, hooks)
+	}
+}
+
+func webhookGetHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling webhookGetHandler")
+		if !webhooksEnabled(config, rw) {
+			return
+		}
+
+		hook, ok := ownedWebhook(config, req, mux.Vars(req)["id"])
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(rw, http.StatusOK, webhookResponse(hook))
+	}
+}
+
+func webhookDeleteHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling webhookDeleteHandler")
+		if !webhooksEnabled(config, rw) {
+			return
+		}
+
+		id := mux.Vars(req)["id"]
+		if _, ok := ownedWebhook(config, req, id); !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ok, err := config.webhooks.Unregister(id)
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	}
+}
+
+func webhookDeliveriesHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling webhookDeliveriesHandler")
+		if !webhooksEnabled(config, rw) {
+			return
+		}
+
+		id := mux.Vars(req)["id"]
+		if _, ok := ownedWebhook(config, req, id); !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeJSON(rw, http.StatusOK, config.webhooks.History(id))
+	}
+}
+
+func webhookDeadLettersHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling webhookDeadLettersHandler")
+		if !webhooksEnabled(config, rw) {
+			return
+		}
+		deadLetters := make([]webhookDelivery, 0)
+		for _, delivery := range config.webhooks.store.DeadLetters() {
+			if _, ok := ownedWebhook(config, req, delivery.WebhookID); ok {
+				deadLetters = append(deadLetters, delivery)
+			}
+		}
+		writeJSON(rw, http.StatusOK, deadLetters)
+	}
+}
+
+func webhookRedeliverHandler(config clientConfig) func(rw http.ResponseWriter, req *http.Request) {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.Debug("Calling webhookRedeliverHandler")
+		if !webhooksEnabled(config, rw) {
+			return
+		}
+
+		id := mux.Vars(req)["id"]
+		delivery, ok := config.webhooks.store.DeadLetter(id)
+		if ok {
+			_, ok = ownedWebhook(config, req, delivery.WebhookID)
+		}
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		ok, err := config.webhooks.Redeliver(id)
+		if err != nil {
+			log.Error(err)
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		rw.WriteHeader(http.StatusAccepted)
+	}
+}
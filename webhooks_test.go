@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type WebhooksTestSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (suite *WebhooksTestSuite) SetupSuite() {
+	manager := GetQPManager()
+	log.Info(" -- Webhooks Test Suite --\n")
+	manager.SetActiveParsers("format1", "format2", "format3")
+}
+
+func (suite *WebhooksTestSuite) SetupTest() {
+	dir, err := ioutil.TempDir("", "sg-restful-webhooks")
+	suite.Require().Nil(err)
+	suite.dir = dir
+}
+
+func (suite *WebhooksTestSuite) TearDownTest() {
+	os.RemoveAll(suite.dir)
+}
+
+// config returns a config with a dispatcher that isn't started.
+func (suite *WebhooksTestSuite) config(config clientConfig, sg Shotgun) clientConfig {
+	store, err := newWebhookStore(filepath.Join(suite.dir, "webhooks.json"))
+	suite.Require().Nil(err)
+	config.webhooks = newWebhookDispatcher(sg, "webhooks-test", store, time.Second)
+	return config
+}
+
+func (suite *WebhooksTestSuite) serve(config clientConfig, client *Shotgun, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	ctx := req.Context()
+	ctx = context.WithValue(ctx, "sgConn", *client)
+	router(config).ServeHTTP(w, req.WithContext(ctx))
+	return w
+}
+
+func TestWebhooksTestSuite(t *testing.T) {
+	suite.Run(t, new(WebhooksTestSuite))
+}
+
+func (suite *WebhooksTestSuite) TestCreateListGetDelete() {
+	server, client, config := mockShotgun(200,
+		`{"results":{"entities":[],"paging_info":{"current_page":0,"page_count":0,"entity_count":0,"entities_per_page":1}}}`)
+	defer server.Close()
+	config = suite.config(config, *client)
+
+	w := suite.serve(config, client, postRequest("/_webhooks",
+		`{"entity_types":["Version"],"event_types":["create"],"q":"[[\"code\",\"is\",\"foo\"]]","url":"http://example.com/hook","secret":"shh"}`))
+	suite.Equal(http.StatusCreated, w.Code)
+
+	var created webhook
+	suite.Nil(json.Unmarshal(w.Body.Bytes(), &created))
+	suite.NotEmpty(created.ID)
+	suite.Empty(created.Secret)
+	suite.Equal("/_webhooks/"+created.ID, w.Header().Get("Location"))
+
+	stored, ok := config.webhooks.store.Webhook(created.ID)
+	suite.True(ok)
+	suite.Equal("shh", stored.Secret)
+
+	w = suite.serve(config, client, getRequest("/_webhooks"))
+	suite.Equal(http.StatusOK, w.Code)
+	var hooks []webhook
+	suite.Nil(json.Unmarshal(w.Body.Bytes(), &hooks))
+	suite.Len(hooks, 1)
+
+	w = suite.serve(config, client, getRequest("/_webhooks/"+created.ID))
+	suite.Equal(http.StatusOK, w.Code)
+
+	w = suite.serve(config, client, getRequest("/_webhooks/"+created.ID+"/deliveries"))
+	suite.Equal(http.StatusOK, w.Code)
+	suite.Equal("[]", w.Body.String())
+
+	w = suite.serve(config, client, deleteRequest("/_webhooks/"+created.ID))
+	suite.Equal(http.StatusOK, w.Code)
+
+	w = suite.serve(config, client, getRequest("/_webhooks/"+created.ID))
+	suite.Equal(http.StatusNotFound, w.Code)
+}
+
+func (suite *WebhooksTestSuite) TestCreateInvalid() {
+	server, client, config := mockShotgun(200, `{"results":{"entities":[]}}`)
+	defer server.Close()
+	config = suite.config(config, *client)
+
+	bodies := []string{
+		`foo`,
+		`{"event_types":["create"],"url":"http://example.com/hook"}`,
+		`{"entity_types":["Version"],"event_types":["foo"],"url":"http://example.com/hook"}`,
+		`{"entity_types":["Version"],"url":"ftp://example.com/hook"}`,
+		`{"entity_types":["Version"],"q":"foo","url":"http://example.com/hook"}`,
+	}
+	for _, body := range bodies {
+		w := suite.serve(config, client, postRequest("/_webhooks", body))
+		suite.Equal(http.StatusBadRequest, w.Code, body)
+	}
+	suite.Empty(config.webhooks.store.Webhooks())
+}
+
+func (suite *WebhooksTestSuite) TestCreatePermission() {
+	server, client, config := mockShotgun(200,
+		`{"exception":true,"message":"API read() Permission denied","error_code":100}`)
+	defer server.Close()
+	config = suite.config(config, *client)
+
+	w := suite.serve(config, client, postRequest("/_webhooks",
+		`{"entity_types":["Version"],"url":"http://example.com/hook"}`))
+	suite.Equal(http.StatusForbidden, w.Code)
+	suite.Empty(config.webhooks.store.Webhooks())
+}
+
+func (suite *WebhooksTestSuite) TestCreateUser() {
+	server, client, config := mockShotgun(200,
+		`{"results":{"entities":[],"paging_info":{"current_page":0,"page_count":0,"entity_count":0,"entities_per_page":1}}}`)
+	defer server.Close()
+	config = suite.config(config, *client)
+
+	req := postRequest("/_webhooks", `{"entity_types":["Version"],"url":"http://example.com/hook"}`)
+	req.Header.Set("Authorization", "Basic-User "+base64.StdEncoding.EncodeToString([]byte("artist:password")))
+	w := suite.serve(config, client, req)
+	suite.Equal(http.StatusForbidden, w.Code)
+	suite.Empty(config.webhooks.store.Webhooks())
+}
+
+func (suite *WebhooksTestSuite) TestOwnerKeepsHooksWithNewKey() {
+	server, client, config := mockShotgun(200,
+		`{"results":{"entities":[],"paging_info":{"current_page":0,"page_count":0,"entity_count":0,"entities_per_page":1}}}`)
+	defer server.Close()
+	config = suite.config(config, *client)
+
+	w := suite.serve(config, client, postRequest("/_webhooks",
+		`{"entity_types":["Version"],"url":"http://example.com/hook"}`))
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	hooks := config.webhooks.store.Webhooks()
+	suite.Require().Len(hooks, 1)
+	suite.Equal("script:fake-script", hooks[0].Owner)
+
+	req := getRequest("/_webhooks")
+	req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("fake-script:new-key")))
+	w = suite.serve(config, client, req)
+	var listed []webhook
+	suite.Nil(json.Unmarshal(w.Body.Bytes(), &listed))
+	suite.Len(listed, 1)
+}
+
+func (suite *WebhooksTestSuite) TestDeadLetters() {
+	server, client, config := mockShotgun(200, `{"results":{"entities":[]}}`)
+	defer server.Close()
+	config = suite.config(config, *client)
+
+	config.webhooks.store.AddWebhook(webhook{ID: "hook1", EntityTypes: []string{"Version"}, Owner: "script:fake-script"})
+	config.webhooks.store.AddDeadLetter(webhookDelivery{ID: "d1", WebhookID: "hook1", Status: deliveryDead})
+
+	w := suite.serve(config, client, getRequest("/_webhooks/dead-letters"))
+	suite.Equal(http.StatusOK, w.Code)
+	var deadLetters []webhookDelivery
+	suite.Nil(json.Unmarshal(w.Body.Bytes(), &deadLetters))
+	suite.Len(deadLetters, 1)
+
+	w = suite.serve(config, client, postRequest("/_webhooks/dead-letters/d2/redeliver", ""))
+	suite.Equal(http.StatusNotFound, w.Code)
+}
+
+func (suite *WebhooksTestSuite) TestOtherOwner() {
+	server, client, config := mockShotgun(200,
+		`{"results":{"entities":[],"paging_info":{"current_page":0,"page_count":0,"entity_count":0,"entities_per_page":1}}}`)
+	defer server.Close()
+	config = suite.config(config, *client)
+
+	w := suite.serve(config, client, postRequest("/_webhooks",
+		`{"entity_types":["Version"],"url":"http://example.com/hook"}`))
+	suite.Require().Equal(http.StatusCreated, w.Code)
+	var created webhook
+	suite.Nil(json.Unmarshal(w.Body.Bytes(), &created))
+	suite.Empty(created.Owner)
+	config.webhooks.store.AddDeadLetter(webhookDelivery{ID: "d1", WebhookID: created.ID, Status: deliveryDead})
+
+	asOther := func(req *http.Request) *http.Request {
+		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("other-script:other-key")))
+		return req
+	}
+
+	w = suite.serve(config, client, asOther(getRequest("/_webhooks")))
+	suite.Equal("[]", w.Body.String())
+	w = suite.serve(config, client, asOther(getRequest("/_webhooks/dead-letters")))
+	suite.Equal("[]", w.Body.String())
+	w = suite.serve(config, client, asOther(getRequest("/_webhooks/"+created.ID)))
+	suite.Equal(http.StatusNotFound, w.Code)
+	w = suite.serve(config, client, asOther(getRequest("/_webhooks/"+created.ID+"/deliveries")))
+	suite.Equal(http.StatusNotFound, w.Code)
+	w = suite.serve(config, client, asOther(postRequest("/_webhooks/dead-letters/d1/redeliver", "")))
+	suite.Equal(http.StatusNotFound, w.Code)
+	w = suite.serve(config, client, asOther(deleteRequest("/_webhooks/"+created.ID)))
+	suite.Equal(http.StatusNotFound, w.Code)
+
+	// Still there for the owner.
+	_, ok := config.webhooks.store.Webhook(created.ID)
+	suite.True(ok)
+	suite.Len(config.webhooks.store.DeadLetters(), 1)
+	w = suite.serve(config, client, getRequest("/_webhooks/dead-letters"))
+	var deadLetters []webhookDelivery
+	suite.Nil(json.Unmarshal(w.Body.Bytes(), &deadLetters))
+	suite.Len(deadLetters, 1)
+}
+
+func (suite *WebhooksTestSuite) TestNotConfigured() {
+	server, client, config := mockShotgun(200, `{"results":{"entities":[]}}`)
+	defer server.Close()
+
+	w := suite.serve(config, client, getRequest("/_webhooks"))
+	suite.Equal(http.StatusServiceUnavailable, w.Code)
+}